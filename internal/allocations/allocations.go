@@ -13,17 +13,19 @@ import (
 )
 
 const (
-	fileVersion   = 1
+	fileVersion   = 2
 	lockWait      = 5 * time.Second
 	lockSleepStep = 50 * time.Millisecond
 )
 
 type Allocation struct {
-	Directory  string    `json:"directory"`
-	Name       string    `json:"name"`
-	AssignedAt time.Time `json:"assigned_at"`
-	LastUsedAt time.Time `json:"last_used_at"`
-	Locked     bool      `json:"locked"`
+	Directory  string            `json:"directory"`
+	Name       string            `json:"name"`
+	AssignedAt time.Time         `json:"assigned_at"`
+	LastUsedAt time.Time         `json:"last_used_at"`
+	Locked     bool              `json:"locked"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	Note       string            `json:"note,omitempty"`
 }
 
 type File struct {
@@ -65,15 +67,11 @@ func OpenLocked(path string, exclusive bool) (*LockedFile, error) {
 	if err != nil {
 		return nil, err
 	}
-	lockType := unix.LOCK_SH
-	if exclusive {
-		lockType = unix.LOCK_EX
-	}
-	if err := lockFile(file, lockType); err != nil {
+	if err := lockFile(file, lockTypeFor(exclusive)); err != nil {
 		_ = file.Close()
 		return nil, err
 	}
-	data, err := readFile(file)
+	data, err := readFile(file, exclusive)
 	if err != nil {
 		_ = unlockFile(file)
 		_ = file.Close()
@@ -82,10 +80,20 @@ func OpenLocked(path string, exclusive bool) (*LockedFile, error) {
 	return &LockedFile{Path: path, File: file, Data: data}, nil
 }
 
+func lockTypeFor(exclusive bool) int {
+	if exclusive {
+		return unix.LOCK_EX
+	}
+	return unix.LOCK_SH
+}
+
 func (l *LockedFile) Save() error {
 	if l == nil || l.Data == nil {
 		return errors.New("allocations data is nil")
 	}
+	if l.Data.Version > CurrentVersion {
+		return ErrNewerVersion
+	}
 	return writeFile(l.Path, l.Data)
 }
 
@@ -100,22 +108,6 @@ func (l *LockedFile) Close() error {
 	return l.File.Close()
 }
 
-func (l *LockedFile) FindByDirectoryName(dir, name string) (int, *Allocation) {
-	if l == nil || l.Data == nil {
-		return 0, nil
-	}
-	for portStr, alloc := range l.Data.Allocations {
-		if alloc.Directory == dir && alloc.Name == name {
-			port, err := strconv.Atoi(portStr)
-			if err != nil {
-				return 0, nil
-			}
-			return port, alloc
-		}
-	}
-	return 0, nil
-}
-
 func (l *LockedFile) DeletePort(port int) {
 	if l == nil || l.Data == nil {
 		return
@@ -133,42 +125,36 @@ func (l *LockedFile) SetAllocation(port int, alloc *Allocation) {
 	l.Data.Allocations[strconv.Itoa(port)] = alloc
 }
 
-func (l *LockedFile) AllPorts() []int {
-	if l == nil || l.Data == nil {
-		return nil
-	}
-	ports := make([]int, 0, len(l.Data.Allocations))
-	for portStr := range l.Data.Allocations {
-		port, err := strconv.Atoi(portStr)
-		if err == nil {
-			ports = append(ports, port)
-		}
-	}
-	return ports
-}
-
-func readFile(file *os.File) (*File, error) {
-	if _, err := file.Seek(0, 0); err != nil {
-		return nil, err
-	}
+// readFile reads the locked file and upgrades older formats to the current
+// version. With an exclusive lock the upgrade is written back, after backing
+// up the original; with a shared lock it only happens in memory. Files from
+// a newer version can only be opened with a shared lock.
+func readFile(file *os.File, exclusive bool) (*File, error) {
 	data, err := os.ReadFile(file.Name())
 	if err != nil {
 		return nil, err
 	}
-	if len(data) == 0 {
-		return DefaultFile(), nil
-	}
-	var out File
-	if err := json.Unmarshal(data, &out); err != nil {
-		return nil, fmt.Errorf("parse allocations: %w", err)
+	out, from, steps, err := upgrade(data)
+	if errors.Is(err, ErrNewerVersion) && !exclusive {
+		// Readers can still look at a newer file; Save refuses to write it.
+		var newer File
+		if err := json.Unmarshal(data, &newer); err != nil {
+			return nil, fmt.Errorf("parse allocations: %w", err)
+		}
+		return &newer, nil
 	}
-	if out.Allocations == nil {
-		out.Allocations = map[string]*Allocation{}
+	if err != nil {
+		return nil, err
 	}
-	if out.Version == 0 {
-		out.Version = fileVersion
+	if len(steps) > 0 && exclusive {
+		if _, err := backup(file.Name(), from, data); err != nil {
+			return nil, err
+		}
+		if err := writeFile(file.Name(), out); err != nil {
+			return nil, err
+		}
 	}
-	return &out, nil
+	return out, nil
 }
 
 func writeFile(path string, data *File) error {
@@ -3,7 +3,6 @@ package allocations
 import (
 	"os"
 	"path/filepath"
-	"sort"
 	"testing"
 	"time"
 )
@@ -25,8 +24,8 @@ func TestOpenLocked(t *testing.T) {
 		}
 
 		// Data should have defaults
-		if lf.Data.Version != 1 {
-			t.Errorf("Version = %d, want 1", lf.Data.Version)
+		if lf.Data.Version != CurrentVersion {
+			t.Errorf("Version = %d, want %d", lf.Data.Version, CurrentVersion)
 		}
 		if lf.Data.LastIssuedPort != 0 {
 			t.Errorf("LastIssuedPort = %d, want 0", lf.Data.LastIssuedPort)
@@ -64,7 +63,7 @@ func TestOpenLocked(t *testing.T) {
 
 		// Create initial file with some data
 		initial := &File{
-			Version:        1,
+			Version:        CurrentVersion,
 			LastIssuedPort: 20005,
 			Allocations: map[string]*Allocation{
 				"20001": {
@@ -110,8 +109,8 @@ func TestOpenLocked(t *testing.T) {
 		defer lf.Close()
 
 		// Should get defaults
-		if lf.Data.Version != 1 {
-			t.Errorf("Version = %d, want 1", lf.Data.Version)
+		if lf.Data.Version != CurrentVersion {
+			t.Errorf("Version = %d, want %d", lf.Data.Version, CurrentVersion)
 		}
 	})
 }
@@ -154,73 +153,6 @@ func TestLockedFile_SetAllocation(t *testing.T) {
 	}
 }
 
-func TestLockedFile_FindByDirectoryName(t *testing.T) {
-	tmpDir := t.TempDir()
-	path := filepath.Join(tmpDir, "allocations.json")
-
-	lf, err := OpenLocked(path, true)
-	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
-	}
-	defer lf.Close()
-
-	now := time.Now().UTC()
-
-	// Add some allocations
-	lf.SetAllocation(20001, &Allocation{
-		Directory: "/project/foo", Name: "main",
-		AssignedAt: now, LastUsedAt: now,
-	})
-	lf.SetAllocation(20002, &Allocation{
-		Directory: "/project/foo", Name: "api",
-		AssignedAt: now, LastUsedAt: now,
-	})
-	lf.SetAllocation(20003, &Allocation{
-		Directory: "/project/bar", Name: "main",
-		AssignedAt: now, LastUsedAt: now,
-	})
-
-	t.Run("finds existing allocation", func(t *testing.T) {
-		port, alloc := lf.FindByDirectoryName("/project/foo", "main")
-		if port != 20001 {
-			t.Errorf("port = %d, want 20001", port)
-		}
-		if alloc == nil {
-			t.Fatal("allocation should not be nil")
-		}
-	})
-
-	t.Run("finds different name in same directory", func(t *testing.T) {
-		port, alloc := lf.FindByDirectoryName("/project/foo", "api")
-		if port != 20002 {
-			t.Errorf("port = %d, want 20002", port)
-		}
-		if alloc == nil {
-			t.Fatal("allocation should not be nil")
-		}
-	})
-
-	t.Run("finds same name in different directory", func(t *testing.T) {
-		port, alloc := lf.FindByDirectoryName("/project/bar", "main")
-		if port != 20003 {
-			t.Errorf("port = %d, want 20003", port)
-		}
-		if alloc == nil {
-			t.Fatal("allocation should not be nil")
-		}
-	})
-
-	t.Run("returns zero and nil when not found", func(t *testing.T) {
-		port, alloc := lf.FindByDirectoryName("/project/foo", "nonexistent")
-		if port != 0 {
-			t.Errorf("port = %d, want 0", port)
-		}
-		if alloc != nil {
-			t.Error("allocation should be nil")
-		}
-	})
-}
-
 func TestLockedFile_DeletePort(t *testing.T) {
 	tmpDir := t.TempDir()
 	path := filepath.Join(tmpDir, "allocations.json")
@@ -260,51 +192,6 @@ func TestLockedFile_DeletePort(t *testing.T) {
 	lf.DeletePort(99999)
 }
 
-func TestLockedFile_AllPorts(t *testing.T) {
-	tmpDir := t.TempDir()
-	path := filepath.Join(tmpDir, "allocations.json")
-
-	lf, err := OpenLocked(path, true)
-	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
-	}
-	defer lf.Close()
-
-	t.Run("returns empty slice for no allocations", func(t *testing.T) {
-		ports := lf.AllPorts()
-		if len(ports) != 0 {
-			t.Errorf("expected empty slice, got %v", ports)
-		}
-	})
-
-	now := time.Now().UTC()
-	lf.SetAllocation(20003, &Allocation{
-		Directory: "/a", Name: "x", AssignedAt: now, LastUsedAt: now,
-	})
-	lf.SetAllocation(20001, &Allocation{
-		Directory: "/b", Name: "y", AssignedAt: now, LastUsedAt: now,
-	})
-	lf.SetAllocation(20002, &Allocation{
-		Directory: "/c", Name: "z", AssignedAt: now, LastUsedAt: now,
-	})
-
-	t.Run("returns all port numbers", func(t *testing.T) {
-		ports := lf.AllPorts()
-		if len(ports) != 3 {
-			t.Fatalf("expected 3 ports, got %d", len(ports))
-		}
-
-		// Sort for consistent comparison
-		sort.Ints(ports)
-		expected := []int{20001, 20002, 20003}
-		for i, p := range ports {
-			if p != expected[i] {
-				t.Errorf("ports[%d] = %d, want %d", i, p, expected[i])
-			}
-		}
-	})
-}
-
 func TestLockedFile_Save(t *testing.T) {
 	t.Run("persists changes to disk", func(t *testing.T) {
 		tmpDir := t.TempDir()
@@ -387,16 +274,6 @@ func TestLockedFile_Save(t *testing.T) {
 func TestLockedFile_NilSafety(t *testing.T) {
 	var lf *LockedFile
 
-	t.Run("FindByDirectoryName on nil receiver", func(t *testing.T) {
-		port, alloc := lf.FindByDirectoryName("/any", "name")
-		if port != 0 {
-			t.Errorf("port = %d, want 0", port)
-		}
-		if alloc != nil {
-			t.Error("alloc should be nil")
-		}
-	})
-
 	t.Run("DeletePort on nil receiver does not panic", func(t *testing.T) {
 		defer func() {
 			if r := recover(); r != nil {
@@ -415,13 +292,6 @@ func TestLockedFile_NilSafety(t *testing.T) {
 		lf.SetAllocation(12345, nil)
 	})
 
-	t.Run("AllPorts on nil receiver", func(t *testing.T) {
-		ports := lf.AllPorts()
-		if ports != nil {
-			t.Errorf("expected nil, got %v", ports)
-		}
-	})
-
 	t.Run("Close on nil receiver does not panic", func(t *testing.T) {
 		defer func() {
 			if r := recover(); r != nil {
@@ -445,8 +315,8 @@ func TestLockedFile_NilSafety(t *testing.T) {
 func TestDefaultFile(t *testing.T) {
 	f := DefaultFile()
 
-	if f.Version != 1 {
-		t.Errorf("Version = %d, want 1", f.Version)
+	if f.Version != CurrentVersion {
+		t.Errorf("Version = %d, want %d", f.Version, CurrentVersion)
 	}
 	if f.LastIssuedPort != 0 {
 		t.Errorf("LastIssuedPort = %d, want 0", f.LastIssuedPort)
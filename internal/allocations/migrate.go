@@ -0,0 +1,235 @@
+package allocations
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// CurrentVersion is the allocations file format written by this build.
+const CurrentVersion = fileVersion
+
+// ErrNewerVersion is returned when a file was written by a newer portpls
+// whose format this build does not understand.
+var ErrNewerVersion = errors.New("allocations file was written by a newer version of portpls")
+
+// Migration upgrades the raw JSON document of an allocations file from
+// version From to From+1. Apply edits doc in place and returns a
+// human-readable line per change for previews.
+type Migration struct {
+	From        int
+	Description string
+	Apply       func(doc map[string]any) ([]string, error)
+}
+
+// migrations must stay ordered by From with no gaps; each one is applied in
+// turn until the document reaches CurrentVersion. Migrations work on raw
+// JSON so they keep working after the Go types change.
+var migrations = []Migration{
+	{
+		From:        0,
+		Description: "add version field and fill in missing allocation names and timestamps",
+		Apply:       migrateV0,
+	},
+	{
+		From:        1,
+		Description: "allow labels and notes on allocations",
+		Apply:       migrateV1,
+	},
+}
+
+// MigrationStep is one applied migration and the changes it made.
+type MigrationStep struct {
+	From        int
+	To          int
+	Description string
+	Changes     []string
+}
+
+// MigrationResult describes a migration of an allocations file.
+type MigrationResult struct {
+	Path   string
+	From   int
+	To     int
+	Steps  []MigrationStep
+	Backup string // path of the pre-migration copy; empty for dry runs and no-ops
+}
+
+// Needed reports whether the file was (or would be) changed.
+func (r MigrationResult) Needed() bool {
+	return r.From != r.To
+}
+
+// BackupPath returns where the pre-migration copy of a file at the given
+// version is kept.
+func BackupPath(path string, version int) string {
+	return fmt.Sprintf("%s.v%d.bak", path, version)
+}
+
+// Migrate upgrades the allocations file at path to CurrentVersion, backing
+// up the original first. With dryRun the file is left untouched and the
+// result only describes what would change.
+func Migrate(path string, dryRun bool) (MigrationResult, error) {
+	result := MigrationResult{Path: path}
+	if path == "" {
+		return result, errors.New("allocations path is empty")
+	}
+	file, err := os.OpenFile(path, os.O_RDWR, 0o644)
+	if errors.Is(err, os.ErrNotExist) {
+		result.From, result.To = CurrentVersion, CurrentVersion
+		return result, nil
+	} else if err != nil {
+		return result, err
+	}
+	defer file.Close()
+	if err := lockFile(file, lockTypeFor(!dryRun)); err != nil {
+		return result, err
+	}
+	defer func() {
+		_ = unlockFile(file)
+	}()
+
+	original, err := os.ReadFile(path)
+	if err != nil {
+		return result, err
+	}
+	upgraded, from, steps, err := upgrade(original)
+	if err != nil {
+		return result, err
+	}
+	result.From, result.To, result.Steps = from, CurrentVersion, steps
+	if dryRun || !result.Needed() {
+		return result, nil
+	}
+	if result.Backup, err = backup(path, from, original); err != nil {
+		return result, err
+	}
+	return result, writeFile(path, upgraded)
+}
+
+// upgrade runs every migration needed to bring data to CurrentVersion and
+// returns the upgraded file, the version it started at and the steps taken.
+func upgrade(data []byte) (*File, int, []MigrationStep, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return DefaultFile(), CurrentVersion, nil, nil
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, 0, nil, fmt.Errorf("parse allocations: %w", err)
+	}
+	from, err := docVersion(doc)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	if from > CurrentVersion {
+		return nil, from, nil, fmt.Errorf("%w (file version %d, supported %d)", ErrNewerVersion, from, CurrentVersion)
+	}
+
+	var steps []MigrationStep
+	for version := from; version < CurrentVersion; version++ {
+		migration, ok := findMigration(version)
+		if !ok {
+			return nil, from, nil, fmt.Errorf("no migration from allocations version %d", version)
+		}
+		changes, err := migration.Apply(doc)
+		if err != nil {
+			return nil, from, nil, fmt.Errorf("migrate allocations v%d to v%d: %w", version, version+1, err)
+		}
+		doc["version"] = version + 1
+		steps = append(steps, MigrationStep{
+			From:        version,
+			To:          version + 1,
+			Description: migration.Description,
+			Changes:     changes,
+		})
+	}
+
+	migrated, err := json.Marshal(doc)
+	if err != nil {
+		return nil, from, nil, err
+	}
+	var out File
+	if err := json.Unmarshal(migrated, &out); err != nil {
+		return nil, from, nil, fmt.Errorf("parse allocations: %w", err)
+	}
+	if out.Allocations == nil {
+		out.Allocations = map[string]*Allocation{}
+	}
+	return &out, from, steps, nil
+}
+
+func docVersion(doc map[string]any) (int, error) {
+	raw, ok := doc["version"]
+	if !ok || raw == nil {
+		return 0, nil
+	}
+	n, ok := raw.(float64)
+	if !ok || n != float64(int(n)) || n < 0 {
+		return 0, fmt.Errorf("parse allocations: invalid version %v", raw)
+	}
+	return int(n), nil
+}
+
+func findMigration(from int) (Migration, bool) {
+	for _, m := range migrations {
+		if m.From == from {
+			return m, true
+		}
+	}
+	return Migration{}, false
+}
+
+func backup(path string, version int, data []byte) (string, error) {
+	dest := BackupPath(path, version)
+	if err := os.WriteFile(dest, data, 0o644); err != nil {
+		return "", fmt.Errorf("back up allocations: %w", err)
+	}
+	return dest, nil
+}
+
+// migrateV0 upgrades files written before the format was versioned, when
+// allocations could lack a name or a last-used timestamp.
+func migrateV0(doc map[string]any) ([]string, error) {
+	var changes []string
+	allocs, _ := doc["allocations"].(map[string]any)
+	if allocs == nil {
+		allocs = map[string]any{}
+		doc["allocations"] = allocs
+	}
+	if _, ok := doc["last_issued_port"]; !ok {
+		doc["last_issued_port"] = 0
+	}
+	ports := make([]string, 0, len(allocs))
+	for port := range allocs {
+		ports = append(ports, port)
+	}
+	sort.Strings(ports)
+	for _, port := range ports {
+		alloc, ok := allocs[port].(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("allocation %s is not an object", port)
+		}
+		if name, _ := alloc["name"].(string); name == "" {
+			alloc["name"] = "main"
+			changes = append(changes, fmt.Sprintf("port %s: set name to \"main\"", port))
+		}
+		if used, _ := alloc["last_used_at"].(string); used == "" {
+			if assigned, ok := alloc["assigned_at"].(string); ok && assigned != "" {
+				alloc["last_used_at"] = assigned
+				changes = append(changes, fmt.Sprintf("port %s: set last_used_at to assigned_at", port))
+			}
+		}
+	}
+	changes = append(changes, "set version to 1")
+	return changes, nil
+}
+
+// migrateV1 changes nothing in the document. Version 2 added optional labels
+// and notes, and bumping the version keeps older builds, which would drop
+// them on their next write, from writing the file.
+func migrateV1(doc map[string]any) ([]string, error) {
+	return []string{"set version to 2"}, nil
+}
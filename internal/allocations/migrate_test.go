@@ -0,0 +1,222 @@
+package allocations
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const legacyFile = `{
+  "last_issued_port": 20001,
+  "allocations": {
+    "20001": {"directory": "/project/foo", "assigned_at": "2026-01-21T10:00:00Z"},
+    "20002": {"directory": "/project/bar", "name": "web", "assigned_at": "2026-01-21T10:00:00Z", "last_used_at": "2026-01-22T10:00:00Z"}
+  }
+}`
+
+func TestMigrate(t *testing.T) {
+	t.Run("dry run describes changes without writing", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		path := filepath.Join(tmpDir, "allocations.json")
+		if err := os.WriteFile(path, []byte(legacyFile), 0644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+
+		result, err := Migrate(path, true)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.From != 0 || result.To != CurrentVersion {
+			t.Errorf("From/To = %d/%d, want 0/%d", result.From, result.To, CurrentVersion)
+		}
+		if len(result.Steps) != 2 {
+			t.Fatalf("expected 2 steps, got %d", len(result.Steps))
+		}
+		wantChanges := []string{
+			`port 20001: set name to "main"`,
+			"port 20001: set last_used_at to assigned_at",
+			"set version to 1",
+		}
+		if len(result.Steps[0].Changes) != len(wantChanges) {
+			t.Fatalf("changes = %v, want %v", result.Steps[0].Changes, wantChanges)
+		}
+		for i, want := range wantChanges {
+			if result.Steps[0].Changes[i] != want {
+				t.Errorf("change %d = %q, want %q", i, result.Steps[0].Changes[i], want)
+			}
+		}
+		if result.Backup != "" {
+			t.Errorf("Backup = %q, want empty for dry run", result.Backup)
+		}
+		data, _ := os.ReadFile(path)
+		if string(data) != legacyFile {
+			t.Error("dry run modified the file")
+		}
+	})
+
+	t.Run("upgrades file and keeps a backup", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		path := filepath.Join(tmpDir, "allocations.json")
+		if err := os.WriteFile(path, []byte(legacyFile), 0644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+
+		result, err := Migrate(path, false)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.Backup != BackupPath(path, 0) {
+			t.Errorf("Backup = %q, want %q", result.Backup, BackupPath(path, 0))
+		}
+		backup, err := os.ReadFile(result.Backup)
+		if err != nil || string(backup) != legacyFile {
+			t.Errorf("backup content mismatch (err=%v)", err)
+		}
+
+		lf, err := OpenLocked(path, false)
+		if err != nil {
+			t.Fatalf("failed to open migrated file: %v", err)
+		}
+		defer lf.Close()
+		if lf.Data.Version != CurrentVersion {
+			t.Errorf("Version = %d, want %d", lf.Data.Version, CurrentVersion)
+		}
+		alloc := lf.Data.Allocations["20001"]
+		if alloc.Name != "main" {
+			t.Errorf("Name = %q, want main", alloc.Name)
+		}
+		if !alloc.LastUsedAt.Equal(alloc.AssignedAt) {
+			t.Errorf("LastUsedAt = %v, want %v", alloc.LastUsedAt, alloc.AssignedAt)
+		}
+		if lf.Data.Allocations["20002"].Name != "web" {
+			t.Error("existing name should be preserved")
+		}
+	})
+
+	t.Run("upgrades version 1 files so older builds keep off labels", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		path := filepath.Join(tmpDir, "allocations.json")
+		v1 := `{"version": 1, "last_issued_port": 20001, "allocations": {"20001": {"directory": "/project/foo", "name": "main", "assigned_at": "2026-01-21T10:00:00Z", "last_used_at": "2026-01-21T10:00:00Z", "locked": false}}}`
+		if err := os.WriteFile(path, []byte(v1), 0644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+
+		result, err := Migrate(path, false)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.From != 1 || result.To != 2 || len(result.Steps) != 1 {
+			t.Fatalf("result = %+v, want one step from 1 to 2", result)
+		}
+		if result.Backup != BackupPath(path, 1) {
+			t.Errorf("Backup = %q, want %q", result.Backup, BackupPath(path, 1))
+		}
+		lf, err := OpenLocked(path, false)
+		if err != nil {
+			t.Fatalf("failed to open migrated file: %v", err)
+		}
+		defer lf.Close()
+		if lf.Data.Version != 2 || lf.Data.Allocations["20001"].Directory != "/project/foo" {
+			t.Errorf("migrated file = %+v", lf.Data)
+		}
+	})
+
+	t.Run("is a no-op for current files", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		path := filepath.Join(tmpDir, "allocations.json")
+		if err := writeFile(path, DefaultFile()); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+
+		result, err := Migrate(path, false)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.Needed() {
+			t.Errorf("expected no migration, got %+v", result)
+		}
+		if _, err := os.Stat(BackupPath(path, CurrentVersion)); !os.IsNotExist(err) {
+			t.Error("no backup expected for a no-op")
+		}
+	})
+}
+
+func TestOpenLockedMigrates(t *testing.T) {
+	t.Run("exclusive open writes the upgrade", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		path := filepath.Join(tmpDir, "allocations.json")
+		if err := os.WriteFile(path, []byte(legacyFile), 0644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+
+		lf, err := OpenLocked(path, true)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		lf.Close()
+
+		var onDisk map[string]any
+		data, _ := os.ReadFile(path)
+		if err := json.Unmarshal(data, &onDisk); err != nil {
+			t.Fatalf("invalid JSON on disk: %v", err)
+		}
+		if onDisk["version"] != float64(CurrentVersion) {
+			t.Errorf("version on disk = %v, want %d", onDisk["version"], CurrentVersion)
+		}
+		if _, err := os.Stat(BackupPath(path, 0)); err != nil {
+			t.Errorf("expected backup: %v", err)
+		}
+	})
+
+	t.Run("shared open upgrades in memory only", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		path := filepath.Join(tmpDir, "allocations.json")
+		if err := os.WriteFile(path, []byte(legacyFile), 0644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+
+		lf, err := OpenLocked(path, false)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer lf.Close()
+		if lf.Data.Allocations["20001"].Name != "main" {
+			t.Error("expected in-memory upgrade")
+		}
+		data, _ := os.ReadFile(path)
+		if string(data) != legacyFile {
+			t.Error("shared open modified the file")
+		}
+	})
+}
+
+func TestNewerVersion(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "allocations.json")
+	newer := `{"version": 99, "last_issued_port": 0, "allocations": {}}`
+	if err := os.WriteFile(path, []byte(newer), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	if _, err := OpenLocked(path, true); !errors.Is(err, ErrNewerVersion) {
+		t.Errorf("exclusive open error = %v, want ErrNewerVersion", err)
+	}
+	if _, err := Migrate(path, false); !errors.Is(err, ErrNewerVersion) {
+		t.Errorf("Migrate error = %v, want ErrNewerVersion", err)
+	}
+
+	lf, err := OpenLocked(path, false)
+	if err != nil {
+		t.Fatalf("shared open should succeed: %v", err)
+	}
+	defer lf.Close()
+	if err := lf.Save(); !errors.Is(err, ErrNewerVersion) {
+		t.Errorf("Save error = %v, want ErrNewerVersion", err)
+	}
+	data, _ := os.ReadFile(path)
+	if string(data) != newer {
+		t.Error("newer file was modified")
+	}
+}
@@ -0,0 +1,94 @@
+package allocations
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+
+	"golang.org/x/sys/unix"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// ErrBusy is returned by Peek when another process is writing the store.
+var ErrBusy = errors.New("allocations are being updated")
+
+// Peek returns every allocation in the store at path, ordered by port,
+// without ever waiting for a lock or writing anything: a store that is being
+// written returns ErrBusy, a missing one reads as empty and older formats
+// are only upgraded in memory. It is meant for callers that must not block,
+// like shell prompts.
+func Peek(path string) ([]Record, error) {
+	if path == "" {
+		return nil, errors.New("allocations path is empty")
+	}
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if IsSQLitePath(path) {
+		return peekSQLite(path)
+	}
+	return peekFile(path)
+}
+
+func peekFile(path string) ([]Record, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	if err := unix.Flock(int(file.Fd()), unix.LOCK_SH|unix.LOCK_NB); errors.Is(err, unix.EWOULDBLOCK) {
+		return nil, ErrBusy
+	} else if err != nil {
+		return nil, err
+	}
+	defer unlockFile(file)
+	data, err := readFile(file, false)
+	if err != nil {
+		return nil, err
+	}
+	return NewFileTx(data).Query(Query{})
+}
+
+func peekSQLite(path string) ([]Record, error) {
+	dsn := (&url.URL{
+		Scheme:   "file",
+		Path:     path,
+		RawQuery: url.Values{"mode": {"ro"}}.Encode(),
+	}).String()
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, peekError(err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	version, err := metaInt(tx, "version")
+	if err != nil {
+		return nil, peekError(err)
+	}
+	if version > schemaVersion {
+		return nil, fmt.Errorf("%w (database version %d, supported %d)", ErrNewerVersion, version, schemaVersion)
+	}
+	records, err := sqliteTx{tx}.Query(Query{})
+	return records, peekError(err)
+}
+
+// peekError turns SQLite's busy errors into ErrBusy. Without a busy timeout
+// they are returned right away instead of being retried.
+func peekError(err error) error {
+	var sqlErr *sqlite.Error
+	if errors.As(err, &sqlErr) && sqlErr.Code()&0xff == sqlite3.SQLITE_BUSY {
+		return ErrBusy
+	}
+	return err
+}
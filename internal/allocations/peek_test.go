@@ -0,0 +1,70 @@
+package allocations
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPeek(t *testing.T) {
+	for _, file := range []string{"allocations.json", "allocations.db"} {
+		t.Run(file, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), file)
+			t.Run("missing store reads as empty", func(t *testing.T) {
+				records, err := Peek(path)
+				if err != nil || len(records) != 0 {
+					t.Fatalf("Peek = %+v, %v; want empty", records, err)
+				}
+				if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+					t.Errorf("Peek created %s", path)
+				}
+			})
+
+			s, err := Open(path)
+			if err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+			defer s.Close()
+			_ = s.Update(func(tx Tx) error {
+				_ = tx.Set(20002, &Allocation{Directory: "/b", Name: "api"})
+				return tx.Set(20001, &Allocation{Directory: "/a", Name: "web", Locked: true})
+			})
+
+			records, err := Peek(path)
+			if err != nil {
+				t.Fatalf("Peek: %v", err)
+			}
+			if len(records) != 2 || records[0].Port != 20001 || !records[0].Locked || records[1].Name != "api" {
+				t.Errorf("records = %+v", records)
+			}
+		})
+	}
+
+	t.Run("does not wait for a writer", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "allocations.json")
+		lf, err := OpenLocked(path, true)
+		if err != nil {
+			t.Fatalf("OpenLocked: %v", err)
+		}
+		defer lf.Close()
+		if _, err := Peek(path); !errors.Is(err, ErrBusy) {
+			t.Errorf("Peek error = %v, want ErrBusy", err)
+		}
+	})
+
+	t.Run("json upgrade stays in memory", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "allocations.json")
+		if err := os.WriteFile(path, []byte(legacyFile), 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		records, err := Peek(path)
+		if err != nil || len(records) != 2 || records[0].Name != "main" {
+			t.Fatalf("Peek = %+v, %v", records, err)
+		}
+		data, _ := os.ReadFile(path)
+		if string(data) != legacyFile {
+			t.Errorf("Peek rewrote the file: %s", data)
+		}
+	})
+}
@@ -0,0 +1,274 @@
+package allocations
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strconv"
+
+	_ "modernc.org/sqlite" // pure Go driver, so release builds stay CGO-free
+)
+
+// schemaVersion is the SQLite schema written by this build. It is kept
+// separate from the JSON file version because the two evolve independently.
+// Version 2 added labels and notes to the allocation data; the tables are
+// unchanged, but older builds would drop them when rewriting a row.
+const schemaVersion = 2
+
+const schema = `
+CREATE TABLE IF NOT EXISTS meta (
+	key   TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS allocations (
+	port      INTEGER PRIMARY KEY,
+	directory TEXT NOT NULL,
+	name      TEXT NOT NULL,
+	data      TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS allocations_directory_name ON allocations (directory, name);
+`
+
+// SQLiteStore keeps allocations in a SQLite database, so updates touch only
+// the rows they change. Read transactions are deferred and, with the WAL
+// journal, neither wait for writers nor block them. Write transactions take
+// the database lock up front and wait for other processes for up to the same
+// time as the file lock.
+type SQLiteStore struct {
+	Path   string
+	reader *sql.DB
+	writer *sql.DB
+}
+
+// OpenSQLite opens the database at path, creating it and its schema if
+// needed. Opening an existing database only reads it.
+func OpenSQLite(path string) (*SQLiteStore, error) {
+	if path == "" {
+		return nil, errors.New("allocations path is empty")
+	}
+	if err := ensureDir(filepath.Dir(path)); err != nil {
+		return nil, err
+	}
+	reader, err := openSQLiteDB(path, "deferred")
+	if err != nil {
+		return nil, err
+	}
+	writer, err := openSQLiteDB(path, "immediate")
+	if err != nil {
+		_ = reader.Close()
+		return nil, err
+	}
+	s := &SQLiteStore{Path: path, reader: reader, writer: writer}
+	if err := s.init(); err != nil {
+		_ = s.Close()
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// openSQLiteDB opens a handle whose transactions begin with txlock. One
+// connection is enough for a CLI and keeps each transaction on the
+// connection that holds the lock.
+func openSQLiteDB(path, txlock string) (*sql.DB, error) {
+	dsn := (&url.URL{
+		Scheme: "file",
+		Path:   path,
+		RawQuery: url.Values{
+			"_pragma": {fmt.Sprintf("busy_timeout(%d)", lockWait.Milliseconds())},
+			"_txlock": {txlock},
+		}.Encode(),
+	}).String()
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	return db, nil
+}
+
+// init checks the schema version, creating the schema in a new database and
+// upgrading older ones. The journal mode is stored in the database, so it is
+// only set once.
+func (s *SQLiteStore) init() error {
+	var version int
+	err := s.run(s.reader, func(tx *sql.Tx) error {
+		var err error
+		version, err = schemaVersionOf(tx)
+		return err
+	})
+	if err != nil || version == schemaVersion {
+		return err
+	}
+	if version == 0 {
+		if _, err := s.writer.Exec(`PRAGMA journal_mode = WAL`); err != nil {
+			return err
+		}
+	}
+	return s.run(s.writer, func(tx *sql.Tx) error {
+		if _, err := tx.Exec(schema); err != nil {
+			return err
+		}
+		// Another process may have upgraded the database in the meantime.
+		if version, err := schemaVersionOf(tx); err != nil || version == schemaVersion {
+			return err
+		}
+		return setMeta(tx, "version", schemaVersion)
+	})
+}
+
+func (s *SQLiteStore) View(fn func(Tx) error) error {
+	return s.run(s.reader, func(tx *sql.Tx) error {
+		return fn(sqliteTx{tx})
+	})
+}
+
+func (s *SQLiteStore) Update(fn func(Tx) error) error {
+	return s.run(s.writer, func(tx *sql.Tx) error {
+		return fn(sqliteTx{tx})
+	})
+}
+
+func (s *SQLiteStore) Close() error {
+	return errors.Join(s.reader.Close(), s.writer.Close())
+}
+
+// run calls fn in a transaction on db, and commits it if fn succeeds.
+// Committing a read transaction just ends it.
+func (s *SQLiteStore) run(db *sql.DB, fn func(*sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// schemaVersionOf returns the schema version of the database, 0 if it has
+// no schema yet, and refuses databases written by a newer build.
+func schemaVersionOf(tx *sql.Tx) (int, error) {
+	var tables int
+	if err := tx.QueryRow(`SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = 'meta'`).Scan(&tables); err != nil {
+		return 0, err
+	}
+	if tables == 0 {
+		return 0, nil
+	}
+	version, err := metaInt(tx, "version")
+	if err != nil {
+		return 0, err
+	}
+	if version > schemaVersion {
+		return 0, fmt.Errorf("%w (database version %d, supported %d)", ErrNewerVersion, version, schemaVersion)
+	}
+	return version, nil
+}
+
+func metaInt(tx *sql.Tx, key string) (int, error) {
+	var value string
+	err := tx.QueryRow(`SELECT value FROM meta WHERE key = ?`, key).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q in allocations database", key, value)
+	}
+	return n, nil
+}
+
+func setMeta(tx *sql.Tx, key string, value int) error {
+	_, err := tx.Exec(`INSERT INTO meta (key, value) VALUES (?, ?)
+		ON CONFLICT (key) DO UPDATE SET value = excluded.value`, key, strconv.Itoa(value))
+	return err
+}
+
+type sqliteTx struct {
+	tx *sql.Tx
+}
+
+func (t sqliteTx) Get(port int) (*Allocation, error) {
+	var data string
+	err := t.tx.QueryRow(`SELECT data FROM allocations WHERE port = ?`, port).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return decodeAllocation(data)
+}
+
+func (t sqliteTx) Set(port int, alloc *Allocation) error {
+	data, err := encodeAllocation(alloc)
+	if err != nil {
+		return err
+	}
+	_, err = t.tx.Exec(`INSERT INTO allocations (port, directory, name, data) VALUES (?, ?, ?, ?)
+		ON CONFLICT (port) DO UPDATE SET directory = excluded.directory, name = excluded.name, data = excluded.data`,
+		port, alloc.Directory, alloc.Name, data)
+	return err
+}
+
+func (t sqliteTx) Delete(port int) error {
+	_, err := t.tx.Exec(`DELETE FROM allocations WHERE port = ?`, port)
+	return err
+}
+
+func (t sqliteTx) Find(dir, name string) (int, *Allocation, error) {
+	records, err := t.Query(Query{Directory: dir, Name: name})
+	if err != nil || len(records) == 0 {
+		return 0, nil, err
+	}
+	return records[0].Port, records[0].Allocation, nil
+}
+
+func (t sqliteTx) Query(q Query) ([]Record, error) {
+	stmt := `SELECT port, data FROM allocations WHERE 1 = 1`
+	var args []any
+	if q.Directory != "" {
+		stmt += ` AND directory = ?`
+		args = append(args, q.Directory)
+	}
+	if q.Name != "" {
+		stmt += ` AND name = ?`
+		args = append(args, q.Name)
+	}
+	rows, err := t.tx.Query(stmt+` ORDER BY port`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Record
+	for rows.Next() {
+		var port int
+		var data string
+		if err := rows.Scan(&port, &data); err != nil {
+			return nil, err
+		}
+		alloc, err := decodeAllocation(data)
+		if err != nil {
+			return nil, fmt.Errorf("parse allocation for port %d: %w", port, err)
+		}
+		record := Record{Port: port, Allocation: alloc}
+		if q.Match == nil || q.Match(record) {
+			out = append(out, record)
+		}
+	}
+	return out, rows.Err()
+}
+
+func (t sqliteTx) LastIssuedPort() (int, error) {
+	return metaInt(t.tx, "last_issued_port")
+}
+
+func (t sqliteTx) SetLastIssuedPort(port int) error {
+	return setMeta(t.tx, "last_issued_port", port)
+}
@@ -0,0 +1,313 @@
+package allocations
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Store persists allocations. All access goes through transactions so that
+// concurrent portpls processes never see or write partial state.
+type Store interface {
+	// View runs fn in a read-only transaction.
+	View(fn func(Tx) error) error
+	// Update runs fn in a read-write transaction. Changes are committed
+	// only when fn returns nil.
+	Update(fn func(Tx) error) error
+	// Close releases the resources held by the store.
+	Close() error
+}
+
+// Tx is a transaction over the allocations in a Store. Allocations returned
+// from a Tx are copies; call Set to persist changes to them.
+type Tx interface {
+	// Get returns the allocation for port, or nil if there is none.
+	Get(port int) (*Allocation, error)
+	// Set creates or replaces the allocation for port.
+	Set(port int, alloc *Allocation) error
+	// Delete removes the allocation for port, if any.
+	Delete(port int) error
+	// Find returns the allocation for (dir, name), or nil if there is none.
+	Find(dir, name string) (int, *Allocation, error)
+	// Query returns the allocations matching q, ordered by port.
+	Query(q Query) ([]Record, error)
+	// LastIssuedPort returns the port most recently handed out.
+	LastIssuedPort() (int, error)
+	// SetLastIssuedPort records the port most recently handed out.
+	SetLastIssuedPort(port int) error
+}
+
+// Record is an allocation together with its port.
+type Record struct {
+	Port int
+	*Allocation
+}
+
+// Query selects allocations. Zero-value fields match everything.
+type Query struct {
+	Directory string
+	Name      string
+	// Match is an optional extra predicate applied after the other fields.
+	Match func(Record) bool
+}
+
+func (q Query) matches(r Record) bool {
+	if q.Directory != "" && r.Directory != q.Directory {
+		return false
+	}
+	if q.Name != "" && r.Name != q.Name {
+		return false
+	}
+	return q.Match == nil || q.Match(r)
+}
+
+// Open returns the store for path, choosing the backend from the file
+// extension: .db, .sqlite and .sqlite3 use SQLite, anything else the JSON
+// file.
+func Open(path string) (Store, error) {
+	if IsSQLitePath(path) {
+		return OpenSQLite(path)
+	}
+	return NewJSONStore(path), nil
+}
+
+// IsSQLitePath reports whether Open would use SQLite for path.
+func IsSQLitePath(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".db", ".sqlite", ".sqlite3":
+		return true
+	}
+	return false
+}
+
+// Copy replaces everything in dst with the contents of src and returns the
+// number of allocations copied.
+func Copy(dst, src Store) (int, error) {
+	var records []Record
+	var last int
+	err := src.View(func(tx Tx) error {
+		var err error
+		if records, err = tx.Query(Query{}); err != nil {
+			return err
+		}
+		last, err = tx.LastIssuedPort()
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	err = dst.Update(func(tx Tx) error {
+		existing, err := tx.Query(Query{})
+		if err != nil {
+			return err
+		}
+		for _, r := range existing {
+			if err := tx.Delete(r.Port); err != nil {
+				return err
+			}
+		}
+		for _, r := range records {
+			if err := tx.Set(r.Port, r.Allocation); err != nil {
+				return err
+			}
+		}
+		return tx.SetLastIssuedPort(last)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(records), nil
+}
+
+// JSONStore keeps allocations in the JSON allocations file, guarded by
+// OpenLocked. An Update that changes anything rewrites the whole file; one
+// that changes nothing leaves it alone, so watchers are not woken up.
+type JSONStore struct {
+	Path string
+}
+
+func NewJSONStore(path string) *JSONStore {
+	return &JSONStore{Path: path}
+}
+
+func (s *JSONStore) View(fn func(Tx) error) error {
+	lf, err := OpenLocked(s.Path, false)
+	if err != nil {
+		return err
+	}
+	defer lf.Close()
+	return fn(NewFileTx(lf.Data))
+}
+
+func (s *JSONStore) Update(fn func(Tx) error) error {
+	lf, err := OpenLocked(s.Path, true)
+	if err != nil {
+		return err
+	}
+	defer lf.Close()
+	tx := newFileTx(lf.Data)
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if !tx.dirty {
+		return nil
+	}
+	return lf.Save()
+}
+
+func (s *JSONStore) Close() error { return nil }
+
+// MemoryStore keeps allocations in memory. It is meant for tests.
+type MemoryStore struct {
+	mu   sync.Mutex
+	data *File
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{data: DefaultFile()}
+}
+
+func (s *MemoryStore) View(fn func(Tx) error) error {
+	s.mu.Lock()
+	snapshot := cloneFile(s.data)
+	s.mu.Unlock()
+	return fn(NewFileTx(snapshot))
+}
+
+func (s *MemoryStore) Update(fn func(Tx) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	working := cloneFile(s.data)
+	if err := fn(NewFileTx(working)); err != nil {
+		return err
+	}
+	s.data = working
+	return nil
+}
+
+func (s *MemoryStore) Close() error { return nil }
+
+// NewFileTx returns a Tx that reads and writes f directly. Committing or
+// discarding the changes is up to the caller.
+func NewFileTx(f *File) Tx {
+	return newFileTx(f)
+}
+
+func newFileTx(f *File) *fileTx {
+	if f.Allocations == nil {
+		f.Allocations = map[string]*Allocation{}
+	}
+	return &fileTx{f: f}
+}
+
+type fileTx struct {
+	f *File
+	// dirty reports whether any call changed f.
+	dirty bool
+}
+
+func (t *fileTx) Get(port int) (*Allocation, error) {
+	alloc, ok := t.f.Allocations[strconv.Itoa(port)]
+	if !ok {
+		return nil, nil
+	}
+	return cloneAllocation(alloc), nil
+}
+
+func (t *fileTx) Set(port int, alloc *Allocation) error {
+	key := strconv.Itoa(port)
+	if existing, ok := t.f.Allocations[key]; ok && reflect.DeepEqual(existing, alloc) {
+		return nil
+	}
+	t.f.Allocations[key] = cloneAllocation(alloc)
+	t.dirty = true
+	return nil
+}
+
+func (t *fileTx) Delete(port int) error {
+	key := strconv.Itoa(port)
+	if _, ok := t.f.Allocations[key]; !ok {
+		return nil
+	}
+	delete(t.f.Allocations, key)
+	t.dirty = true
+	return nil
+}
+
+func (t *fileTx) Find(dir, name string) (int, *Allocation, error) {
+	records, err := t.Query(Query{Directory: dir, Name: name})
+	if err != nil || len(records) == 0 {
+		return 0, nil, err
+	}
+	return records[0].Port, records[0].Allocation, nil
+}
+
+func (t *fileTx) Query(q Query) ([]Record, error) {
+	var out []Record
+	for portStr, alloc := range t.f.Allocations {
+		port, err := strconv.Atoi(portStr)
+		if err != nil {
+			continue
+		}
+		record := Record{Port: port, Allocation: cloneAllocation(alloc)}
+		if q.matches(record) {
+			out = append(out, record)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Port < out[j].Port })
+	return out, nil
+}
+
+func (t *fileTx) LastIssuedPort() (int, error) {
+	return t.f.LastIssuedPort, nil
+}
+
+func (t *fileTx) SetLastIssuedPort(port int) error {
+	if t.f.LastIssuedPort != port {
+		t.f.LastIssuedPort = port
+		t.dirty = true
+	}
+	return nil
+}
+
+func cloneAllocation(a *Allocation) *Allocation {
+	if a == nil {
+		return nil
+	}
+	out := *a
+	if a.Labels != nil {
+		out.Labels = make(map[string]string, len(a.Labels))
+		for k, v := range a.Labels {
+			out.Labels[k] = v
+		}
+	}
+	return &out
+}
+
+func cloneFile(f *File) *File {
+	out := *f
+	out.Allocations = make(map[string]*Allocation, len(f.Allocations))
+	for port, alloc := range f.Allocations {
+		out.Allocations[port] = cloneAllocation(alloc)
+	}
+	return &out
+}
+
+// encodeAllocation and decodeAllocation store the full allocation as JSON
+// in backends that index only some of its fields.
+func encodeAllocation(a *Allocation) (string, error) {
+	data, err := json.Marshal(a)
+	return string(data), err
+}
+
+func decodeAllocation(data string) (*Allocation, error) {
+	var a Allocation
+	if err := json.Unmarshal([]byte(data), &a); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
@@ -0,0 +1,380 @@
+package allocations
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testStores(t *testing.T) map[string]func(t *testing.T) Store {
+	return map[string]func(t *testing.T) Store{
+		"memory": func(t *testing.T) Store {
+			return NewMemoryStore()
+		},
+		"json": func(t *testing.T) Store {
+			return NewJSONStore(filepath.Join(t.TempDir(), "allocations.json"))
+		},
+		"sqlite": func(t *testing.T) Store {
+			s, err := OpenSQLite(filepath.Join(t.TempDir(), "allocations.db"))
+			if err != nil {
+				t.Fatalf("OpenSQLite: %v", err)
+			}
+			t.Cleanup(func() { s.Close() })
+			return s
+		},
+	}
+}
+
+func TestStore(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	for backend, open := range testStores(t) {
+		t.Run(backend, func(t *testing.T) {
+			t.Run("set, get and find", func(t *testing.T) {
+				s := open(t)
+				err := s.Update(func(tx Tx) error {
+					if err := tx.Set(20001, &Allocation{Directory: "/a", Name: "web", AssignedAt: now, LastUsedAt: now, Locked: true}); err != nil {
+						return err
+					}
+					return tx.SetLastIssuedPort(20001)
+				})
+				if err != nil {
+					t.Fatalf("Update: %v", err)
+				}
+
+				err = s.View(func(tx Tx) error {
+					alloc, err := tx.Get(20001)
+					if err != nil {
+						return err
+					}
+					if alloc == nil || alloc.Directory != "/a" || alloc.Name != "web" || !alloc.Locked || !alloc.AssignedAt.Equal(now) {
+						t.Errorf("Get(20001) = %+v", alloc)
+					}
+					if missing, err := tx.Get(20002); err != nil || missing != nil {
+						t.Errorf("Get(20002) = %+v, %v; want nil", missing, err)
+					}
+					port, found, err := tx.Find("/a", "web")
+					if err != nil {
+						return err
+					}
+					if port != 20001 || found == nil {
+						t.Errorf("Find = %d, %+v", port, found)
+					}
+					last, err := tx.LastIssuedPort()
+					if err != nil {
+						return err
+					}
+					if last != 20001 {
+						t.Errorf("LastIssuedPort = %d, want 20001", last)
+					}
+					return nil
+				})
+				if err != nil {
+					t.Fatalf("View: %v", err)
+				}
+			})
+
+			t.Run("query filters and sorts by port", func(t *testing.T) {
+				s := open(t)
+				err := s.Update(func(tx Tx) error {
+					for port, alloc := range map[int]*Allocation{
+						20003: {Directory: "/a", Name: "db"},
+						20001: {Directory: "/a", Name: "web"},
+						20002: {Directory: "/b", Name: "web"},
+					} {
+						if err := tx.Set(port, alloc); err != nil {
+							return err
+						}
+					}
+					return nil
+				})
+				if err != nil {
+					t.Fatalf("Update: %v", err)
+				}
+
+				tests := []struct {
+					name  string
+					query Query
+					want  []int
+				}{
+					{"all", Query{}, []int{20001, 20002, 20003}},
+					{"directory", Query{Directory: "/a"}, []int{20001, 20003}},
+					{"name", Query{Name: "web"}, []int{20001, 20002}},
+					{"match", Query{Match: func(r Record) bool { return r.Port > 20001 }}, []int{20002, 20003}},
+				}
+				for _, tt := range tests {
+					t.Run(tt.name, func(t *testing.T) {
+						var got []int
+						err := s.View(func(tx Tx) error {
+							records, err := tx.Query(tt.query)
+							for _, r := range records {
+								got = append(got, r.Port)
+							}
+							return err
+						})
+						if err != nil {
+							t.Fatalf("View: %v", err)
+						}
+						if len(got) != len(tt.want) {
+							t.Fatalf("ports = %v, want %v", got, tt.want)
+						}
+						for i := range got {
+							if got[i] != tt.want[i] {
+								t.Fatalf("ports = %v, want %v", got, tt.want)
+							}
+						}
+					})
+				}
+			})
+
+			t.Run("failed update is rolled back", func(t *testing.T) {
+				s := open(t)
+				_ = s.Update(func(tx Tx) error {
+					return tx.Set(20001, &Allocation{Directory: "/a", Name: "web"})
+				})
+				errBoom := errors.New("boom")
+				err := s.Update(func(tx Tx) error {
+					if err := tx.Delete(20001); err != nil {
+						return err
+					}
+					if err := tx.Set(20002, &Allocation{Directory: "/b", Name: "web"}); err != nil {
+						return err
+					}
+					return errBoom
+				})
+				if !errors.Is(err, errBoom) {
+					t.Fatalf("Update error = %v, want %v", err, errBoom)
+				}
+				_ = s.View(func(tx Tx) error {
+					records, _ := tx.Query(Query{})
+					if len(records) != 1 || records[0].Port != 20001 {
+						t.Errorf("records = %+v, want only 20001", records)
+					}
+					return nil
+				})
+			})
+
+			t.Run("returned allocations are copies", func(t *testing.T) {
+				s := open(t)
+				_ = s.Update(func(tx Tx) error {
+					if err := tx.Set(20001, &Allocation{Directory: "/a", Name: "web"}); err != nil {
+						return err
+					}
+					alloc, _ := tx.Get(20001)
+					alloc.Locked = true
+					return nil
+				})
+				_ = s.View(func(tx Tx) error {
+					alloc, _ := tx.Get(20001)
+					if alloc.Locked {
+						t.Error("modifying a returned allocation changed the store")
+					}
+					return nil
+				})
+			})
+		})
+	}
+}
+
+func TestOpen(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		path   string
+		sqlite bool
+	}{
+		{"allocations.json", false},
+		{"allocations", false},
+		{"allocations.db", true},
+		{"allocations.sqlite", true},
+		{"allocations.SQLITE3", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			s, err := Open(filepath.Join(dir, tt.path))
+			if err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+			defer s.Close()
+			_, isSQLite := s.(*SQLiteStore)
+			if isSQLite != tt.sqlite {
+				t.Errorf("Open(%q) = %T, want sqlite=%v", tt.path, s, tt.sqlite)
+			}
+		})
+	}
+}
+
+func TestCopy(t *testing.T) {
+	src := NewJSONStore(filepath.Join(t.TempDir(), "allocations.json"))
+	_ = src.Update(func(tx Tx) error {
+		_ = tx.Set(20001, &Allocation{Directory: "/a", Name: "web"})
+		_ = tx.Set(20002, &Allocation{Directory: "/b", Name: "api", Locked: true})
+		return tx.SetLastIssuedPort(20002)
+	})
+	dst, err := OpenSQLite(filepath.Join(t.TempDir(), "allocations.db"))
+	if err != nil {
+		t.Fatalf("OpenSQLite: %v", err)
+	}
+	defer dst.Close()
+	_ = dst.Update(func(tx Tx) error {
+		return tx.Set(20009, &Allocation{Directory: "/stale", Name: "main"})
+	})
+
+	n, err := Copy(dst, src)
+	if err != nil {
+		t.Fatalf("Copy: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("copied %d, want 2", n)
+	}
+	_ = dst.View(func(tx Tx) error {
+		records, _ := tx.Query(Query{})
+		if len(records) != 2 || records[0].Port != 20001 || records[1].Port != 20002 || !records[1].Locked {
+			t.Errorf("records = %+v", records)
+		}
+		if last, _ := tx.LastIssuedPort(); last != 20002 {
+			t.Errorf("LastIssuedPort = %d, want 20002", last)
+		}
+		return nil
+	})
+}
+
+func TestJSONStoreSkipsUnchangedUpdates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "allocations.json")
+	s := NewJSONStore(path)
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := s.Update(func(tx Tx) error {
+		if err := tx.Set(20001, &Allocation{Directory: "/a", Name: "web", AssignedAt: now, LastUsedAt: now}); err != nil {
+			return err
+		}
+		return tx.SetLastIssuedPort(20001)
+	}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	before, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+
+	err = s.Update(func(tx Tx) error {
+		alloc, err := tx.Get(20001)
+		if err != nil {
+			return err
+		}
+		if err := tx.Set(20001, alloc); err != nil {
+			return err
+		}
+		if err := tx.Delete(20002); err != nil {
+			return err
+		}
+		return tx.SetLastIssuedPort(20001)
+	})
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	after, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if !os.SameFile(before, after) {
+		t.Error("an update without changes rewrote the allocations file")
+	}
+
+	if err := s.Update(func(tx Tx) error { return tx.Delete(20001) }); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	after, err = os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if os.SameFile(before, after) {
+		t.Error("an update with changes did not rewrite the allocations file")
+	}
+}
+
+func TestSQLiteNewerVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "allocations.db")
+	s, err := OpenSQLite(path)
+	if err != nil {
+		t.Fatalf("OpenSQLite: %v", err)
+	}
+	_, err = s.writer.Exec(`UPDATE meta SET value = '99' WHERE key = 'version'`)
+	s.Close()
+	if err != nil {
+		t.Fatalf("bump version: %v", err)
+	}
+	if _, err := OpenSQLite(path); !errors.Is(err, ErrNewerVersion) {
+		t.Errorf("OpenSQLite error = %v, want ErrNewerVersion", err)
+	}
+}
+
+func TestSQLiteUpgradesOlderVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "allocations.db")
+	s, err := OpenSQLite(path)
+	if err != nil {
+		t.Fatalf("OpenSQLite: %v", err)
+	}
+	_, err = s.writer.Exec(`UPDATE meta SET value = '1' WHERE key = 'version'`)
+	s.Close()
+	if err != nil {
+		t.Fatalf("set version: %v", err)
+	}
+	s, err = OpenSQLite(path)
+	if err != nil {
+		t.Fatalf("OpenSQLite: %v", err)
+	}
+	defer s.Close()
+	var version int
+	if err := s.reader.QueryRow(`SELECT value FROM meta WHERE key = 'version'`).Scan(&version); err != nil {
+		t.Fatalf("read version: %v", err)
+	}
+	if version != schemaVersion {
+		t.Errorf("version = %d, want %d", version, schemaVersion)
+	}
+}
+
+func TestSQLiteViewDoesNotWaitForWriters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "allocations.db")
+	writer, err := OpenSQLite(path)
+	if err != nil {
+		t.Fatalf("OpenSQLite: %v", err)
+	}
+	defer writer.Close()
+	locked, release := make(chan struct{}), make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- writer.Update(func(tx Tx) error {
+			if err := tx.Set(20000, &Allocation{Directory: "/a", Name: "main"}); err != nil {
+				return err
+			}
+			close(locked)
+			<-release
+			return nil
+		})
+	}()
+	<-locked
+
+	reader, err := OpenSQLite(path)
+	if err != nil {
+		t.Fatalf("OpenSQLite while locked: %v", err)
+	}
+	defer reader.Close()
+	start := time.Now()
+	err = reader.View(func(tx Tx) error {
+		alloc, err := tx.Get(20000)
+		if alloc != nil {
+			t.Errorf("read uncommitted allocation %+v", alloc)
+		}
+		return err
+	})
+	if err != nil {
+		t.Errorf("View: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("View waited %v for the writer", elapsed)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+}
@@ -0,0 +1,50 @@
+package app
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/bamorim/portpls/internal/allocations"
+)
+
+// AllocationNames returns the names allocated in the selected directory,
+// for shell completion. Like Prompt, it never waits for or writes to
+// anything: a missing store has no names, and a store that is being written
+// returns none rather than blocking.
+func AllocationNames(opts Options) ([]string, error) {
+	snap, err := peek(opts, "")
+	if errors.Is(err, allocations.ErrBusy) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, r := range snap.records {
+		if r.Directory == snap.directory {
+			names = append(names, r.Name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// AllocatedDirectories returns every directory with an allocation, for shell
+// completion. It reads the store the same way as AllocationNames.
+func AllocatedDirectories(opts Options) ([]string, error) {
+	snap, err := peek(opts, "")
+	if errors.Is(err, allocations.ErrBusy) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var dirs []string
+	seen := map[string]bool{}
+	for _, r := range snap.records {
+		if !seen[r.Directory] {
+			seen[r.Directory] = true
+			dirs = append(dirs, r.Directory)
+		}
+	}
+	sort.Strings(dirs)
+	return dirs, nil
+}
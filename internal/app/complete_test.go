@@ -0,0 +1,77 @@
+package app
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCompletionQueries(t *testing.T) {
+	configPath, allocPath, dir := setupTestEnv(t)
+	writeConfig(t, configPath, 20000, 20010)
+	other := filepath.Join(dir, "other")
+	opts := func(directory string) Options {
+		return Options{
+			ConfigPath:      configPath,
+			AllocationsPath: allocPath,
+			Directory:       SpecificDirectory{Path: directory},
+			PortChecker:     mockChecker{},
+		}
+	}
+	for _, alloc := range []struct{ dir, name string }{{dir, "web"}, {dir, "api"}, {other, "main"}} {
+		if _, err := GetPort(opts(alloc.dir), alloc.name, Metadata{}); err != nil {
+			t.Fatalf("GetPort: %v", err)
+		}
+	}
+
+	names, err := AllocationNames(opts(dir))
+	if err != nil || !reflect.DeepEqual(names, []string{"api", "web"}) {
+		t.Errorf("AllocationNames = %v, %v", names, err)
+	}
+	dirs, err := AllocatedDirectories(opts(dir))
+	if err != nil || !reflect.DeepEqual(dirs, []string{dir, other}) {
+		t.Errorf("AllocatedDirectories = %v, %v", dirs, err)
+	}
+}
+
+func TestCompletionQueriesWriteNothing(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, "xdg-config"))
+	t.Setenv("XDG_DATA_HOME", filepath.Join(home, "xdg-data"))
+	t.Setenv(EnvConfigPath, "")
+	t.Setenv(EnvAllocationsPath, "")
+	legacy := []string{legacyConfigPath(), legacyAllocationsPath()}
+	for _, path := range legacy {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create legacy dir: %v", err)
+		}
+	}
+	if err := os.WriteFile(legacy[0], []byte(`{"port_start": 20000, "port_end": 20010}`), 0644); err != nil {
+		t.Fatalf("failed to write legacy config: %v", err)
+	}
+	if err := os.WriteFile(legacy[1], []byte(`{"version": 2, "allocations": {}}`), 0644); err != nil {
+		t.Fatalf("failed to write legacy allocations: %v", err)
+	}
+	opts := Options{Directory: SpecificDirectory{Path: home}}
+
+	if names, err := AllocationNames(opts); err != nil || len(names) != 0 {
+		t.Errorf("AllocationNames = %v, %v", names, err)
+	}
+	if dirs, err := AllocatedDirectories(opts); err != nil || len(dirs) != 0 {
+		t.Errorf("AllocatedDirectories = %v, %v", dirs, err)
+	}
+
+	for _, path := range legacy {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("legacy file %s was moved: %v", path, err)
+		}
+	}
+	for _, dir := range []string{"xdg-config", "xdg-data"} {
+		if _, err := os.Stat(filepath.Join(home, dir)); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s was created", dir)
+		}
+	}
+}
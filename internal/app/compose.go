@@ -0,0 +1,145 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/bamorim/portpls/internal/compose"
+)
+
+// ComposeOptions configures Compose.
+type ComposeOptions struct {
+	File   string // compose file; empty looks for one in the selected directory
+	Output string // override file; empty uses the one compose loads by default
+	Check  bool   // compare the override file with the allocations instead of writing it
+	Force  bool   // replace an override file that portpls didn't write
+}
+
+// ComposeService is a service in the override file and the ports it
+// publishes there.
+type ComposeService struct {
+	Name  string
+	Ports []string
+}
+
+// ComposeResult describes the override file Compose wrote or checked.
+type ComposeResult struct {
+	File     string // compose file read
+	Output   string // override file
+	Project  string // compose project name
+	Services []ComposeService
+	Drift    []string // what a check found out of date; empty when up to date
+}
+
+// Compose allocates a port for every port each service in the compose file
+// publishes and writes an override file that publishes the allocated ports
+// instead, with a project name unique to the directory. The first port of a
+// service uses the allocation named by its x-portpls extension, or the
+// service name; further ports add the container port, e.g. web-9229.
+// Existing allocations are kept even while their port is busy, since the
+// holder is usually this project's own containers. Port ranges are copied
+// unchanged.
+//
+// With Check nothing is allocated or written. Drift lists missing
+// allocations and differences between the override file and the one
+// Compose would write.
+func Compose(opts Options, c ComposeOptions) (ComposeResult, error) {
+	directory, err := opts.Directory.ResolveDirectory()
+	if err != nil {
+		return ComposeResult{}, err
+	}
+	result := ComposeResult{File: c.File, Output: c.Output, Project: compose.ProjectName(directory)}
+	if result.File == "" {
+		if result.File, err = compose.Find(directory); err != nil {
+			return ComposeResult{}, NewCodeError(1, err)
+		}
+	}
+	if result.Output == "" {
+		result.Output = compose.OverridePath(result.File)
+	}
+	data, err := os.ReadFile(result.File)
+	if err != nil {
+		return ComposeResult{}, err
+	}
+	services, err := compose.Parse(data)
+	if err != nil {
+		return ComposeResult{}, NewCodeError(2, fmt.Errorf("%s: %w", result.File, err))
+	}
+
+	want := compose.Override{Project: result.Project, Services: map[string][]string{}}
+	err = withContext(opts, !c.Check, func(ctx *context) error {
+		now := time.Now().UTC()
+		for _, svc := range services {
+			var ports []string
+			for i, p := range svc.Ports {
+				if p.IsRange() {
+					ports = append(ports, p.String())
+					continue
+				}
+				name := svc.Allocation
+				if i > 0 {
+					name = fmt.Sprintf("%s-%s", svc.Allocation, p.Target)
+				}
+				portNum, err := composePort(ctx, name, c.Check, now)
+				if err != nil {
+					return err
+				}
+				if portNum == 0 {
+					result.Drift = append(result.Drift, fmt.Sprintf("service %s has no port allocated as %s", svc.Name, name))
+					continue
+				}
+				p.Published = strconv.Itoa(portNum)
+				ports = append(ports, p.String())
+			}
+			want.Services[svc.Name] = ports
+			result.Services = append(result.Services, ComposeService{Name: svc.Name, Ports: ports})
+		}
+		return nil
+	})
+	if err != nil {
+		if err == ErrNoFreePorts {
+			return ComposeResult{}, NewCodeError(1, err)
+		}
+		return ComposeResult{}, err
+	}
+
+	existing, err := os.ReadFile(result.Output)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return ComposeResult{}, err
+	}
+	if c.Check {
+		if existing == nil {
+			result.Drift = append(result.Drift, fmt.Sprintf("%s does not exist", result.Output))
+			return result, nil
+		}
+		have, err := compose.ParseOverride(existing)
+		if err != nil {
+			return ComposeResult{}, NewCodeError(2, fmt.Errorf("%s: %w", result.Output, err))
+		}
+		result.Drift = append(result.Drift, compose.Diff(have, want)...)
+		return result, nil
+	}
+	if existing != nil && !compose.IsGenerated(existing) && !c.Force {
+		return ComposeResult{}, NewCodeError(1, fmt.Errorf("%w: %s (use --force to replace it)", ErrOverrideExists, result.Output))
+	}
+	return result, compose.WriteFile(result.Output, want.Render(result.File))
+}
+
+// composePort returns the port allocated as name in the context's
+// directory, allocating one unless check is set. It returns 0 when checking
+// and there is no allocation.
+func composePort(ctx *context, name string, check bool, now time.Time) (int, error) {
+	if check {
+		portNum, _, err := ctx.tx.Find(ctx.directory, name)
+		return portNum, err
+	}
+	portNum, alloc, err := allocate(ctx, name, now)
+	if err != nil {
+		return 0, err
+	}
+	alloc.LastUsedAt = now
+	return portNum, ctx.tx.Set(portNum, alloc)
+}
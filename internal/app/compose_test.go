@@ -0,0 +1,113 @@
+package app
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompose(t *testing.T) {
+	configPath, allocPath, dir := setupTestEnv(t)
+	writeConfig(t, configPath, 20000, 20010)
+	opts := Options{
+		ConfigPath:      configPath,
+		AllocationsPath: allocPath,
+		Directory:       SpecificDirectory{Path: dir},
+		PortChecker:     mockChecker{},
+	}
+	composeFile := filepath.Join(dir, "compose.yaml")
+	write := func(t *testing.T, path, content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	write(t, composeFile, `
+services:
+  web:
+    ports: ["8080:80", "9229"]
+  api:
+    x-portpls: main
+    ports: ["127.0.0.1:4000:4000"]
+  metrics:
+    ports: ["9000-9002:9000-9002"]
+`)
+	override := filepath.Join(dir, "compose.override.yaml")
+
+	t.Run("check before the first run", func(t *testing.T) {
+		result, err := Compose(opts, ComposeOptions{Check: true})
+		if err != nil {
+			t.Fatalf("Compose: %v", err)
+		}
+		if len(result.Drift) != 4 || !strings.Contains(result.Drift[0], "no port allocated as main") {
+			t.Errorf("Drift = %q", result.Drift)
+		}
+		if _, err := os.Stat(override); !errors.Is(err, os.ErrNotExist) {
+			t.Error("check wrote the override file")
+		}
+	})
+
+	t.Run("allocates and writes the override", func(t *testing.T) {
+		result, err := Compose(opts, ComposeOptions{})
+		if err != nil {
+			t.Fatalf("Compose: %v", err)
+		}
+		want := []ComposeService{
+			{Name: "api", Ports: []string{"127.0.0.1:20000:4000"}},
+			{Name: "metrics", Ports: []string{"9000-9002:9000-9002"}},
+			{Name: "web", Ports: []string{"20001:80", "20002:9229"}},
+		}
+		if result.Output != override || !reflect.DeepEqual(result.Services, want) {
+			t.Errorf("Compose = %+v, want services %+v", result, want)
+		}
+		port, err := GetPort(opts, "web-9229", Metadata{})
+		if err != nil || port != 20002 {
+			t.Errorf("web-9229 allocation = %d, %v", port, err)
+		}
+		data, _ := os.ReadFile(override)
+		if !strings.Contains(string(data), "name: \""+result.Project+"\"") {
+			t.Errorf("override =\n%s", data)
+		}
+	})
+
+	t.Run("check after writing", func(t *testing.T) {
+		result, err := Compose(opts, ComposeOptions{Check: true})
+		if err != nil || len(result.Drift) != 0 {
+			t.Errorf("Compose = %q, %v; want no drift", result.Drift, err)
+		}
+	})
+
+	t.Run("check reports a forgotten allocation", func(t *testing.T) {
+		filter, _ := FilterByDirectory(dir)
+		if _, err := Forget(opts, filter, nil, "web", true, false, nil); err != nil {
+			t.Fatalf("Forget: %v", err)
+		}
+		result, err := Compose(opts, ComposeOptions{Check: true})
+		if err != nil || len(result.Drift) != 2 {
+			t.Errorf("Compose = %q, %v; want the missing allocation and the changed ports", result.Drift, err)
+		}
+	})
+
+	t.Run("keeps hand-written overrides", func(t *testing.T) {
+		write(t, override, "services: {}\n")
+		if _, err := Compose(opts, ComposeOptions{}); !errors.Is(err, ErrOverrideExists) {
+			t.Errorf("Compose error = %v, want ErrOverrideExists", err)
+		}
+		if _, err := Compose(opts, ComposeOptions{Force: true}); err != nil {
+			t.Errorf("Compose --force: %v", err)
+		}
+	})
+
+	t.Run("no compose file", func(t *testing.T) {
+		empty := opts
+		empty.Directory = SpecificDirectory{Path: t.TempDir()}
+		_, err := Compose(empty, ComposeOptions{})
+		var codeErr CodeError
+		if !errors.As(err, &codeErr) || codeErr.Code != 1 {
+			t.Errorf("Compose error = %v, want code 1", err)
+		}
+	})
+}
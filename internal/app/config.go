@@ -1,99 +1,193 @@
 package app
 
 import (
+	"errors"
 	"fmt"
-	"strconv"
+	"os"
+	"path/filepath"
 
 	"github.com/bamorim/portpls/internal/config"
 )
 
-func ConfigShow(opts Options) ([]string, error) {
-	cfg, err := config.Load(resolveOptions(opts).ConfigPath)
+// ConfigEntry is the effective value of one configuration key.
+type ConfigEntry struct {
+	Key    string
+	Value  any    // typed value, as returned by config.Key.Get
+	Text   string // value in its command-line form
+	Origin string // config.OriginDefault, a file path, an env var or a flag
+}
+
+// ConfigEntries returns the effective configuration for the selected
+// directory, one entry per registered key.
+func ConfigEntries(opts Options) ([]ConfigEntry, error) {
+	layered, err := loadConfig(opts)
 	if err != nil {
 		return nil, err
 	}
-	lines := []string{
-		fmt.Sprintf("port_start: %d", cfg.PortStart),
-		fmt.Sprintf("port_end: %d", cfg.PortEnd),
-		fmt.Sprintf("freeze_period: %s", cfg.FreezePeriod),
-		fmt.Sprintf("allocation_ttl: %s", cfg.AllocationTTL),
+	keys := config.AllKeys()
+	entries := make([]ConfigEntry, 0, len(keys))
+	for _, key := range keys {
+		entries = append(entries, ConfigEntry{
+			Key:    key.Name,
+			Value:  key.Get(layered.Config),
+			Text:   key.Format(layered.Config),
+			Origin: layered.Origin(key.Name),
+		})
+	}
+	return entries, nil
+}
+
+// ConfigShow returns one "key: value" line per configuration key, reflecting
+// the effective configuration for the selected directory. With showOrigin
+// each line also names the file the value came from.
+func ConfigShow(opts Options, showOrigin bool) ([]string, error) {
+	entries, err := ConfigEntries(opts)
+	if err != nil {
+		return nil, err
 	}
-	if cfg.LogFile != "" {
-		lines = append(lines, fmt.Sprintf("log_file: %s", cfg.LogFile))
-	} else {
-		lines = append(lines, "log_file: ")
+	lines := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		line := fmt.Sprintf("%s: %s", entry.Key, entry.Text)
+		if showOrigin {
+			line = fmt.Sprintf("%s\t(%s)", line, entry.Origin)
+		}
+		lines = append(lines, line)
 	}
 	return lines, nil
 }
 
 func ConfigGet(opts Options, key string) (string, error) {
-	cfg, err := config.Load(resolveOptions(opts).ConfigPath)
+	k, err := lookupConfigKey(key)
 	if err != nil {
 		return "", err
 	}
-	switch key {
-	case "port_start":
-		return fmt.Sprintf("%d", cfg.PortStart), nil
-	case "port_end":
-		return fmt.Sprintf("%d", cfg.PortEnd), nil
-	case "freeze_period":
-		return cfg.FreezePeriod, nil
-	case "allocation_ttl":
-		return cfg.AllocationTTL, nil
-	case "log_file":
-		return cfg.LogFile, nil
-	default:
-		return "", NewCodeError(1, ErrInvalidConfigKey)
+	layered, err := loadConfig(opts)
+	if err != nil {
+		return "", err
 	}
+	return k.Format(layered.Config), nil
 }
 
 func ConfigSet(opts Options, key, value string) (string, error) {
+	if _, err := lookupConfigKey(key); err != nil {
+		return "", err
+	}
+	if err := config.SetValue(resolveOptions(opts).ConfigPath, key, value); err != nil {
+		return "", NewCodeError(1, fmt.Errorf("%w: %v", ErrInvalidConfigValue, err))
+	}
+	return fmt.Sprintf("Set %s to %s", key, value), nil
+}
+
+// ConfigUnset removes key from the global config file so it falls back to
+// its default.
+func ConfigUnset(opts Options, key string) (string, error) {
+	k, err := lookupConfigKey(key)
+	if err != nil {
+		return "", err
+	}
+	if err := config.UnsetValue(resolveOptions(opts).ConfigPath, key); err != nil {
+		return "", NewCodeError(1, fmt.Errorf("%w: %v", ErrInvalidConfigValue, err))
+	}
+	return fmt.Sprintf("Unset %s (default: %s)", key, displayDefault(k)), nil
+}
+
+// ConfigReset overwrites the global config file with the defaults. The
+// storage key is kept: resetting it would switch to a different, possibly
+// empty, allocations file. Use MigrateStore to change the backend instead.
+func ConfigReset(opts Options) (string, error) {
+	if err := config.Reset(resolveOptions(opts).ConfigPath, "storage"); err != nil {
+		return "", err
+	}
+	return "Reset configuration to defaults, keeping storage", nil
+}
+
+// ConfigDescribe returns a human-readable description of key.
+func ConfigDescribe(key string) ([]string, error) {
+	k, err := lookupConfigKey(key)
+	if err != nil {
+		return nil, err
+	}
+	project := "no"
+	if k.Project {
+		project = "yes"
+	}
+	return []string{
+		fmt.Sprintf("%s (%s)", k.Name, k.Type),
+		fmt.Sprintf("  %s", k.Description),
+		fmt.Sprintf("  format:   %s", k.Type.Syntax()),
+		fmt.Sprintf("  default:  %s", displayDefault(k)),
+		fmt.Sprintf("  project:  %s", project),
+		fmt.Sprintf("  env:      %s", config.EnvName(k.Name)),
+		fmt.Sprintf("  flag:     --%s", config.FlagName(k.Name)),
+	}, nil
+}
+
+// ConfigEdit lets the user edit a copy of the global config file. edit is
+// called with the path of the copy; the result is validated before it
+// replaces the real file. When validation fails, retry decides whether to
+// edit again or give up, leaving the config untouched. If the config file
+// changes while the editor is open, the edit is rejected rather than
+// overwriting the other change.
+func ConfigEdit(opts Options, edit func(path string) error, retry func(error) bool) (string, error) {
 	cfgPath := resolveOptions(opts).ConfigPath
-	cfg, err := config.Load(cfgPath)
+	if _, err := os.Stat(cfgPath); errors.Is(err, os.ErrNotExist) {
+		if err := config.Save(cfgPath, config.Default()); err != nil {
+			return "", err
+		}
+	}
+	original, err := os.ReadFile(cfgPath)
 	if err != nil {
 		return "", err
 	}
-	updated, err := setConfigValue(cfg, key, value)
+
+	tmp, err := os.CreateTemp("", "portpls-config-*.json")
 	if err != nil {
-		return "", NewCodeError(1, err)
+		return "", err
 	}
-	if err := config.Save(cfgPath, updated); err != nil {
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(original); err != nil {
+		_ = tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
 		return "", err
 	}
-	return fmt.Sprintf("Set %s to %s", key, value), nil
-}
 
-func setConfigValue(cfg config.Config, key, value string) (config.Config, error) {
-	switch key {
-	case "port_start":
-		val, err := strconv.Atoi(value)
-		if err != nil {
-			return cfg, ErrInvalidConfigValue
+	for {
+		if err := edit(tmp.Name()); err != nil {
+			return "", fmt.Errorf("run editor: %w", err)
 		}
-		cfg.PortStart = val
-	case "port_end":
-		val, err := strconv.Atoi(value)
+		edited, err := os.ReadFile(tmp.Name())
 		if err != nil {
-			return cfg, ErrInvalidConfigValue
+			return "", err
+		}
+		if string(edited) == string(original) {
+			return "Configuration unchanged", nil
 		}
-		cfg.PortEnd = val
-	case "freeze_period":
-		if _, err := config.ParseDuration(value); err != nil {
-			return cfg, ErrInvalidConfigValue
+		if _, err := config.Parse(edited); err != nil {
+			if retry != nil && retry(err) {
+				continue
+			}
+			return "", NewCodeError(1, fmt.Errorf("%w: %v", ErrInvalidConfigValue, err))
 		}
-		cfg.FreezePeriod = value
-	case "allocation_ttl":
-		if _, err := config.ParseDuration(value); err != nil {
-			return cfg, ErrInvalidConfigValue
+		if err := config.WriteFile(cfgPath, edited, config.Hash(original)); err != nil {
+			return "", err
 		}
-		cfg.AllocationTTL = value
-	case "log_file":
-		cfg.LogFile = value
-	default:
-		return cfg, ErrInvalidConfigKey
+		return fmt.Sprintf("Saved %s", filepath.Clean(cfgPath)), nil
 	}
-	if err := cfg.Validate(); err != nil {
-		return cfg, err
+}
+
+func displayDefault(k config.Key) string {
+	if def := k.Default(); def != "" {
+		return def
+	}
+	return "(empty)"
+}
+
+func lookupConfigKey(key string) (config.Key, error) {
+	k, err := config.Lookup(key)
+	if err != nil {
+		return config.Key{}, NewCodeError(1, fmt.Errorf("%w: %s", ErrInvalidConfigKey, key))
 	}
-	return cfg, nil
+	return k, nil
 }
@@ -0,0 +1,150 @@
+package app
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigSetAndUnset(t *testing.T) {
+	configPath, _, dir := setupTestEnv(t)
+	writeConfig(t, configPath, 20000, 20010)
+	opts := Options{ConfigPath: configPath, Directory: SpecificDirectory{Path: dir}}
+
+	if _, err := ConfigSet(opts, "port_end", "20020"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	value, err := ConfigGet(opts, "port_end")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if value != "20020" {
+		t.Errorf("port_end = %q, want 20020", value)
+	}
+
+	if _, err := ConfigUnset(opts, "port_end"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	value, _ = ConfigGet(opts, "port_end")
+	if value != "22000" {
+		t.Errorf("port_end after unset = %q, want default 22000", value)
+	}
+
+	_, err = ConfigSet(opts, "nope", "1")
+	var codeErr CodeError
+	if !errors.As(err, &codeErr) || codeErr.Code != 1 || !errors.Is(err, ErrInvalidConfigKey) {
+		t.Errorf("ConfigSet(nope) error = %v, want code 1 ErrInvalidConfigKey", err)
+	}
+}
+
+func TestConfigShowOrigin(t *testing.T) {
+	configPath, _, dir := setupTestEnv(t)
+	writeConfig(t, configPath, 20000, 20010)
+	projectConfig := filepath.Join(dir, ".portpls", "config.json")
+	if err := os.MkdirAll(filepath.Dir(projectConfig), 0755); err != nil {
+		t.Fatalf("failed to create project config dir: %v", err)
+	}
+	if err := os.WriteFile(projectConfig, []byte(`{"port_start": 20005}`), 0644); err != nil {
+		t.Fatalf("failed to write project config: %v", err)
+	}
+
+	lines, err := ConfigShow(Options{ConfigPath: configPath, Directory: SpecificDirectory{Path: dir}}, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := "port_start: 20005\t(" + projectConfig + ")"; lines[0] != want {
+		t.Errorf("lines[0] = %q, want %q", lines[0], want)
+	}
+}
+
+func TestConfigResetKeepsStorage(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("HOME", tmpDir)
+	t.Setenv("XDG_DATA_HOME", filepath.Join(tmpDir, "data"))
+	configPath := filepath.Join(tmpDir, "config.json")
+	if err := os.WriteFile(configPath, []byte(`{"port_end": 20010, "storage": "sqlite"}`), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	opts := Options{ConfigPath: configPath}
+
+	before, err := ResolveStorePath(opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := ConfigReset(opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	after, err := ResolveStorePath(opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if after != before {
+		t.Errorf("store path after reset = %q, want %q", after, before)
+	}
+	if value, _ := ConfigGet(opts, "storage"); value != "sqlite" {
+		t.Errorf("storage = %q, want sqlite", value)
+	}
+	if value, _ := ConfigGet(opts, "port_end"); value != "22000" {
+		t.Errorf("port_end = %q, want default 22000", value)
+	}
+}
+
+func TestConfigEdit(t *testing.T) {
+	t.Run("saves valid edits", func(t *testing.T) {
+		configPath, _, _ := setupTestEnv(t)
+		writeConfig(t, configPath, 20000, 20010)
+
+		edit := func(path string) error {
+			return os.WriteFile(path, []byte(`{"port_start": 21000, "port_end": 21010}`), 0644)
+		}
+		if _, err := ConfigEdit(Options{ConfigPath: configPath}, edit, nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		value, _ := ConfigGet(Options{ConfigPath: configPath}, "port_start")
+		if value != "21000" {
+			t.Errorf("port_start = %q, want 21000", value)
+		}
+	})
+
+	t.Run("re-edits until valid", func(t *testing.T) {
+		configPath, _, _ := setupTestEnv(t)
+		writeConfig(t, configPath, 20000, 20010)
+
+		attempts := 0
+		edit := func(path string) error {
+			attempts++
+			content := `{"port_start": "oops"}`
+			if attempts > 1 {
+				content = `{"port_start": 20001, "port_end": 20010}`
+			}
+			return os.WriteFile(path, []byte(content), 0644)
+		}
+		retry := func(error) bool { return true }
+		if _, err := ConfigEdit(Options{ConfigPath: configPath}, edit, retry); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if attempts != 2 {
+			t.Errorf("attempts = %d, want 2", attempts)
+		}
+	})
+
+	t.Run("leaves config untouched when giving up", func(t *testing.T) {
+		configPath, _, _ := setupTestEnv(t)
+		writeConfig(t, configPath, 20000, 20010)
+		before, _ := os.ReadFile(configPath)
+
+		edit := func(path string) error {
+			return os.WriteFile(path, []byte(`{not json`), 0644)
+		}
+		_, err := ConfigEdit(Options{ConfigPath: configPath}, edit, func(error) bool { return false })
+		if err == nil || !strings.Contains(err.Error(), "parse config") {
+			t.Errorf("error = %v, want parse error", err)
+		}
+		after, _ := os.ReadFile(configPath)
+		if string(after) != string(before) {
+			t.Errorf("config changed: %s", after)
+		}
+	})
+}
@@ -2,7 +2,7 @@ package app
 
 import (
 	"fmt"
-	"strconv"
+	"os"
 	"time"
 
 	"github.com/bamorim/portpls/internal/allocations"
@@ -16,12 +16,21 @@ type Options struct {
 	AllocationsPath string
 	Directory       DirectorySelector // resolves to one directory
 	Verbose         bool
-	PortChecker     port.Checker // optional, defaults to TCPChecker
+	PortChecker     port.Checker      // optional, defaults to TCPChecker
+	ConfigOverrides config.Overrides  // config values set by flags
+	NoCreate        bool              // don't create a missing config file
+	Store           allocations.Store // optional, overrides AllocationsPath
 }
 
+// Environment variables that provide defaults for the file path options.
+const (
+	EnvConfigPath      = "PORTPLS_CONFIG"
+	EnvAllocationsPath = "PORTPLS_ALLOCATIONS"
+)
+
 type context struct {
 	config      config.Config
-	allocFile   *allocations.LockedFile
+	tx          allocations.Tx
 	logger      logger.Logger
 	directory   string
 	portChecker port.Checker
@@ -29,49 +38,132 @@ type context struct {
 
 func withContext(opts Options, exclusive bool, fn func(*context) error) error {
 	resolved := resolveOptions(opts)
-	cfg, err := config.Load(resolved.ConfigPath)
+	directory, err := opts.Directory.ResolveDirectory()
+	if err != nil {
+		return err
+	}
+	layered, err := loadLayered(resolved, directory)
 	if err != nil {
 		return err
 	}
-	allocFile, err := allocations.OpenLocked(resolved.AllocationsPath, exclusive)
+	cfg := layered.Config
+	store, err := openStore(opts, cfg)
 	if err != nil {
 		return err
 	}
-	defer allocFile.Close()
-	log := logger.Logger{Path: cfg.LogFile, Verbose: resolved.Verbose}
+	if opts.Store == nil {
+		defer store.Close()
+	}
+	log := logger.Logger{Path: ResolveLogPath(cfg.LogFile), Verbose: resolved.Verbose}
 	checker := opts.PortChecker
 	if checker == nil {
 		checker = port.TCPChecker{}
 	}
-	ctx := &context{config: cfg, allocFile: allocFile, logger: log, portChecker: checker}
-	ctx.directory, err = opts.Directory.ResolveDirectory()
-	if err != nil {
-		return err
+	run := store.View
+	if exclusive {
+		run = store.Update
 	}
-	changed, err := applyTTL(ctx)
-	if err != nil {
-		return err
-	}
-	if changed {
-		if err := ctx.allocFile.Save(); err != nil {
-			return err
+	return run(func(tx allocations.Tx) error {
+		ctx := &context{config: cfg, tx: tx, logger: log, directory: directory, portChecker: checker}
+		if exclusive {
+			if _, err := applyTTL(ctx); err != nil {
+				return err
+			}
 		}
+		return fn(ctx)
+	})
+}
+
+// openStore returns opts.Store if set, and otherwise opens the allocations
+// store at StorePath.
+func openStore(opts Options, cfg config.Config) (allocations.Store, error) {
+	if opts.Store != nil {
+		return opts.Store, nil
 	}
-	return fn(ctx)
+	return allocations.Open(StorePath(opts, cfg))
 }
 
+// StorePath returns the allocations path in use. An explicit path wins and
+// picks its backend by extension; otherwise the storage key chooses between
+// the default JSON file and the default SQLite database. Legacy files are
+// not migrated here; that happens when the configuration is loaded.
+func StorePath(opts Options, cfg config.Config) string {
+	if cfg.Storage == config.StorageSQLite && opts.AllocationsPath == "" && os.Getenv(EnvAllocationsPath) == "" {
+		return DefaultSQLitePath()
+	}
+	return resolvePaths(opts, false).AllocationsPath
+}
+
+// ResolveStorePath returns StorePath for the configuration that applies to
+// opts.
+func ResolveStorePath(opts Options) (string, error) {
+	layered, err := loadConfig(opts)
+	if err != nil {
+		return "", err
+	}
+	return StorePath(opts, layered.Config), nil
+}
+
+// resolveOptions fills in the file paths, preferring explicit options over
+// the PORTPLS_CONFIG and PORTPLS_ALLOCATIONS environment variables over the
+// XDG default locations. Files at the default locations are migrated from
+// their pre-XDG paths the first time they are resolved.
 func resolveOptions(opts Options) Options {
+	return resolvePaths(opts, true)
+}
+
+// resolvePaths fills in the file paths like resolveOptions, migrating legacy
+// files only when migrate is set. Callers that must never write, like
+// prompts and shell completion, leave them where they are.
+func resolvePaths(opts Options, migrate bool) Options {
+	if opts.ConfigPath == "" {
+		opts.ConfigPath = os.Getenv(EnvConfigPath)
+	}
 	if opts.ConfigPath == "" {
 		opts.ConfigPath = DefaultConfigPath()
+		if migrate {
+			// Best effort: on failure the defaults are recreated at the new path.
+			_ = migrateLegacyFile(legacyConfigPath(), opts.ConfigPath)
+		}
+	}
+	if opts.AllocationsPath == "" {
+		opts.AllocationsPath = os.Getenv(EnvAllocationsPath)
 	}
 	if opts.AllocationsPath == "" {
 		opts.AllocationsPath = DefaultAllocationsPath()
+		if migrate {
+			_ = migrateLegacyFile(legacyAllocationsPath(), opts.AllocationsPath)
+		}
 	}
 	opts.ConfigPath = config.ExpandPath(opts.ConfigPath)
 	opts.AllocationsPath = config.ExpandPath(opts.AllocationsPath)
 	return opts
 }
 
+// loadConfig loads the effective configuration for the directory selected by
+// opts, layering any project config over the global one. Without a directory
+// selector only the global config applies.
+func loadConfig(opts Options) (config.Layered, error) {
+	resolved := resolveOptions(opts)
+	directory := ""
+	if opts.Directory != nil {
+		dir, err := opts.Directory.ResolveDirectory()
+		if err != nil {
+			return config.Layered{}, err
+		}
+		directory = dir
+	}
+	return loadLayered(resolved, directory)
+}
+
+func loadLayered(resolved Options, directory string) (config.Layered, error) {
+	return config.LoadLayered(resolved.ConfigPath, directory, config.LoadOptions{
+		NoCreate: resolved.NoCreate,
+		Env:      config.EnvOverrides(os.LookupEnv),
+		Flags:    resolved.ConfigOverrides,
+	})
+}
+
 func applyTTL(ctx *context) (bool, error) {
 	if ctx == nil {
 		return false, nil
@@ -81,14 +173,17 @@ func applyTTL(ctx *context) (bool, error) {
 		return false, nil
 	}
 	now := time.Now().UTC()
-	changed := false
-	for portStr, alloc := range ctx.allocFile.Data.Allocations {
-		if alloc.LastUsedAt.Add(ttl).Before(now) {
-			portNum, _ := strconv.Atoi(portStr)
-			delete(ctx.allocFile.Data.Allocations, portStr)
-			_ = ctx.logger.Event("ALLOC_EXPIRE", fmt.Sprintf("port=%d dir=%s name=%s ttl=%s", portNum, alloc.Directory, alloc.Name, ctx.config.AllocationTTL))
-			changed = true
+	expired, err := ctx.tx.Query(allocations.Query{Match: func(r allocations.Record) bool {
+		return r.LastUsedAt.Add(ttl).Before(now)
+	}})
+	if err != nil {
+		return false, err
+	}
+	for _, r := range expired {
+		if err := ctx.tx.Delete(r.Port); err != nil {
+			return false, err
 		}
+		_ = ctx.logger.Event("ALLOC_EXPIRE", fmt.Sprintf("port=%d dir=%s name=%s ttl=%s", r.Port, r.Directory, r.Name, ctx.config.AllocationTTL))
 	}
-	return changed, nil
+	return len(expired) > 0, nil
 }
@@ -32,9 +32,9 @@ func TestApplyTTL(t *testing.T) {
 		})
 
 		ctx := &context{
-			config:    config.Config{AllocationTTL: "1h"},
-			allocFile: allocFile,
-			logger:    logger.Logger{},
+			config: config.Config{AllocationTTL: "1h"},
+			tx:     allocations.NewFileTx(allocFile.Data),
+			logger: logger.Logger{},
 		}
 
 		changed, err := applyTTL(ctx)
@@ -72,9 +72,9 @@ func TestApplyTTL(t *testing.T) {
 		})
 
 		ctx := &context{
-			config:    config.Config{AllocationTTL: "1h"},
-			allocFile: allocFile,
-			logger:    logger.Logger{},
+			config: config.Config{AllocationTTL: "1h"},
+			tx:     allocations.NewFileTx(allocFile.Data),
+			logger: logger.Logger{},
 		}
 
 		changed, err := applyTTL(ctx)
@@ -112,9 +112,9 @@ func TestApplyTTL(t *testing.T) {
 		})
 
 		ctx := &context{
-			config:    config.Config{AllocationTTL: "0"},
-			allocFile: allocFile,
-			logger:    logger.Logger{},
+			config: config.Config{AllocationTTL: "0"},
+			tx:     allocations.NewFileTx(allocFile.Data),
+			logger: logger.Logger{},
 		}
 
 		changed, err := applyTTL(ctx)
@@ -170,9 +170,9 @@ func TestApplyTTL(t *testing.T) {
 		})
 
 		ctx := &context{
-			config:    config.Config{AllocationTTL: "1h"},
-			allocFile: allocFile,
-			logger:    logger.Logger{},
+			config: config.Config{AllocationTTL: "1h"},
+			tx:     allocations.NewFileTx(allocFile.Data),
+			logger: logger.Logger{},
 		}
 
 		changed, err := applyTTL(ctx)
@@ -232,5 +232,18 @@ func TestResolveOptions(t *testing.T) {
 			t.Errorf("AllocationsPath = %q, want /custom/allocations.json", opts.AllocationsPath)
 		}
 	})
-}
 
+	t.Run("falls back to environment variables", func(t *testing.T) {
+		t.Setenv(EnvConfigPath, "/env/config.json")
+		t.Setenv(EnvAllocationsPath, "/env/allocations.json")
+
+		opts := resolveOptions(Options{ConfigPath: "/flag/config.json"})
+
+		if opts.ConfigPath != "/flag/config.json" {
+			t.Errorf("ConfigPath = %q, want /flag/config.json", opts.ConfigPath)
+		}
+		if opts.AllocationsPath != "/env/allocations.json" {
+			t.Errorf("AllocationsPath = %q, want /env/allocations.json", opts.AllocationsPath)
+		}
+	})
+}
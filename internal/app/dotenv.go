@@ -0,0 +1,88 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/bamorim/portpls/internal/allocations"
+	"github.com/bamorim/portpls/internal/dotenv"
+)
+
+// DotenvOptions configures Dotenv.
+type DotenvOptions struct {
+	File   string // .env file; relative paths are relative to the selected directory
+	Check  bool   // report whether the file is up to date instead of writing it
+	Remove bool   // delete the portpls block instead of updating it
+}
+
+// DotenvResult describes the file Dotenv wrote or checked.
+type DotenvResult struct {
+	File     string
+	Vars     map[string]string // variable name to port
+	Changed  bool              // the file changed or, with Check, would change
+	Shadowed []string          // managed variables also assigned outside the block
+}
+
+// DotenvVars returns the port variables of the selected directory's
+// allocations, named as in Env.
+func DotenvVars(opts Options) (map[string]string, error) {
+	vars := map[string]string{}
+	err := withContext(opts, false, func(ctx *context) error {
+		records, err := ctx.tx.Query(allocations.Query{Directory: ctx.directory})
+		if err != nil {
+			return err
+		}
+		for _, r := range records {
+			vars[PortVariable(r.Name, ctx.config.EnvNames)] = strconv.Itoa(r.Port)
+		}
+		return nil
+	})
+	return vars, err
+}
+
+// Dotenv keeps the portpls block in a .env file in line with the selected
+// directory's allocations, adding the block if the file has none. Lines
+// outside the block are left as they are. A missing file is created, unless
+// there is nothing to remove from it.
+//
+// With Check nothing is written; Changed reports whether the file is out of
+// date.
+func Dotenv(opts Options, d DotenvOptions) (DotenvResult, error) {
+	directory, err := opts.Directory.ResolveDirectory()
+	if err != nil {
+		return DotenvResult{}, err
+	}
+	result := DotenvResult{File: d.File}
+	if !filepath.IsAbs(result.File) {
+		result.File = filepath.Join(directory, result.File)
+	}
+	data, err := os.ReadFile(result.File)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return DotenvResult{}, err
+	}
+	exists := err == nil
+	content := string(data)
+
+	var updated string
+	if d.Remove {
+		updated, err = dotenv.Remove(content)
+	} else {
+		if result.Vars, err = DotenvVars(opts); err != nil {
+			return DotenvResult{}, err
+		}
+		if updated, err = dotenv.Update(content, result.Vars); err == nil {
+			result.Shadowed, err = dotenv.Shadowed(content, result.Vars)
+		}
+	}
+	if err != nil {
+		return DotenvResult{}, NewCodeError(2, fmt.Errorf("%s: %w", result.File, err))
+	}
+	result.Changed = updated != content || (!exists && !d.Remove)
+	if d.Check || !result.Changed {
+		return result, nil
+	}
+	return result, os.WriteFile(result.File, []byte(updated), 0o644)
+}
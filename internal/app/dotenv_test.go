@@ -0,0 +1,96 @@
+package app
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDotenv(t *testing.T) {
+	configPath, allocPath, dir := setupTestEnv(t)
+	writeConfig(t, configPath, 20000, 20010)
+	opts := Options{
+		ConfigPath:      configPath,
+		AllocationsPath: allocPath,
+		Directory:       SpecificDirectory{Path: dir},
+		PortChecker:     mockChecker{},
+	}
+	for _, name := range []string{"main", "api"} {
+		if _, err := GetPort(opts, name, Metadata{}); err != nil {
+			t.Fatalf("GetPort: %v", err)
+		}
+	}
+	file := filepath.Join(dir, ".env.local")
+	original := "# local settings\nPORT=3000\nSECRET=abc\n"
+	if err := os.WriteFile(file, []byte(original), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	t.Run("check reports a missing block", func(t *testing.T) {
+		result, err := Dotenv(opts, DotenvOptions{File: ".env.local", Check: true})
+		if err != nil || !result.Changed {
+			t.Errorf("Dotenv = %+v, %v; want Changed", result, err)
+		}
+	})
+
+	t.Run("writes the block", func(t *testing.T) {
+		result, err := Dotenv(opts, DotenvOptions{File: ".env.local"})
+		if err != nil {
+			t.Fatalf("Dotenv: %v", err)
+		}
+		want := map[string]string{"PORT": "20000", "API_PORT": "20001"}
+		if !result.Changed || !reflect.DeepEqual(result.Vars, want) || !reflect.DeepEqual(result.Shadowed, []string{"PORT"}) {
+			t.Errorf("Dotenv = %+v", result)
+		}
+		data, _ := os.ReadFile(file)
+		if !strings.HasPrefix(string(data), original) || !strings.Contains(string(data), "API_PORT=20001\nPORT=20000\n") {
+			t.Errorf("file =\n%s", data)
+		}
+		if info, _ := os.Stat(file); info.Mode().Perm() != 0o600 {
+			t.Errorf("mode = %v, want the original 0600", info.Mode().Perm())
+		}
+	})
+
+	t.Run("is idempotent", func(t *testing.T) {
+		for _, check := range []bool{false, true} {
+			result, err := Dotenv(opts, DotenvOptions{File: file, Check: check})
+			if err != nil || result.Changed {
+				t.Errorf("Dotenv(check=%v) = %+v, %v; want unchanged", check, result, err)
+			}
+		}
+	})
+
+	t.Run("removes the block", func(t *testing.T) {
+		result, err := Dotenv(opts, DotenvOptions{File: ".env.local", Remove: true})
+		if err != nil || !result.Changed {
+			t.Fatalf("Dotenv = %+v, %v", result, err)
+		}
+		if data, _ := os.ReadFile(file); string(data) != original {
+			t.Errorf("file =\n%s\nwant the original", data)
+		}
+	})
+
+	t.Run("does not create a file to remove from", func(t *testing.T) {
+		result, err := Dotenv(opts, DotenvOptions{File: ".env.missing", Remove: true})
+		if err != nil || result.Changed {
+			t.Errorf("Dotenv = %+v, %v", result, err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, ".env.missing")); !errors.Is(err, os.ErrNotExist) {
+			t.Error("remove created the file")
+		}
+	})
+
+	t.Run("malformed block", func(t *testing.T) {
+		if err := os.WriteFile(file, []byte("# BEGIN portpls\nPORT=1\n"), 0o600); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		_, err := Dotenv(opts, DotenvOptions{File: file})
+		var codeErr CodeError
+		if !errors.As(err, &codeErr) || codeErr.Code != 2 {
+			t.Errorf("Dotenv error = %v, want code 2", err)
+		}
+	})
+}
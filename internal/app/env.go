@@ -0,0 +1,67 @@
+package app
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ProjectEnv is the environment exported for the project around a directory.
+type ProjectEnv struct {
+	Directory string            // the project's directory; empty outside projects
+	Store     string            // the allocations store the ports were read from
+	Vars      map[string]string // variable name to port
+}
+
+// PortVariable returns the environment variable for the port of the
+// allocation called name: the env_names setting if it has one, otherwise
+// PORT for main and NAME_PORT for others, with anything but letters and
+// digits replaced by underscores.
+func PortVariable(name string, names map[string]string) string {
+	if variable, ok := names[name]; ok {
+		return variable
+	}
+	if name == "main" {
+		return "PORT"
+	}
+	var b strings.Builder
+	for i, r := range strings.ToUpper(name) {
+		switch {
+		case r >= 'A' && r <= 'Z':
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				b.WriteByte('_')
+			}
+		default:
+			r = '_'
+		}
+		b.WriteRune(r)
+	}
+	return b.String() + "_PORT"
+}
+
+// Env returns the port variables of the project around the selected
+// directory, which is the closest directory going up from it that has
+// allocations. Like Prompt, it never waits for or writes to the store and
+// reuses the cache at cachePath; it returns allocations.ErrBusy when the
+// store is being written and nothing is cached.
+func Env(opts Options, cachePath string) (ProjectEnv, error) {
+	snap, err := peek(opts, cachePath)
+	if err != nil {
+		return ProjectEnv{}, err
+	}
+	env := ProjectEnv{Store: snap.store, Vars: map[string]string{}}
+	for _, r := range snap.records {
+		if isWithin(snap.directory, r.Directory) && len(r.Directory) > len(env.Directory) {
+			env.Directory = r.Directory
+		}
+	}
+	if env.Directory == "" {
+		return env, nil
+	}
+	for _, r := range snap.records {
+		if r.Directory == env.Directory {
+			env.Vars[PortVariable(r.Name, snap.config.EnvNames)] = strconv.Itoa(r.Port)
+		}
+	}
+	return env, nil
+}
@@ -0,0 +1,86 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestPortVariable(t *testing.T) {
+	names := map[string]string{"web": "VITE_PORT"}
+	tests := map[string]string{
+		"main":     "PORT",
+		"api":      "API_PORT",
+		"web":      "VITE_PORT",
+		"admin-ui": "ADMIN_UI_PORT",
+		"2fa":      "_2FA_PORT",
+	}
+	for name, want := range tests {
+		if got := PortVariable(name, names); got != want {
+			t.Errorf("PortVariable(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestEnv(t *testing.T) {
+	configPath, allocPath, dir := setupTestEnv(t)
+	writeConfig(t, configPath, 20000, 20010)
+	nested := filepath.Join(dir, "packages", "ui")
+	if err := os.MkdirAll(nested, 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	opts := func(directory string) Options {
+		return Options{
+			ConfigPath:      configPath,
+			AllocationsPath: allocPath,
+			Directory:       SpecificDirectory{Path: directory},
+			PortChecker:     mockChecker{},
+		}
+	}
+	ports := map[string]int{}
+	for _, name := range []string{"main", "api"} {
+		port, err := GetPort(opts(dir), name, Metadata{})
+		if err != nil {
+			t.Fatalf("GetPort: %v", err)
+		}
+		ports[name] = port
+	}
+	want := map[string]string{"PORT": strconv.Itoa(ports["main"]), "API_PORT": strconv.Itoa(ports["api"])}
+
+	t.Run("project directory", func(t *testing.T) {
+		env, err := Env(opts(dir), "")
+		if err != nil {
+			t.Fatalf("Env: %v", err)
+		}
+		if env.Directory != dir || env.Store != allocPath || !reflect.DeepEqual(env.Vars, want) {
+			t.Errorf("Env = %+v, want %v in %s", env, want, dir)
+		}
+	})
+
+	t.Run("below the project", func(t *testing.T) {
+		env, err := Env(opts(nested), "")
+		if err != nil || env.Directory != dir || !reflect.DeepEqual(env.Vars, want) {
+			t.Errorf("Env = %+v, %v", env, err)
+		}
+	})
+
+	t.Run("closest project wins", func(t *testing.T) {
+		port, err := GetPort(opts(nested), "main", Metadata{})
+		if err != nil {
+			t.Fatalf("GetPort: %v", err)
+		}
+		env, err := Env(opts(nested), "")
+		if err != nil || env.Directory != nested || !reflect.DeepEqual(env.Vars, map[string]string{"PORT": strconv.Itoa(port)}) {
+			t.Errorf("Env = %+v, %v", env, err)
+		}
+	})
+
+	t.Run("outside projects", func(t *testing.T) {
+		env, err := Env(opts(filepath.Dir(dir)), "")
+		if err != nil || env.Directory != "" || len(env.Vars) != 0 {
+			t.Errorf("Env = %+v, %v", env, err)
+		}
+	})
+}
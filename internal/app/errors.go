@@ -5,12 +5,17 @@ import "errors"
 var (
 	ErrNoFreePorts        = errors.New("no free ports available")
 	ErrAllocationNotFound = errors.New("allocation not found")
-	ErrMissingFlags       = errors.New("must specify --name or --all")
+	ErrMissingFlags       = errors.New("must specify --name, --selector or --all")
 	ErrConfirmDeclined    = errors.New("cancelled")
 	ErrInvalidConfigKey   = errors.New("invalid configuration key")
 	ErrInvalidConfigValue = errors.New("invalid configuration value")
 	ErrInvalidPortRange   = errors.New("invalid port range")
 	ErrUnknownFormat      = errors.New("unknown format")
+	ErrInvalidFilter      = errors.New("invalid filter")
+	ErrSameStore          = errors.New("allocations are already stored there")
+	ErrNotKillable        = errors.New("refusing to stop the port holder")
+	ErrWaitTimeout        = errors.New("timed out")
+	ErrOverrideExists     = errors.New("override file was not generated by portpls")
 )
 
 type CodeError struct {
@@ -0,0 +1,169 @@
+package app
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bamorim/portpls/internal/allocations"
+	"github.com/bamorim/portpls/internal/labels"
+)
+
+// Predicate reports whether an allocation entry is selected. Predicates
+// compose with MatchAll; a nil Predicate selects everything.
+type Predicate func(AllocationEntry) bool
+
+// MatchAll returns a predicate that holds when every non-nil predicate does.
+func MatchAll(preds ...Predicate) Predicate {
+	return func(e AllocationEntry) bool {
+		for _, p := range preds {
+			if p != nil && !p(e) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func (p Predicate) matches(e AllocationEntry) bool {
+	return p == nil || p(e)
+}
+
+// selects reports whether p selects r without checking its port unless the
+// outcome depends on it. Predicates only see the port through Status, so if
+// p gives the same answer for a busy and a free port, the check is skipped
+// and status is returned empty.
+func (p Predicate) selects(ctx *context, r allocations.Record) (ok bool, status string) {
+	if p == nil {
+		return true, ""
+	}
+	busy := p(entryWithStatus(r, StatusBusy))
+	if busy == p(entryWithStatus(r, StatusFree)) {
+		return busy, ""
+	}
+	status = portStatus(ctx, r.Port)
+	return (status == StatusBusy) == busy, status
+}
+
+// InDirectories adapts a DirectoryFilter to a Predicate.
+func InDirectories(filter DirectoryFilter) Predicate {
+	return func(e AllocationEntry) bool { return filter(e.Directory) }
+}
+
+// UnderDirectory selects allocations in path or any directory below it.
+func UnderDirectory(path string) (Predicate, error) {
+	root, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	return func(e AllocationEntry) bool { return isWithin(e.Directory, root) }, nil
+}
+
+// isWithin reports whether path is root or a directory below it.
+func isWithin(path, root string) bool {
+	prefix := root
+	if !strings.HasSuffix(prefix, string(filepath.Separator)) {
+		prefix += string(filepath.Separator)
+	}
+	return path == root || strings.HasPrefix(path, prefix)
+}
+
+// WithName selects allocations with the given name.
+func WithName(name string) Predicate {
+	return func(e AllocationEntry) bool { return e.Name == name }
+}
+
+// WithStatus selects allocations whose port is "busy" or "free".
+func WithStatus(status string) (Predicate, error) {
+	if status != StatusBusy && status != StatusFree {
+		return nil, NewCodeError(2, fmt.Errorf("%w: status must be %s or %s", ErrInvalidFilter, StatusBusy, StatusFree))
+	}
+	return func(e AllocationEntry) bool { return e.Status == status }, nil
+}
+
+// WithLocked selects locked allocations, or unlocked ones when locked is false.
+func WithLocked(locked bool) Predicate {
+	return func(e AllocationEntry) bool { return e.Locked == locked }
+}
+
+// OlderThan selects allocations assigned more than d before now.
+func OlderThan(d time.Duration, now time.Time) Predicate {
+	return func(e AllocationEntry) bool { return e.AssignedAt.Add(d).Before(now) }
+}
+
+// UnusedFor selects allocations last used more than d before now.
+func UnusedFor(d time.Duration, now time.Time) Predicate {
+	return func(e AllocationEntry) bool { return e.LastUsedAt.Add(d).Before(now) }
+}
+
+// WithLabels selects allocations whose labels match selector.
+func WithLabels(selector labels.Selector) Predicate {
+	return func(e AllocationEntry) bool { return selector.Matches(e.Labels) }
+}
+
+// Sort keys accepted by SortEntries.
+const (
+	SortByPort     = "port"
+	SortByDir      = "dir"
+	SortByLastUsed = "last-used"
+)
+
+// SortEntries orders entries by key: port, dir (then port) or last-used
+// (least recently used first, then port).
+func SortEntries(entries []AllocationEntry, key string) error {
+	var less func(a, b AllocationEntry) bool
+	switch key {
+	case "", SortByPort:
+		less = func(a, b AllocationEntry) bool { return a.Port < b.Port }
+	case SortByDir:
+		less = func(a, b AllocationEntry) bool {
+			if a.Directory != b.Directory {
+				return a.Directory < b.Directory
+			}
+			return a.Port < b.Port
+		}
+	case SortByLastUsed:
+		less = func(a, b AllocationEntry) bool {
+			if !a.LastUsedAt.Equal(b.LastUsedAt) {
+				return a.LastUsedAt.Before(b.LastUsedAt)
+			}
+			return a.Port < b.Port
+		}
+	default:
+		return NewCodeError(2, fmt.Errorf("%w: unknown sort key %q (want %s, %s or %s)", ErrInvalidFilter, key, SortByPort, SortByDir, SortByLastUsed))
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return less(entries[i], entries[j]) })
+	return nil
+}
+
+// GroupByDirectory is the only grouping GroupEntries supports.
+const GroupByDirectory = "directory"
+
+// EntryGroup is a set of entries sharing a grouping key.
+type EntryGroup struct {
+	Key     string
+	Entries []AllocationEntry
+}
+
+// GroupEntries splits entries into groups ordered by key, keeping the order
+// of entries within each group.
+func GroupEntries(entries []AllocationEntry, by string) ([]EntryGroup, error) {
+	if by != GroupByDirectory {
+		return nil, NewCodeError(2, fmt.Errorf("%w: unknown group %q (want %s)", ErrInvalidFilter, by, GroupByDirectory))
+	}
+	index := map[string]int{}
+	var groups []EntryGroup
+	for _, e := range entries {
+		i, ok := index[e.Directory]
+		if !ok {
+			i = len(groups)
+			index[e.Directory] = i
+			groups = append(groups, EntryGroup{Key: e.Directory})
+		}
+		groups[i].Entries = append(groups[i].Entries, e)
+	}
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].Key < groups[j].Key })
+	return groups, nil
+}
@@ -0,0 +1,195 @@
+package app
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bamorim/portpls/internal/allocations"
+	"github.com/bamorim/portpls/internal/labels"
+)
+
+func testEntries(now time.Time) []AllocationEntry {
+	day := 24 * time.Hour
+	return []AllocationEntry{
+		{Port: 20003, Directory: "/work/app", Name: "web", Status: StatusBusy, AssignedAt: now.Add(-10 * day), LastUsedAt: now.Add(-1 * time.Hour)},
+		{Port: 20001, Directory: "/work/app/sub", Name: "db", Status: StatusFree, Locked: true, AssignedAt: now.Add(-2 * day), LastUsedAt: now.Add(-5 * day), Labels: map[string]string{"env": "e2e"}},
+		{Port: 20002, Directory: "/work/application", Name: "web", Status: StatusFree, AssignedAt: now.Add(-1 * time.Hour), LastUsedAt: now.Add(-1 * time.Hour)},
+	}
+}
+
+func ports(entries []AllocationEntry) []int {
+	out := []int{}
+	for _, e := range entries {
+		out = append(out, e.Port)
+	}
+	return out
+}
+
+func filterEntries(entries []AllocationEntry, p Predicate) []AllocationEntry {
+	var out []AllocationEntry
+	for _, e := range entries {
+		if p.matches(e) {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+func TestPredicates(t *testing.T) {
+	now := time.Now()
+	under, err := UnderDirectory("/work/app")
+	if err != nil {
+		t.Fatalf("UnderDirectory: %v", err)
+	}
+	busy, err := WithStatus(StatusBusy)
+	if err != nil {
+		t.Fatalf("WithStatus: %v", err)
+	}
+	sel, _ := labels.ParseSelector("env=e2e")
+
+	tests := []struct {
+		name string
+		pred Predicate
+		want []int
+	}{
+		{"nil selects all", nil, []int{20003, 20001, 20002}},
+		{"name", WithName("web"), []int{20003, 20002}},
+		{"status", busy, []int{20003}},
+		{"locked", WithLocked(true), []int{20001}},
+		{"unlocked", WithLocked(false), []int{20003, 20002}},
+		{"older than", OlderThan(7*24*time.Hour, now), []int{20003}},
+		{"unused for", UnusedFor(3*24*time.Hour, now), []int{20001}},
+		{"under is a path prefix", under, []int{20003, 20001}},
+		{"labels", WithLabels(sel), []int{20001}},
+		{"combined", MatchAll(WithName("web"), under), []int{20003}},
+		{"directory filter", InDirectories(func(dir string) bool { return dir == "/work/application" }), []int{20002}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ports(filterEntries(testEntries(now), tt.pred))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ports = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("invalid status", func(t *testing.T) {
+		if _, err := WithStatus("idle"); !errors.Is(err, ErrInvalidFilter) {
+			t.Errorf("error = %v, want ErrInvalidFilter", err)
+		}
+	})
+}
+
+func TestSortEntries(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		key  string
+		want []int
+	}{
+		{"port", []int{20001, 20002, 20003}},
+		{"dir", []int{20003, 20001, 20002}},
+		{"last-used", []int{20001, 20002, 20003}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			entries := testEntries(now)
+			if err := SortEntries(entries, tt.key); err != nil {
+				t.Fatalf("SortEntries: %v", err)
+			}
+			if got := ports(entries); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ports = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if err := SortEntries(testEntries(now), "size"); !errors.Is(err, ErrInvalidFilter) {
+		t.Errorf("error = %v, want ErrInvalidFilter", err)
+	}
+}
+
+func TestGroupEntries(t *testing.T) {
+	entries := testEntries(time.Now())
+	entries = append(entries, AllocationEntry{Port: 20004, Directory: "/work/app", Name: "api"})
+	groups, err := GroupEntries(entries, GroupByDirectory)
+	if err != nil {
+		t.Fatalf("GroupEntries: %v", err)
+	}
+	var keys []string
+	for _, g := range groups {
+		keys = append(keys, g.Key)
+	}
+	if want := []string{"/work/app", "/work/app/sub", "/work/application"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("keys = %v, want %v", keys, want)
+	}
+	if got := ports(groups[0].Entries); !reflect.DeepEqual(got, []int{20003, 20004}) {
+		t.Errorf("first group ports = %v", got)
+	}
+	if _, err := GroupEntries(entries, "name"); !errors.Is(err, ErrInvalidFilter) {
+		t.Errorf("error = %v, want ErrInvalidFilter", err)
+	}
+}
+
+// recordingChecker reports every port as busy and records which were checked.
+type recordingChecker map[int]bool
+
+func (c recordingChecker) IsFree(port int) bool {
+	c[port] = true
+	return false
+}
+
+func TestFiltersCheckOnlySelectedPorts(t *testing.T) {
+	configPath, allocPath, dir := setupTestEnv(t)
+	writeConfig(t, configPath, 20000, 20010)
+	absDir, _ := filepath.Abs(dir)
+	allocFile, _ := allocations.OpenLocked(allocPath, true)
+	allocFile.SetAllocation(20001, &allocations.Allocation{Directory: absDir, Name: "web", AssignedAt: time.Now(), LastUsedAt: time.Now()})
+	allocFile.SetAllocation(20002, &allocations.Allocation{Directory: "/elsewhere", Name: "web", AssignedAt: time.Now(), LastUsedAt: time.Now()})
+	allocFile.SetAllocation(20003, &allocations.Allocation{Directory: absDir, Name: "db", AssignedAt: time.Now(), LastUsedAt: time.Now()})
+	allocFile.Save()
+	allocFile.Close()
+	busy, _ := WithStatus(StatusBusy)
+	filter, _ := FilterByDirectory(absDir)
+
+	tests := []struct {
+		name  string
+		run   func(Options) error
+		ports []int
+	}{
+		{"list by directory", func(opts Options) error {
+			_, err := ListAllocations(opts, InDirectories(filter))
+			return err
+		}, []int{20001, 20003}},
+		{"list by name and status", func(opts Options) error {
+			_, err := ListAllocations(opts, MatchAll(WithName("web"), busy))
+			return err
+		}, []int{20001, 20002}},
+		{"forget without status filter", func(opts Options) error {
+			_, err := Forget(opts, filter, WithName("none"), "", false, false, nil)
+			return err
+		}, []int{}},
+		{"forget by status", func(opts Options) error {
+			_, err := Forget(opts, filter, MatchAll(WithName("none"), busy), "", false, false, nil)
+			return err
+		}, []int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := recordingChecker{}
+			opts := Options{ConfigPath: configPath, AllocationsPath: allocPath, Directory: SpecificDirectory{Path: dir}, PortChecker: checker}
+			if err := tt.run(opts); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			checked := []int{}
+			for port := 20000; port <= 20010; port++ {
+				if checker[port] {
+					checked = append(checked, port)
+				}
+			}
+			if !reflect.DeepEqual(checked, tt.ports) {
+				t.Errorf("checked ports %v, want %v", checked, tt.ports)
+			}
+		})
+	}
+}
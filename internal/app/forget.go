@@ -2,21 +2,24 @@ package app
 
 import (
 	"fmt"
-	"strconv"
+
+	"github.com/bamorim/portpls/internal/allocations"
 )
 
 type ForgetResult struct {
 	Message string
+	Count   int // allocations removed
 }
 
 // Forget removes port allocations based on the provided filter.
 // - filter: determines which directories to consider
+// - match: only removes allocations it selects (alone, removes all matches); may be nil
 // - name: the allocation name to remove (if nameSet is true)
 // - nameSet: whether the name parameter should be used
 // - deleteAll: if true, deletes all allocations matching the filter
 // - confirm: callback for user confirmation (required for global deletes)
-func Forget(opts Options, filter DirectoryFilter, name string, nameSet bool, deleteAll bool, confirm func() bool) (ForgetResult, error) {
-	if !nameSet && !deleteAll {
+func Forget(opts Options, filter DirectoryFilter, match Predicate, name string, nameSet bool, deleteAll bool, confirm func() bool) (ForgetResult, error) {
+	if !nameSet && !deleteAll && match == nil {
 		return ForgetResult{}, NewCodeError(2, ErrMissingFlags)
 	}
 	if filter == nil {
@@ -25,24 +28,25 @@ func Forget(opts Options, filter DirectoryFilter, name string, nameSet bool, del
 
 	var result ForgetResult
 	err := withContext(opts, true, func(ctx *context) error {
-		if deleteAll {
+		if deleteAll || !nameSet {
 			// If confirm callback is provided, we need user confirmation
 			if confirm != nil && !confirm() {
 				return ErrConfirmDeclined
 			}
 
-			count := 0
-			for portStr, alloc := range ctx.allocFile.Data.Allocations {
-				if filter(alloc.Directory) {
-					delete(ctx.allocFile.Data.Allocations, portStr)
-					count++
+			matched, err := ctx.tx.Query(allocations.Query{Match: forgetMatch(ctx, filter, match)})
+			if err != nil {
+				return err
+			}
+			for _, r := range matched {
+				if err := ctx.tx.Delete(r.Port); err != nil {
+					return err
 				}
 			}
+			count := len(matched)
+			result.Count = count
 
 			_ = ctx.logger.Event("ALLOC_DELETE_ALL", fmt.Sprintf("count=%d", count))
-			if err := ctx.allocFile.Save(); err != nil {
-				return err
-			}
 			result.Message = fmt.Sprintf("Cleared %d allocation(s)", count)
 			return nil
 		}
@@ -52,27 +56,27 @@ func Forget(opts Options, filter DirectoryFilter, name string, nameSet bool, del
 			port int
 			dir  string
 		}
-		for portStr, alloc := range ctx.allocFile.Data.Allocations {
-			if alloc.Name == name && filter(alloc.Directory) {
-				portNum, _ := strconv.Atoi(portStr)
-				ctx.allocFile.DeletePort(portNum)
-				_ = ctx.logger.Event("ALLOC_DELETE", fmt.Sprintf("port=%d dir=%s name=%s", portNum, alloc.Directory, name))
-				deleted = append(deleted, struct {
-					port int
-					dir  string
-				}{portNum, alloc.Directory})
+		matched, err := ctx.tx.Query(allocations.Query{Name: name, Match: forgetMatch(ctx, filter, match)})
+		if err != nil {
+			return err
+		}
+		for _, r := range matched {
+			if err := ctx.tx.Delete(r.Port); err != nil {
+				return err
 			}
+			_ = ctx.logger.Event("ALLOC_DELETE", fmt.Sprintf("port=%d dir=%s name=%s", r.Port, r.Directory, name))
+			deleted = append(deleted, struct {
+				port int
+				dir  string
+			}{r.Port, r.Directory})
 		}
 
+		result.Count = len(deleted)
 		if len(deleted) == 0 {
 			result.Message = fmt.Sprintf("No allocation found for '%s'", name)
 			return nil
 		}
 
-		if err := ctx.allocFile.Save(); err != nil {
-			return err
-		}
-
 		if len(deleted) == 1 {
 			result.Message = fmt.Sprintf("Cleared allocation '%s' for %s (was port %d)", name, deleted[0].dir, deleted[0].port)
 		} else {
@@ -89,3 +93,22 @@ func Forget(opts Options, filter DirectoryFilter, name string, nameSet bool, del
 	}
 	return result, nil
 }
+
+// ForgetNeedsConfirmation reports whether a forget must be confirmed: one
+// that reaches beyond a single directory (--all-directories or --under) and
+// removes everything or every match of the filters rather than one name.
+func ForgetNeedsConfirmation(acrossDirectories, deleteAll, nameSet, filtered bool) bool {
+	return acrossDirectories && (deleteAll || (!nameSet && filtered))
+}
+
+// forgetMatch selects records in directories accepted by filter that match
+// also selects. Ports are only checked when match filters on status.
+func forgetMatch(ctx *context, filter DirectoryFilter, match Predicate) func(allocations.Record) bool {
+	return func(r allocations.Record) bool {
+		if !filter(r.Directory) {
+			return false
+		}
+		ok, _ := match.selects(ctx, r)
+		return ok
+	}
+}
@@ -1,12 +1,14 @@
 package app
 
 import (
+	"errors"
 	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/bamorim/portpls/internal/allocations"
+	"github.com/bamorim/portpls/internal/labels"
 )
 
 func TestForget(t *testing.T) {
@@ -35,7 +37,7 @@ func TestForget(t *testing.T) {
 		}
 
 		filter, _ := FilterByDirectory(absDir)
-		result, err := Forget(opts, filter, "web", true, false, nil)
+		result, err := Forget(opts, filter, nil, "web", true, false, nil)
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -66,7 +68,7 @@ func TestForget(t *testing.T) {
 
 		absDir, _ := filepath.Abs(dir)
 		filter, _ := FilterByDirectory(absDir)
-		result, err := Forget(opts, filter, "nonexistent", true, false, nil)
+		result, err := Forget(opts, filter, nil, "nonexistent", true, false, nil)
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -104,7 +106,7 @@ func TestForget(t *testing.T) {
 		}
 
 		filter, _ := FilterByDirectory(absDir)
-		result, err := Forget(opts, filter, "", false, true, nil)
+		result, err := Forget(opts, filter, nil, "", false, true, nil)
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -155,7 +157,7 @@ func TestForget(t *testing.T) {
 		}
 
 		filter := NoFilter() // Global delete across all directories
-		result, err := Forget(opts, filter, "", false, true, confirm)
+		result, err := Forget(opts, filter, nil, "", false, true, confirm)
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -197,7 +199,7 @@ func TestForget(t *testing.T) {
 		confirm := func() bool { return false }
 
 		filter := NoFilter() // Global delete across all directories
-		_, err := Forget(opts, filter, "", false, true, confirm)
+		_, err := Forget(opts, filter, nil, "", false, true, confirm)
 		if err == nil {
 			t.Fatal("expected error, got nil")
 		}
@@ -247,7 +249,7 @@ func TestForget(t *testing.T) {
 		}
 
 		filter := NoFilter() // Match all directories
-		result, err := Forget(opts, filter, "web", true, false, nil)
+		result, err := Forget(opts, filter, nil, "web", true, false, nil)
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -272,6 +274,49 @@ func TestForget(t *testing.T) {
 		}
 	})
 
+	t.Run("forgets allocations matching a selector", func(t *testing.T) {
+		configPath, allocPath, _ := setupTestEnv(t)
+		writeConfig(t, configPath, 20000, 20010)
+
+		allocFile, _ := allocations.OpenLocked(allocPath, true)
+		now := time.Now().UTC()
+		allocFile.SetAllocation(20001, &allocations.Allocation{
+			Directory: "/a", Name: "web", AssignedAt: now, LastUsedAt: now,
+			Labels: map[string]string{"env": "e2e"},
+		})
+		allocFile.SetAllocation(20002, &allocations.Allocation{
+			Directory: "/b", Name: "web", AssignedAt: now, LastUsedAt: now,
+			Labels: map[string]string{"env": "dev"},
+		})
+		allocFile.SetAllocation(20003, &allocations.Allocation{
+			Directory: "/c", Name: "api", AssignedAt: now, LastUsedAt: now,
+		})
+		allocFile.Save()
+		allocFile.Close()
+
+		opts := Options{ConfigPath: configPath, AllocationsPath: allocPath, Directory: SpecificDirectory{Path: "/a"}}
+		selector, err := labels.ParseSelector("env=e2e")
+		if err != nil {
+			t.Fatalf("ParseSelector: %v", err)
+		}
+		result, err := Forget(opts, NoFilter(), WithLabels(selector), "", false, false, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !strings.Contains(result.Message, "1 allocation(s)") {
+			t.Errorf("expected '1 allocation(s)' in message, got: %s", result.Message)
+		}
+
+		allocFile2, _ := allocations.OpenLocked(allocPath, false)
+		defer allocFile2.Close()
+		if _, exists := allocFile2.Data.Allocations["20001"]; exists {
+			t.Error("allocation 20001 (env=e2e) should be deleted")
+		}
+		if len(allocFile2.Data.Allocations) != 2 {
+			t.Errorf("expected 2 allocations remaining, got %d", len(allocFile2.Data.Allocations))
+		}
+	})
+
 	t.Run("returns error when neither name nor all specified", func(t *testing.T) {
 		configPath, allocPath, dir := setupTestEnv(t)
 		writeConfig(t, configPath, 20000, 20010)
@@ -284,7 +329,7 @@ func TestForget(t *testing.T) {
 
 		absDir, _ := filepath.Abs(dir)
 		filter, _ := FilterByDirectory(absDir)
-		_, err := Forget(opts, filter, "", false, false, nil)
+		_, err := Forget(opts, filter, nil, "", false, false, nil)
 		if err == nil {
 			t.Fatal("expected error, got nil")
 		}
@@ -298,3 +343,49 @@ func TestForget(t *testing.T) {
 		}
 	})
 }
+
+func TestForgetNeedsConfirmation(t *testing.T) {
+	tests := []struct {
+		name                                            string
+		acrossDirectories, deleteAll, nameSet, filtered bool
+		want                                            bool
+	}{
+		{"one directory", false, true, false, true, false},
+		{"all in every directory", true, true, false, false, true},
+		{"filters in every directory", true, false, false, true, true},
+		{"one name in every directory", true, false, true, true, false},
+	}
+	for _, tt := range tests {
+		if got := ForgetNeedsConfirmation(tt.acrossDirectories, tt.deleteAll, tt.nameSet, tt.filtered); got != tt.want {
+			t.Errorf("%s: ForgetNeedsConfirmation = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestForgetUnderDeclined(t *testing.T) {
+	configPath, allocPath, dir := setupTestEnv(t)
+	writeConfig(t, configPath, 20000, 20010)
+	allocFile, _ := allocations.OpenLocked(allocPath, true)
+	allocFile.SetAllocation(20001, &allocations.Allocation{Directory: "/work/a", Name: "main", AssignedAt: time.Now(), LastUsedAt: time.Now()})
+	allocFile.SetAllocation(20002, &allocations.Allocation{Directory: "/other/b", Name: "main", AssignedAt: time.Now(), LastUsedAt: time.Now()})
+	allocFile.Save()
+	allocFile.Close()
+	opts := Options{ConfigPath: configPath, AllocationsPath: allocPath, Directory: SpecificDirectory{Path: dir}, PortChecker: mockChecker{}}
+
+	// forget --under / --all, as main.go sets it up
+	under, _ := UnderDirectory("/")
+	if !ForgetNeedsConfirmation(true, true, false, true) {
+		t.Fatal("--under --all should need confirmation")
+	}
+	_, err := Forget(opts, NoFilter(), under, "main", false, true, func() bool { return false })
+	if !errors.Is(err, ErrConfirmDeclined) {
+		t.Fatalf("error = %v, want ErrConfirmDeclined", err)
+	}
+	entries, err := ListAllocations(opts, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("declined forget removed allocations, %d left", len(entries))
+	}
+}
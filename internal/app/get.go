@@ -7,50 +7,111 @@ import (
 	"github.com/bamorim/portpls/internal/allocations"
 )
 
-func GetPort(opts Options, name string) (int, error) {
+// GetPort returns the port for name in the selected directory, allocating
+// one if needed, and applies meta to the allocation.
+func GetPort(opts Options, name string, meta Metadata) (int, error) {
 	var result int
 	err := withContext(opts, true, func(ctx *context) error {
-		now := time.Now().UTC()
-		if portNum, alloc := ctx.allocFile.FindByDirectoryName(ctx.directory, name); alloc != nil {
-			if ctx.portChecker.IsFree(portNum) {
-				alloc.LastUsedAt = now
-				ctx.allocFile.SetAllocation(portNum, alloc)
-				_ = ctx.logger.Event("ALLOC_UPDATE", fmt.Sprintf("port=%d (reused)", portNum))
-				if err := ctx.allocFile.Save(); err != nil {
-					return err
-				}
-				result = portNum
-				return nil
-			}
-			ctx.allocFile.DeletePort(portNum)
-			_ = ctx.logger.Event("ALLOC_DELETE", fmt.Sprintf("port=%d dir=%s name=%s", portNum, ctx.directory, name))
+		var err error
+		result, err = getPort(ctx, name, meta, time.Now().UTC())
+		return err
+	})
+	if err != nil {
+		if err == ErrNoFreePorts {
+			return 0, NewCodeError(1, err)
 		}
+		return 0, err
+	}
+	return result, nil
+}
 
-		portNum, err := findFreePort(ctx, name, now)
-		if err != nil {
-			return err
-		}
-		alloc := &allocations.Allocation{
-			Directory:  ctx.directory,
-			Name:       name,
-			AssignedAt: now,
-			LastUsedAt: now,
-			Locked:     false,
-		}
-		ctx.allocFile.SetAllocation(portNum, alloc)
-		ctx.allocFile.Data.LastIssuedPort = portNum
-		_ = ctx.logger.Event("ALLOC_ADD", fmt.Sprintf("port=%d dir=%s name=%s", portNum, ctx.directory, name))
-		if err := ctx.allocFile.Save(); err != nil {
-			return err
+// GetPorts is GetPort for several names at once. The ports are allocated in
+// one transaction, so either all of them are or none are.
+func GetPorts(opts Options, names []string, meta Metadata) (map[string]int, error) {
+	result := map[string]int{}
+	err := withContext(opts, true, func(ctx *context) error {
+		now := time.Now().UTC()
+		for _, name := range names {
+			portNum, err := getPort(ctx, name, meta, now)
+			if err != nil {
+				return err
+			}
+			result[name] = portNum
 		}
-		result = portNum
 		return nil
 	})
 	if err != nil {
 		if err == ErrNoFreePorts {
-			return 0, NewCodeError(1, err)
+			return nil, NewCodeError(1, err)
 		}
-		return 0, err
+		return nil, err
 	}
 	return result, nil
 }
+
+// getPort reuses the allocation for name in the context's directory while
+// its port is free, and otherwise allocates a new port.
+func getPort(ctx *context, name string, meta Metadata, now time.Time) (int, error) {
+	portNum, alloc, err := ctx.tx.Find(ctx.directory, name)
+	if err != nil {
+		return 0, err
+	}
+	if alloc != nil {
+		if ctx.portChecker.IsFree(portNum) {
+			alloc.LastUsedAt = now
+			labeled := meta.apply(alloc)
+			if err := ctx.tx.Set(portNum, alloc); err != nil {
+				return 0, err
+			}
+			_ = ctx.logger.Event("ALLOC_UPDATE", fmt.Sprintf("port=%d (reused)", portNum))
+			if labeled {
+				logLabels(ctx, portNum, alloc)
+			}
+			return portNum, nil
+		}
+		if err := ctx.tx.Delete(portNum); err != nil {
+			return 0, err
+		}
+		_ = ctx.logger.Event("ALLOC_DELETE", fmt.Sprintf("port=%d dir=%s name=%s", portNum, ctx.directory, name))
+	}
+
+	previous := alloc
+	portNum, alloc, err = newAllocation(ctx, name, now)
+	if err != nil {
+		return 0, err
+	}
+	if previous != nil {
+		// The allocation moved to a new port; keep what it was for.
+		alloc.Labels, alloc.Note = previous.Labels, previous.Note
+	}
+	meta.apply(alloc)
+	if err := ctx.tx.Set(portNum, alloc); err != nil {
+		return 0, err
+	}
+	return portNum, nil
+}
+
+// allocate returns the allocation for name in the context's directory,
+// whether its port is free or not, and a new one if there is none. The
+// caller updates the allocation and stores it.
+func allocate(ctx *context, name string, now time.Time) (int, *allocations.Allocation, error) {
+	portNum, alloc, err := ctx.tx.Find(ctx.directory, name)
+	if err != nil || alloc != nil {
+		return portNum, alloc, err
+	}
+	return newAllocation(ctx, name, now)
+}
+
+// newAllocation picks a free port for name in the context's directory and
+// records it as the last issued port. The caller stores the allocation.
+func newAllocation(ctx *context, name string, now time.Time) (int, *allocations.Allocation, error) {
+	portNum, err := findFreePort(ctx, name, now)
+	if err != nil {
+		return 0, nil, err
+	}
+	if err := ctx.tx.SetLastIssuedPort(portNum); err != nil {
+		return 0, nil, err
+	}
+	_ = ctx.logger.Event("ALLOC_ADD", fmt.Sprintf("port=%d dir=%s name=%s", portNum, ctx.directory, name))
+	return portNum, &allocations.Allocation{Directory: ctx.directory, Name: name, AssignedAt: now, LastUsedAt: now}, nil
+}
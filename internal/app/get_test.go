@@ -2,6 +2,7 @@ package app
 
 import (
 	"encoding/json"
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
@@ -56,7 +57,7 @@ func TestGetPort(t *testing.T) {
 			PortChecker:     checker,
 		}
 
-		port, err := GetPort(opts, "main")
+		port, err := GetPort(opts, "main", Metadata{})
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -100,7 +101,7 @@ func TestGetPort(t *testing.T) {
 			PortChecker:     checker,
 		}
 
-		port, err := GetPort(opts, "main")
+		port, err := GetPort(opts, "main", Metadata{})
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -137,7 +138,7 @@ func TestGetPort(t *testing.T) {
 			PortChecker:     checker,
 		}
 
-		port, err := GetPort(opts, "main")
+		port, err := GetPort(opts, "main", Metadata{})
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -171,7 +172,7 @@ func TestGetPort(t *testing.T) {
 			PortChecker:     checker,
 		}
 
-		_, err := GetPort(opts, "main")
+		_, err := GetPort(opts, "main", Metadata{})
 		if err == nil {
 			t.Fatal("expected error, got nil")
 		}
@@ -203,12 +204,12 @@ func TestGetPort(t *testing.T) {
 			PortChecker:     checker,
 		}
 
-		port1, err := GetPort(opts, "web")
+		port1, err := GetPort(opts, "web", Metadata{})
 		if err != nil {
 			t.Fatalf("unexpected error for web: %v", err)
 		}
 
-		port2, err := GetPort(opts, "api")
+		port2, err := GetPort(opts, "api", Metadata{})
 		if err != nil {
 			t.Fatalf("unexpected error for api: %v", err)
 		}
@@ -218,3 +219,34 @@ func TestGetPort(t *testing.T) {
 		}
 	})
 }
+
+func TestGetPorts(t *testing.T) {
+	configPath, allocPath, dir := setupTestEnv(t)
+	writeConfig(t, configPath, 20000, 20002)
+	opts := Options{
+		ConfigPath:      configPath,
+		AllocationsPath: allocPath,
+		Directory:       SpecificDirectory{Path: dir},
+		PortChecker:     mockChecker{},
+	}
+
+	web, err := GetPort(opts, "web", Metadata{})
+	if err != nil {
+		t.Fatalf("GetPort: %v", err)
+	}
+	ports, err := GetPorts(opts, []string{"web", "api"}, Metadata{})
+	if err != nil {
+		t.Fatalf("GetPorts: %v", err)
+	}
+	if ports["web"] != web || ports["api"] == web || len(ports) != 2 {
+		t.Errorf("GetPorts = %v, want web kept on %d and api on the other port", ports, web)
+	}
+
+	if _, err := GetPorts(opts, []string{"db", "cache"}, Metadata{}); !errors.Is(err, ErrNoFreePorts) {
+		t.Fatalf("GetPorts error = %v, want ErrNoFreePorts", err)
+	}
+	entries, err := ListAllocations(opts, WithName("db"))
+	if err != nil || len(entries) != 0 {
+		t.Errorf("db allocations = %v, %v; want none since the batch failed", entries, err)
+	}
+}
@@ -0,0 +1,132 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/bamorim/portpls/internal/allocations"
+	"github.com/bamorim/portpls/internal/docker"
+	"github.com/bamorim/portpls/internal/logger"
+	"github.com/bamorim/portpls/internal/process"
+)
+
+// Process control, replaced in tests.
+var (
+	terminateProcess = process.Terminate
+	stopContainer    = docker.Stop
+)
+
+// KillTarget is what Kill is about to stop: the holder of an allocated port.
+// Exactly one of Process and Container is set; a container is stopped with
+// docker rather than signalled.
+type KillTarget struct {
+	Port      int
+	Process   *process.Info
+	Container *docker.Container
+}
+
+type KillResult struct {
+	Message string
+}
+
+// Kill stops whatever holds the port allocated to name in the current
+// directory: SIGTERM, then SIGKILL once timeout has passed, or docker stop
+// for a container. Unless force is set it refuses processes owned by another
+// user and holders running in another allocation's directory. confirm, if
+// not nil, is asked before anything is stopped.
+func Kill(opts Options, name string, timeout time.Duration, force bool, confirm func(KillTarget) bool) (KillResult, error) {
+	var (
+		portNum     int
+		directory   string
+		directories []string
+		busy        bool
+		log         logger.Logger
+	)
+	err := withContext(opts, false, func(ctx *context) error {
+		p, alloc, err := ctx.tx.Find(ctx.directory, name)
+		if err != nil {
+			return err
+		}
+		if alloc == nil {
+			return ErrAllocationNotFound
+		}
+		records, err := ctx.tx.Query(allocations.Query{})
+		if err != nil {
+			return err
+		}
+		for _, r := range records {
+			directories = append(directories, r.Directory)
+		}
+		portNum, directory, log = p, ctx.directory, ctx.logger
+		busy = !ctx.portChecker.IsFree(p)
+		return nil
+	})
+	if err != nil {
+		if err == ErrAllocationNotFound {
+			return KillResult{}, NewCodeError(1, err)
+		}
+		return KillResult{}, err
+	}
+	if !busy {
+		return KillResult{Message: fmt.Sprintf("Port %d is not in use", portNum)}, nil
+	}
+
+	target := KillTarget{Port: portNum}
+	holderDir := ""
+	if container, err := findContainer(portNum); err == nil {
+		target.Container = container
+		holderDir = container.WorkingDir
+	} else if info, err := findProcess(portNum); err == nil {
+		target.Process = info
+		holderDir = info.Cwd
+	} else {
+		return KillResult{}, NewCodeError(1, fmt.Errorf("port %d is in use but the process holding it could not be identified", portNum))
+	}
+
+	if !force {
+		if p := target.Process; p != nil && p.UID != os.Getuid() {
+			return KillResult{}, NewCodeError(1, fmt.Errorf("%w: %s (pid %d) belongs to user %s; use --force to kill it anyway", ErrNotKillable, p.Command, p.PID, p.User))
+		}
+		if owner := owningDirectory(holderDir, directories); owner != "" && owner != directory {
+			return KillResult{}, NewCodeError(1, fmt.Errorf("%w: the holder of port %d runs in %s, which has its own allocation; use --force to kill it anyway", ErrNotKillable, portNum, owner))
+		}
+	}
+	if confirm != nil && !confirm(target) {
+		return KillResult{}, NewCodeError(1, ErrConfirmDeclined)
+	}
+
+	if c := target.Container; c != nil {
+		if err := stopContainer(c.ID); err != nil {
+			return KillResult{}, NewCodeError(1, err)
+		}
+		_ = log.Event("PORT_KILL", fmt.Sprintf("port=%d container=%s", portNum, c.Name))
+		return KillResult{Message: fmt.Sprintf("Stopped container %s (port %d)", c.Name, portNum)}, nil
+	}
+	p := target.Process
+	killed, err := terminateProcess(p.PID, timeout)
+	if err != nil {
+		return KillResult{}, NewCodeError(1, fmt.Errorf("kill %d: %w", p.PID, err))
+	}
+	signal := "SIGTERM"
+	if killed {
+		signal = "SIGKILL"
+	}
+	_ = log.Event("PORT_KILL", fmt.Sprintf("port=%d pid=%d signal=%s", portNum, p.PID, signal))
+	return KillResult{Message: fmt.Sprintf("Stopped %s (pid %d, port %d) with %s", p.Command, p.PID, portNum, signal)}, nil
+}
+
+// owningDirectory returns the most specific allocated directory containing
+// path, or "" if there is none or path is unknown.
+func owningDirectory(path string, directories []string) string {
+	owner := ""
+	if path == "" {
+		return owner
+	}
+	for _, dir := range directories {
+		if isWithin(path, dir) && len(dir) > len(owner) {
+			owner = dir
+		}
+	}
+	return owner
+}
@@ -0,0 +1,129 @@
+package app
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bamorim/portpls/internal/docker"
+	"github.com/bamorim/portpls/internal/process"
+)
+
+func TestKill(t *testing.T) {
+	configPath, allocPath, dir := setupTestEnv(t)
+	writeConfig(t, configPath, 20000, 20010)
+	sub := filepath.Join(dir, "sub")
+
+	opts := func(directory string, freePorts map[int]bool) Options {
+		return Options{
+			ConfigPath:      configPath,
+			AllocationsPath: allocPath,
+			Directory:       SpecificDirectory{Path: directory},
+			PortChecker:     mockChecker{freePorts: freePorts},
+		}
+	}
+	portNum, err := GetPort(opts(dir, nil), "web", Metadata{})
+	if err != nil {
+		t.Fatalf("GetPort: %v", err)
+	}
+	if _, err := GetPort(opts(sub, nil), "main", Metadata{}); err != nil {
+		t.Fatalf("GetPort: %v", err)
+	}
+	busy := map[int]bool{}
+
+	var holder *process.Info
+	var container *docker.Container
+	var terminated, stopped []string
+	findProcess = func(int) (*process.Info, error) {
+		if holder == nil {
+			return nil, errors.New("process not found")
+		}
+		return holder, nil
+	}
+	findContainer = func(int) (*docker.Container, error) {
+		if container == nil {
+			return nil, errors.New("no docker container matched")
+		}
+		return container, nil
+	}
+	terminateProcess = func(pid int, timeout time.Duration) (bool, error) {
+		terminated = append(terminated, holder.Command)
+		return false, nil
+	}
+	stopContainer = func(id string) error {
+		stopped = append(stopped, id)
+		return nil
+	}
+	t.Cleanup(func() {
+		findProcess = process.FindByPort
+		findContainer = docker.FindContainerByPort
+		terminateProcess = process.Terminate
+		stopContainer = docker.Stop
+	})
+
+	tests := []struct {
+		name       string
+		process    *process.Info
+		container  *docker.Container
+		freePorts  map[int]bool
+		force      bool
+		decline    bool
+		wantErr    error
+		fail       bool // any error
+		terminated int
+		stopped    int
+	}{
+		{name: "free port", freePorts: nil},
+		{name: "own process", process: &process.Info{PID: 10, Command: "node", UID: os.Getuid(), Cwd: dir}, freePorts: busy, terminated: 1},
+		{name: "declined", process: &process.Info{PID: 10, Command: "node", UID: os.Getuid(), Cwd: dir}, freePorts: busy, decline: true, wantErr: ErrConfirmDeclined},
+		{name: "other user", process: &process.Info{PID: 11, Command: "nginx", UID: os.Getuid() + 1, User: "www"}, freePorts: busy, wantErr: ErrNotKillable},
+		{name: "other user forced", process: &process.Info{PID: 11, Command: "nginx", UID: os.Getuid() + 1, User: "www"}, freePorts: busy, force: true, terminated: 1},
+		{name: "other allocation's directory", process: &process.Info{PID: 12, Command: "vite", UID: os.Getuid(), Cwd: filepath.Join(sub, "src")}, freePorts: busy, wantErr: ErrNotKillable},
+		{name: "other allocation's directory forced", process: &process.Info{PID: 12, Command: "vite", UID: os.Getuid(), Cwd: sub}, freePorts: busy, force: true, terminated: 1},
+		{name: "container", container: &docker.Container{ID: "abc", Name: "web-1", WorkingDir: dir}, freePorts: busy, stopped: 1},
+		{name: "unidentified", freePorts: busy, fail: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			holder, container, terminated, stopped = tt.process, tt.container, nil, nil
+			confirmed := false
+			result, err := Kill(opts(dir, tt.freePorts), "web", time.Second, tt.force, func(target KillTarget) bool {
+				confirmed = true
+				if target.Port != portNum {
+					t.Errorf("target port = %d, want %d", target.Port, portNum)
+				}
+				return !tt.decline
+			})
+			switch {
+			case tt.fail:
+				if err == nil {
+					t.Fatal("expected error")
+				}
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("error = %v, want %v", err, tt.wantErr)
+				}
+			case err != nil:
+				t.Fatalf("Kill: %v", err)
+			default:
+				if result.Message == "" {
+					t.Error("expected a message")
+				}
+			}
+			if len(terminated) != tt.terminated || len(stopped) != tt.stopped {
+				t.Errorf("terminated %v, stopped %v", terminated, stopped)
+			}
+			if confirmed && tt.wantErr == ErrNotKillable {
+				t.Error("confirmation asked before refusing")
+			}
+		})
+	}
+
+	t.Run("allocation not found", func(t *testing.T) {
+		if _, err := Kill(opts(dir, busy), "api", time.Second, false, nil); !errors.Is(err, ErrAllocationNotFound) {
+			t.Errorf("error = %v, want ErrAllocationNotFound", err)
+		}
+	})
+}
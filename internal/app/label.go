@@ -0,0 +1,89 @@
+package app
+
+import (
+	"fmt"
+
+	"github.com/bamorim/portpls/internal/allocations"
+	"github.com/bamorim/portpls/internal/labels"
+)
+
+// Metadata holds label and note changes for an allocation.
+type Metadata struct {
+	Labels       map[string]string // labels to add or overwrite
+	RemoveLabels []string          // label keys to remove
+	Note         *string           // new note; nil leaves it unchanged
+}
+
+// Empty reports whether m changes nothing.
+func (m Metadata) Empty() bool {
+	return len(m.Labels) == 0 && len(m.RemoveLabels) == 0 && m.Note == nil
+}
+
+// apply updates alloc with m and reports whether anything changed.
+func (m Metadata) apply(alloc *allocations.Allocation) bool {
+	changed := false
+	for _, key := range m.RemoveLabels {
+		if _, ok := alloc.Labels[key]; ok {
+			delete(alloc.Labels, key)
+			changed = true
+		}
+	}
+	for key, value := range m.Labels {
+		if current, ok := alloc.Labels[key]; ok && current == value {
+			continue
+		}
+		if alloc.Labels == nil {
+			alloc.Labels = map[string]string{}
+		}
+		alloc.Labels[key] = value
+		changed = true
+	}
+	if len(alloc.Labels) == 0 {
+		alloc.Labels = nil
+	}
+	if m.Note != nil && *m.Note != alloc.Note {
+		alloc.Note = *m.Note
+		changed = true
+	}
+	return changed
+}
+
+type LabelResult struct {
+	Port   int
+	Labels map[string]string
+	Note   string
+}
+
+// Label changes the labels and note of the named allocation in the selected
+// directory.
+func Label(opts Options, name string, meta Metadata) (LabelResult, error) {
+	var result LabelResult
+	err := withContext(opts, true, func(ctx *context) error {
+		portNum, alloc, err := ctx.tx.Find(ctx.directory, name)
+		if err != nil {
+			return err
+		}
+		if alloc == nil {
+			return ErrAllocationNotFound
+		}
+		if meta.apply(alloc) {
+			if err := ctx.tx.Set(portNum, alloc); err != nil {
+				return err
+			}
+			logLabels(ctx, portNum, alloc)
+		}
+		result = LabelResult{Port: portNum, Labels: alloc.Labels, Note: alloc.Note}
+		return nil
+	})
+	if err != nil {
+		if err == ErrAllocationNotFound {
+			return LabelResult{}, NewCodeError(1, err)
+		}
+		return LabelResult{}, err
+	}
+	return result, nil
+}
+
+func logLabels(ctx *context, portNum int, alloc *allocations.Allocation) {
+	_ = ctx.logger.Event("ALLOC_LABEL", fmt.Sprintf("port=%d labels=%s note=%q", portNum, labels.Format(alloc.Labels), alloc.Note))
+}
@@ -0,0 +1,99 @@
+package app
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/bamorim/portpls/internal/labels"
+)
+
+func TestLabels(t *testing.T) {
+	configPath, allocPath, dir := setupTestEnv(t)
+	writeConfig(t, configPath, 20000, 20010)
+	opts := Options{
+		ConfigPath:      configPath,
+		AllocationsPath: allocPath,
+		Directory:       SpecificDirectory{Path: dir},
+		PortChecker:     mockChecker{},
+	}
+	note := "e2e suite"
+
+	port, err := GetPort(opts, "web", Metadata{Labels: map[string]string{"env": "e2e", "owner": "alice"}, Note: &note})
+	if err != nil {
+		t.Fatalf("GetPort: %v", err)
+	}
+
+	t.Run("get sets labels and note", func(t *testing.T) {
+		entries, err := ListAllocations(opts, nil)
+		if err != nil {
+			t.Fatalf("ListAllocations: %v", err)
+		}
+		if len(entries) != 1 || entries[0].Note != note || entries[0].Labels["owner"] != "alice" {
+			t.Errorf("entries = %+v", entries)
+		}
+	})
+
+	t.Run("get without metadata keeps labels", func(t *testing.T) {
+		if _, err := GetPort(opts, "web", Metadata{}); err != nil {
+			t.Fatalf("GetPort: %v", err)
+		}
+		entries, _ := ListAllocations(opts, nil)
+		if entries[0].Labels["env"] != "e2e" {
+			t.Errorf("labels = %v, want env=e2e kept", entries[0].Labels)
+		}
+	})
+
+	t.Run("label updates and removes", func(t *testing.T) {
+		result, err := Label(opts, "web", Metadata{
+			Labels:       map[string]string{"ticket": "PLAT-123"},
+			RemoveLabels: []string{"owner"},
+		})
+		if err != nil {
+			t.Fatalf("Label: %v", err)
+		}
+		want := map[string]string{"env": "e2e", "ticket": "PLAT-123"}
+		if result.Port != port || !reflect.DeepEqual(result.Labels, want) || result.Note != note {
+			t.Errorf("result = %+v, want port %d labels %v", result, port, want)
+		}
+	})
+
+	t.Run("list filters by selector", func(t *testing.T) {
+		if _, err := LockPort(opts, "db", Metadata{Labels: map[string]string{"env": "dev"}}); err != nil {
+			t.Fatalf("LockPort: %v", err)
+		}
+		tests := []struct {
+			selector string
+			want     []string
+		}{
+			{"env=e2e", []string{"web"}},
+			{"env in (dev,e2e)", []string{"web", "db"}},
+			{"!ticket", []string{"db"}},
+		}
+		for _, tt := range tests {
+			sel, err := labels.ParseSelector(tt.selector)
+			if err != nil {
+				t.Fatalf("ParseSelector: %v", err)
+			}
+			entries, err := ListAllocations(opts, WithLabels(sel))
+			if err != nil {
+				t.Fatalf("ListAllocations: %v", err)
+			}
+			var got []string
+			for _, e := range entries {
+				got = append(got, e.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s: got %v, want %v", tt.selector, got, tt.want)
+			}
+		}
+	})
+
+	t.Run("label on missing allocation", func(t *testing.T) {
+		_, err := Label(opts, "missing", Metadata{Labels: map[string]string{"a": "b"}})
+		var codeErr CodeError
+		if !errors.As(err, &codeErr) || codeErr.Code != 1 {
+			t.Errorf("error = %v, want CodeError 1", err)
+		}
+	})
+}
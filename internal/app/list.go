@@ -1,54 +1,99 @@
 package app
 
 import (
-	"sort"
-	"strconv"
 	"time"
+
+	"github.com/bamorim/portpls/internal/allocations"
+)
+
+// Port statuses reported in AllocationEntry.Status.
+const (
+	StatusBusy = "busy"
+	StatusFree = "free"
 )
 
+// AllocationEntry is an allocation as reported by list. Its JSON encoding is
+// part of the CLI contract (list --format json/ndjson): existing fields keep
+// their names and types, and new fields are only ever added. Timestamps are
+// RFC 3339 in UTC, labels is always an object and note always a string.
 type AllocationEntry struct {
-	Port       int
-	Directory  string
-	Name       string
-	Status     string
-	Locked     bool
-	AssignedAt time.Time
-	LastUsedAt time.Time
+	Port       int               `json:"port"`
+	Directory  string            `json:"directory"`
+	Name       string            `json:"name"`
+	Status     string            `json:"status"` // StatusBusy or StatusFree
+	Locked     bool              `json:"locked"`
+	AssignedAt time.Time         `json:"assigned_at"`
+	LastUsedAt time.Time         `json:"last_used_at"`
+	Labels     map[string]string `json:"labels"`
+	Note       string            `json:"note"`
 }
 
-func ListAllocations(opts Options, filter DirectoryFilter) ([]AllocationEntry, error) {
-	if filter == nil {
-		filter = NoFilter()
-	}
+// ListAllocations returns the allocations selected by match, ordered by
+// port. A nil match lists everything.
+func ListAllocations(opts Options, match Predicate) ([]AllocationEntry, error) {
+	return listAllocations(opts, match, true)
+}
+
+// ViewAllocations is ListAllocations without expiring allocations, so it
+// never writes to the store. list --watch uses it to refresh without
+// triggering its own change notifications.
+func ViewAllocations(opts Options, match Predicate) ([]AllocationEntry, error) {
+	return listAllocations(opts, match, false)
+}
+
+func listAllocations(opts Options, match Predicate, exclusive bool) ([]AllocationEntry, error) {
 	entries := []AllocationEntry{}
-	err := withContext(opts, true, func(ctx *context) error {
-		for portStr, alloc := range ctx.allocFile.Data.Allocations {
-			if !filter(alloc.Directory) {
-				continue
-			}
-			portNum, err := strconv.Atoi(portStr)
-			if err != nil {
+	err := withContext(opts, exclusive, func(ctx *context) error {
+		records, err := ctx.tx.Query(allocations.Query{})
+		if err != nil {
+			return err
+		}
+		for _, r := range records {
+			ok, status := match.selects(ctx, r)
+			if !ok {
 				continue
 			}
-			status := "busy"
-			if ctx.portChecker.IsFree(portNum) {
-				status = "free"
+			if status == "" {
+				status = portStatus(ctx, r.Port)
 			}
-			entries = append(entries, AllocationEntry{
-				Port:       portNum,
-				Directory:  alloc.Directory,
-				Name:       alloc.Name,
-				Status:     status,
-				Locked:     alloc.Locked,
-				AssignedAt: alloc.AssignedAt,
-				LastUsedAt: alloc.LastUsedAt,
-			})
+			entries = append(entries, entryWithStatus(r, status))
 		}
 		return nil
 	})
 	if err != nil {
 		return nil, err
 	}
-	sort.Slice(entries, func(i, j int) bool { return entries[i].Port < entries[j].Port })
 	return entries, nil
 }
+
+// newEntry describes r, checking whether its port is currently in use.
+func newEntry(ctx *context, r allocations.Record) AllocationEntry {
+	return entryWithStatus(r, portStatus(ctx, r.Port))
+}
+
+// portStatus checks whether port is currently in use.
+func portStatus(ctx *context, port int) string {
+	if ctx.portChecker.IsFree(port) {
+		return StatusFree
+	}
+	return StatusBusy
+}
+
+// entryWithStatus describes r with a status that is already known.
+func entryWithStatus(r allocations.Record, status string) AllocationEntry {
+	entryLabels := r.Labels
+	if entryLabels == nil {
+		entryLabels = map[string]string{}
+	}
+	return AllocationEntry{
+		Port:       r.Port,
+		Directory:  r.Directory,
+		Name:       r.Name,
+		Status:     status,
+		Locked:     r.Locked,
+		AssignedAt: r.AssignedAt.UTC(),
+		LastUsedAt: r.LastUsedAt.UTC(),
+		Labels:     entryLabels,
+		Note:       r.Note,
+	}
+}
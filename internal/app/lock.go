@@ -3,40 +3,28 @@ package app
 import (
 	"fmt"
 	"time"
-
-	"github.com/bamorim/portpls/internal/allocations"
 )
 
-func LockPort(opts Options, name string) (int, error) {
+// LockPort locks the port for name in the selected directory, allocating
+// one if needed, and applies meta to the allocation.
+func LockPort(opts Options, name string, meta Metadata) (int, error) {
 	var result int
 	err := withContext(opts, true, func(ctx *context) error {
 		now := time.Now().UTC()
-		portNum, alloc := ctx.allocFile.FindByDirectoryName(ctx.directory, name)
-		if alloc == nil {
-			var err error
-			portNum, err = findFreePort(ctx, name, now)
-			if err != nil {
-				return err
-			}
-			alloc = &allocations.Allocation{
-				Directory:  ctx.directory,
-				Name:       name,
-				AssignedAt: now,
-				LastUsedAt: now,
-				Locked:     true,
-			}
-			ctx.allocFile.SetAllocation(portNum, alloc)
-			ctx.allocFile.Data.LastIssuedPort = portNum
-			_ = ctx.logger.Event("ALLOC_ADD", fmt.Sprintf("port=%d dir=%s name=%s", portNum, ctx.directory, name))
-		} else {
-			alloc.Locked = true
-			alloc.LastUsedAt = now
-			ctx.allocFile.SetAllocation(portNum, alloc)
+		portNum, alloc, err := allocate(ctx, name, now)
+		if err != nil {
+			return err
 		}
-		_ = ctx.logger.Event("ALLOC_LOCK", fmt.Sprintf("port=%d locked=true", portNum))
-		if err := ctx.allocFile.Save(); err != nil {
+		alloc.Locked = true
+		alloc.LastUsedAt = now
+		labeled := meta.apply(alloc)
+		if err := ctx.tx.Set(portNum, alloc); err != nil {
 			return err
 		}
+		_ = ctx.logger.Event("ALLOC_LOCK", fmt.Sprintf("port=%d locked=true", portNum))
+		if labeled {
+			logLabels(ctx, portNum, alloc)
+		}
 		result = portNum
 		return nil
 	})
@@ -52,16 +40,18 @@ func LockPort(opts Options, name string) (int, error) {
 func UnlockPort(opts Options, name string) (int, error) {
 	var result int
 	err := withContext(opts, true, func(ctx *context) error {
-		portNum, alloc := ctx.allocFile.FindByDirectoryName(ctx.directory, name)
+		portNum, alloc, err := ctx.tx.Find(ctx.directory, name)
+		if err != nil {
+			return err
+		}
 		if alloc == nil {
 			return ErrAllocationNotFound
 		}
 		alloc.Locked = false
-		ctx.allocFile.SetAllocation(portNum, alloc)
-		_ = ctx.logger.Event("ALLOC_LOCK", fmt.Sprintf("port=%d locked=false", portNum))
-		if err := ctx.allocFile.Save(); err != nil {
+		if err := ctx.tx.Set(portNum, alloc); err != nil {
 			return err
 		}
+		_ = ctx.logger.Event("ALLOC_LOCK", fmt.Sprintf("port=%d locked=false", portNum))
 		result = portNum
 		return nil
 	})
@@ -35,7 +35,7 @@ func TestLockPort(t *testing.T) {
 			PortChecker:     checker,
 		}
 
-		port, err := LockPort(opts, "main")
+		port, err := LockPort(opts, "main", Metadata{})
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -71,7 +71,7 @@ func TestLockPort(t *testing.T) {
 			PortChecker:     checker,
 		}
 
-		port, err := LockPort(opts, "main")
+		port, err := LockPort(opts, "main", Metadata{})
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -108,7 +108,7 @@ func TestLockPort(t *testing.T) {
 			PortChecker:     checker,
 		}
 
-		_, err := LockPort(opts, "main")
+		_, err := LockPort(opts, "main", Metadata{})
 		if err == nil {
 			t.Fatal("expected error, got nil")
 		}
@@ -0,0 +1,103 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bamorim/portpls/internal/allocations"
+	"github.com/bamorim/portpls/internal/config"
+)
+
+// Migrate upgrades the allocations file to the current format version. With
+// dryRun nothing is written and the result describes the pending changes.
+// SQLite databases upgrade their schema when opened, so for them this only
+// checks that the database is readable.
+func Migrate(opts Options, dryRun bool) (allocations.MigrationResult, error) {
+	layered, err := loadConfig(opts)
+	if err != nil {
+		return allocations.MigrationResult{}, err
+	}
+	path := StorePath(opts, layered.Config)
+	if !allocations.IsSQLitePath(path) {
+		return allocations.Migrate(path, dryRun)
+	}
+	result := allocations.MigrationResult{Path: path, From: allocations.CurrentVersion, To: allocations.CurrentVersion}
+	store, err := allocations.OpenSQLite(path)
+	if err != nil {
+		return result, err
+	}
+	return result, store.Close()
+}
+
+// StoreMigration describes a conversion between storage backends.
+type StoreMigration struct {
+	From  string
+	To    string
+	Count int
+	// ConfigUpdated reports whether the storage key was changed so that
+	// later commands use the new store. It stays false for explicit
+	// allocations paths, which must be updated by the user.
+	ConfigUpdated bool
+}
+
+// MigrateStore copies every allocation into a store using the given backend
+// (config.StorageJSON or config.StorageSQLite). The default locations switch
+// over by setting the storage key; an explicit allocations path is copied
+// next to itself with the backend's extension. The old store is kept.
+func MigrateStore(opts Options, backend string) (StoreMigration, error) {
+	key, err := config.Lookup("storage")
+	if err != nil {
+		return StoreMigration{}, err
+	}
+	layered, err := loadConfig(opts)
+	if err != nil {
+		return StoreMigration{}, err
+	}
+	target := layered.Config
+	if err := key.Set(&target, backend); err != nil || backend == "" {
+		return StoreMigration{}, NewCodeError(2, fmt.Errorf("%w: %s", ErrInvalidConfigValue, backend))
+	}
+
+	result := StoreMigration{From: StorePath(opts, layered.Config)}
+	explicit := opts.AllocationsPath != "" || os.Getenv(EnvAllocationsPath) != ""
+	if explicit {
+		result.To = withBackendExt(result.From, backend)
+	} else {
+		result.To = StorePath(opts, target)
+	}
+	if filepath.Clean(result.To) == filepath.Clean(result.From) {
+		return result, NewCodeError(1, fmt.Errorf("%w: %s", ErrSameStore, result.To))
+	}
+
+	src, err := allocations.Open(result.From)
+	if err != nil {
+		return result, err
+	}
+	defer src.Close()
+	dst, err := allocations.Open(result.To)
+	if err != nil {
+		return result, err
+	}
+	defer dst.Close()
+	if result.Count, err = allocations.Copy(dst, src); err != nil {
+		return result, err
+	}
+
+	if !explicit {
+		if err := config.SetValue(resolveOptions(opts).ConfigPath, key.Name, backend); err != nil {
+			return result, err
+		}
+		result.ConfigUpdated = true
+	}
+	return result, nil
+}
+
+func withBackendExt(path, backend string) string {
+	ext := ".json"
+	if backend == config.StorageSQLite {
+		ext = ".db"
+	}
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ext
+}
@@ -0,0 +1,118 @@
+package app
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bamorim/portpls/internal/allocations"
+	"github.com/bamorim/portpls/internal/config"
+)
+
+func TestMigrateStore(t *testing.T) {
+	t.Run("switches the default location to sqlite", func(t *testing.T) {
+		t.Setenv("XDG_DATA_HOME", t.TempDir())
+		t.Setenv(EnvAllocationsPath, "")
+		configPath, _, dir := setupTestEnv(t)
+		writeConfig(t, configPath, 20000, 20010)
+		opts := Options{
+			ConfigPath:  configPath,
+			Directory:   SpecificDirectory{Path: dir},
+			PortChecker: mockChecker{},
+		}
+		port, err := GetPort(opts, "web", Metadata{})
+		if err != nil {
+			t.Fatalf("GetPort: %v", err)
+		}
+
+		result, err := MigrateStore(opts, config.StorageSQLite)
+		if err != nil {
+			t.Fatalf("MigrateStore: %v", err)
+		}
+		if result.Count != 1 || !result.ConfigUpdated || result.To != DefaultSQLitePath() {
+			t.Errorf("result = %+v", result)
+		}
+		if _, err := os.Stat(result.From); err != nil {
+			t.Errorf("old store should be kept: %v", err)
+		}
+
+		// Later commands use the database and find the existing allocation.
+		again, err := GetPort(opts, "web", Metadata{})
+		if err != nil {
+			t.Fatalf("GetPort after migrate: %v", err)
+		}
+		if again != port {
+			t.Errorf("port after migrate = %d, want %d", again, port)
+		}
+		if _, err := MigrateStore(opts, config.StorageSQLite); !errors.Is(err, ErrSameStore) {
+			t.Errorf("second migrate error = %v, want ErrSameStore", err)
+		}
+	})
+
+	t.Run("copies an explicit path next to itself", func(t *testing.T) {
+		configPath, allocPath, dir := setupTestEnv(t)
+		writeConfig(t, configPath, 20000, 20010)
+		opts := Options{
+			ConfigPath:      configPath,
+			AllocationsPath: allocPath,
+			Directory:       SpecificDirectory{Path: dir},
+			PortChecker:     mockChecker{},
+		}
+		if _, err := LockPort(opts, "db", Metadata{}); err != nil {
+			t.Fatalf("LockPort: %v", err)
+		}
+
+		result, err := MigrateStore(opts, config.StorageSQLite)
+		if err != nil {
+			t.Fatalf("MigrateStore: %v", err)
+		}
+		want := filepath.Join(filepath.Dir(allocPath), "allocations.db")
+		if result.To != want || result.ConfigUpdated {
+			t.Errorf("result = %+v, want To=%s without config update", result, want)
+		}
+		store, err := allocations.OpenSQLite(want)
+		if err != nil {
+			t.Fatalf("OpenSQLite: %v", err)
+		}
+		defer store.Close()
+		_ = store.View(func(tx allocations.Tx) error {
+			_, alloc, err := tx.Find(dir, "db")
+			if err != nil || alloc == nil || !alloc.Locked {
+				t.Errorf("Find = %+v, %v; want locked allocation", alloc, err)
+			}
+			return nil
+		})
+	})
+
+	t.Run("rejects unknown backends", func(t *testing.T) {
+		configPath, allocPath, _ := setupTestEnv(t)
+		opts := Options{ConfigPath: configPath, AllocationsPath: allocPath}
+		if _, err := MigrateStore(opts, "postgres"); !errors.Is(err, ErrInvalidConfigValue) {
+			t.Errorf("error = %v, want ErrInvalidConfigValue", err)
+		}
+	})
+}
+
+func TestWithStore(t *testing.T) {
+	configPath, _, dir := setupTestEnv(t)
+	writeConfig(t, configPath, 20000, 20010)
+	store := allocations.NewMemoryStore()
+	opts := Options{
+		ConfigPath:  configPath,
+		Directory:   SpecificDirectory{Path: dir},
+		PortChecker: mockChecker{},
+		Store:       store,
+	}
+	port, err := GetPort(opts, "main", Metadata{})
+	if err != nil {
+		t.Fatalf("GetPort: %v", err)
+	}
+	_ = store.View(func(tx allocations.Tx) error {
+		alloc, err := tx.Get(port)
+		if err != nil || alloc == nil || alloc.Directory != dir {
+			t.Errorf("Get(%d) = %+v, %v", port, alloc, err)
+		}
+		return nil
+	})
+}
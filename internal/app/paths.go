@@ -1,22 +1,158 @@
 package app
 
 import (
+	"errors"
+	"io"
 	"os"
 	"path/filepath"
 )
 
+const (
+	appDirName          = "portpls"
+	configFileName      = "config.json"
+	allocationsFileName = "allocations.json"
+	sqliteFileName      = "allocations.db"
+	logFileName         = "portpls.log"
+	promptCacheFileName = "prompt.json"
+)
+
+// ConfigDir returns $XDG_CONFIG_HOME/portpls, defaulting to ~/.config/portpls.
+func ConfigDir() string {
+	return xdgDir("XDG_CONFIG_HOME", ".config")
+}
+
+// DataDir returns $XDG_DATA_HOME/portpls, defaulting to ~/.local/share/portpls.
+func DataDir() string {
+	return xdgDir("XDG_DATA_HOME", filepath.Join(".local", "share"))
+}
+
+// StateDir returns $XDG_STATE_HOME/portpls, defaulting to ~/.local/state/portpls.
+func StateDir() string {
+	return xdgDir("XDG_STATE_HOME", filepath.Join(".local", "state"))
+}
+
+// CacheDir returns $XDG_CACHE_HOME/portpls, defaulting to ~/.cache/portpls.
+func CacheDir() string {
+	return xdgDir("XDG_CACHE_HOME", ".cache")
+}
+
 func DefaultConfigPath() string {
+	return filepath.Join(ConfigDir(), configFileName)
+}
+
+func DefaultAllocationsPath() string {
+	return filepath.Join(DataDir(), allocationsFileName)
+}
+
+// DefaultSQLitePath is the allocations database used when storage is sqlite.
+func DefaultSQLitePath() string {
+	return filepath.Join(DataDir(), sqliteFileName)
+}
+
+// DefaultLogPath is where logs go when log_file is set to a bare file name.
+func DefaultLogPath() string {
+	return filepath.Join(StateDir(), logFileName)
+}
+
+// DefaultPromptCachePath is where prompt keeps the allocations it last read.
+func DefaultPromptCachePath() string {
+	return filepath.Join(CacheDir(), promptCacheFileName)
+}
+
+// ResolveLogPath turns the log_file setting into a path. Empty stays empty
+// (logging disabled), "~" is expanded and relative paths are placed in the
+// state directory.
+func ResolveLogPath(logFile string) string {
+	if logFile == "" {
+		return ""
+	}
+	if logFile[0] == '~' {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, logFile[1:])
+		}
+	}
+	if filepath.IsAbs(logFile) {
+		return logFile
+	}
+	return filepath.Join(StateDir(), logFile)
+}
+
+// xdgDir resolves the portpls directory under the base directory named by
+// envVar. Per the XDG spec, relative values are ignored.
+func xdgDir(envVar, homeFallback string) string {
+	if base := os.Getenv(envVar); base != "" && filepath.IsAbs(base) {
+		return filepath.Join(base, appDirName)
+	}
 	home, err := os.UserHomeDir()
 	if err != nil {
-		return ".config/portpls/config.json"
+		return filepath.Join(homeFallback, appDirName)
 	}
-	return filepath.Join(home, ".config", "portpls", "config.json")
+	return filepath.Join(home, homeFallback, appDirName)
 }
 
-func DefaultAllocationsPath() string {
+func legacyConfigPath() string {
+	return legacyPath(filepath.Join(".config", appDirName, configFileName))
+}
+
+func legacyAllocationsPath() string {
+	return legacyPath(filepath.Join(".local", "share", appDirName, allocationsFileName))
+}
+
+func legacyPath(rel string) string {
 	home, err := os.UserHomeDir()
 	if err != nil {
-		return ".local/share/portpls/allocations.json"
+		return ""
+	}
+	return filepath.Join(home, rel)
+}
+
+// migrateLegacyFile moves a file from its pre-XDG location to path when the
+// two differ, the legacy file exists and nothing is at path yet. It is a
+// no-op in every other case, so it is safe to call on every run.
+func migrateLegacyFile(legacy, path string) error {
+	if legacy == "" || filepath.Clean(legacy) == filepath.Clean(path) {
+		return nil
+	}
+	if _, err := os.Stat(path); err == nil || !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if _, err := os.Stat(legacy); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	if err := os.Rename(legacy, path); err == nil {
+		return nil
+	}
+	// Rename fails across filesystems; fall back to copy and remove.
+	if err := copyFile(legacy, path); err != nil {
+		return err
+	}
+	return os.Remove(legacy)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		_ = os.Remove(dst)
+		return err
 	}
-	return filepath.Join(home, ".local", "share", "portpls", "allocations.json")
+	return out.Close()
 }
@@ -0,0 +1,161 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDefaultPaths(t *testing.T) {
+	t.Run("uses XDG base directories when set", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		t.Setenv("XDG_CONFIG_HOME", filepath.Join(tmpDir, "config"))
+		t.Setenv("XDG_DATA_HOME", filepath.Join(tmpDir, "data"))
+		t.Setenv("XDG_STATE_HOME", filepath.Join(tmpDir, "state"))
+		t.Setenv("XDG_CACHE_HOME", filepath.Join(tmpDir, "cache"))
+
+		if got, want := DefaultConfigPath(), filepath.Join(tmpDir, "config", "portpls", "config.json"); got != want {
+			t.Errorf("DefaultConfigPath() = %q, want %q", got, want)
+		}
+		if got, want := DefaultAllocationsPath(), filepath.Join(tmpDir, "data", "portpls", "allocations.json"); got != want {
+			t.Errorf("DefaultAllocationsPath() = %q, want %q", got, want)
+		}
+		if got, want := DefaultLogPath(), filepath.Join(tmpDir, "state", "portpls", "portpls.log"); got != want {
+			t.Errorf("DefaultLogPath() = %q, want %q", got, want)
+		}
+		if got, want := DefaultPromptCachePath(), filepath.Join(tmpDir, "cache", "portpls", "prompt.json"); got != want {
+			t.Errorf("DefaultPromptCachePath() = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("falls back to home directory", func(t *testing.T) {
+		home := t.TempDir()
+		t.Setenv("HOME", home)
+		t.Setenv("XDG_CONFIG_HOME", "")
+		t.Setenv("XDG_DATA_HOME", "")
+		t.Setenv("XDG_STATE_HOME", "")
+		t.Setenv("XDG_CACHE_HOME", "")
+
+		if got, want := DefaultConfigPath(), filepath.Join(home, ".config", "portpls", "config.json"); got != want {
+			t.Errorf("DefaultConfigPath() = %q, want %q", got, want)
+		}
+		if got, want := DefaultAllocationsPath(), filepath.Join(home, ".local", "share", "portpls", "allocations.json"); got != want {
+			t.Errorf("DefaultAllocationsPath() = %q, want %q", got, want)
+		}
+		if got, want := StateDir(), filepath.Join(home, ".local", "state", "portpls"); got != want {
+			t.Errorf("StateDir() = %q, want %q", got, want)
+		}
+		if got, want := CacheDir(), filepath.Join(home, ".cache", "portpls"); got != want {
+			t.Errorf("CacheDir() = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("ignores relative XDG values", func(t *testing.T) {
+		home := t.TempDir()
+		t.Setenv("HOME", home)
+		t.Setenv("XDG_CONFIG_HOME", "relative/config")
+
+		if got, want := ConfigDir(), filepath.Join(home, ".config", "portpls"); got != want {
+			t.Errorf("ConfigDir() = %q, want %q", got, want)
+		}
+	})
+}
+
+func TestResolveLogPath(t *testing.T) {
+	state := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", state)
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"", ""},
+		{"/var/log/portpls.log", "/var/log/portpls.log"},
+		{"portpls.log", filepath.Join(state, "portpls", "portpls.log")},
+	}
+	for _, tt := range tests {
+		if got := ResolveLogPath(tt.input); got != tt.want {
+			t.Errorf("ResolveLogPath(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestMigrateLegacyFile(t *testing.T) {
+	t.Run("moves legacy file to new location", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		legacy := filepath.Join(tmpDir, "old", "config.json")
+		path := filepath.Join(tmpDir, "new", "portpls", "config.json")
+		if err := os.MkdirAll(filepath.Dir(legacy), 0755); err != nil {
+			t.Fatalf("failed to create legacy dir: %v", err)
+		}
+		if err := os.WriteFile(legacy, []byte(`{"port_start": 30000}`), 0644); err != nil {
+			t.Fatalf("failed to write legacy file: %v", err)
+		}
+
+		if err := migrateLegacyFile(legacy, path); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("migrated file missing: %v", err)
+		}
+		if string(data) != `{"port_start": 30000}` {
+			t.Errorf("migrated content = %q", data)
+		}
+		if _, err := os.Stat(legacy); !os.IsNotExist(err) {
+			t.Errorf("legacy file should be gone, stat err = %v", err)
+		}
+	})
+
+	t.Run("keeps existing file at new location", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		legacy := filepath.Join(tmpDir, "legacy.json")
+		path := filepath.Join(tmpDir, "current.json")
+		if err := os.WriteFile(legacy, []byte("legacy"), 0644); err != nil {
+			t.Fatalf("failed to write legacy file: %v", err)
+		}
+		if err := os.WriteFile(path, []byte("current"), 0644); err != nil {
+			t.Fatalf("failed to write current file: %v", err)
+		}
+
+		if err := migrateLegacyFile(legacy, path); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		data, _ := os.ReadFile(path)
+		if string(data) != "current" {
+			t.Errorf("current file was overwritten: %q", data)
+		}
+		if _, err := os.Stat(legacy); err != nil {
+			t.Errorf("legacy file should be left alone: %v", err)
+		}
+	})
+
+	t.Run("no-op when paths are the same", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		path := filepath.Join(tmpDir, "config.json")
+		if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+
+		if err := migrateLegacyFile(path, path); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("file should still exist: %v", err)
+		}
+	})
+
+	t.Run("no-op when legacy file is missing", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		path := filepath.Join(tmpDir, "new", "config.json")
+
+		if err := migrateLegacyFile(filepath.Join(tmpDir, "missing.json"), path); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("nothing should be created, stat err = %v", err)
+		}
+	})
+}
@@ -1,7 +1,6 @@
 package app
 
 import (
-	"strconv"
 	"time"
 )
 
@@ -12,7 +11,11 @@ func findFreePort(ctx *context, name string, now time.Time) (int, error) {
 		return 0, ErrInvalidPortRange
 	}
 	freeze, _ := ctx.config.FreezeDuration()
-	candidate := ctx.allocFile.Data.LastIssuedPort + 1
+	last, err := ctx.tx.LastIssuedPort()
+	if err != nil {
+		return 0, err
+	}
+	candidate := last + 1
 	if candidate < start || candidate > end {
 		candidate = start
 	}
@@ -25,7 +28,11 @@ func findFreePort(ctx *context, name string, now time.Time) (int, error) {
 			candidate = start
 		}
 		attempts++
-		if alloc, exists := ctx.allocFile.Data.Allocations[strconv.Itoa(portNum)]; exists {
+		alloc, err := ctx.tx.Get(portNum)
+		if err != nil {
+			return 0, err
+		}
+		if alloc != nil {
 			if alloc.Directory == ctx.directory && alloc.Name == name {
 				continue
 			}
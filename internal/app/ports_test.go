@@ -1,7 +1,6 @@
 package app
 
 import (
-	"path/filepath"
 	"testing"
 	"time"
 
@@ -26,27 +25,14 @@ func (m mockChecker) IsFree(port int) bool {
 // newTestContext creates a context for testing with the given config and checker.
 func newTestContext(t *testing.T, cfg config.Config, checker mockChecker) (*context, func()) {
 	t.Helper()
-	tmpDir := t.TempDir()
-	allocPath := filepath.Join(tmpDir, "allocations.json")
-
-	allocFile, err := allocations.OpenLocked(allocPath, true)
-	if err != nil {
-		t.Fatalf("failed to open allocations: %v", err)
-	}
-
 	ctx := &context{
 		config:      cfg,
-		allocFile:   allocFile,
+		tx:          allocations.NewFileTx(allocations.DefaultFile()),
 		logger:      logger.Logger{},
 		directory:   "/test/project",
 		portChecker: checker,
 	}
-
-	cleanup := func() {
-		allocFile.Close()
-	}
-
-	return ctx, cleanup
+	return ctx, func() {}
 }
 
 func TestFindFreePort(t *testing.T) {
@@ -88,7 +74,7 @@ func TestFindFreePort(t *testing.T) {
 		ctx, cleanup := newTestContext(t, cfg, checker)
 		defer cleanup()
 
-		ctx.allocFile.Data.LastIssuedPort = 20001
+		ctx.tx.SetLastIssuedPort(20001)
 
 		port, err := findFreePort(ctx, "main", time.Now())
 		if err != nil {
@@ -113,7 +99,7 @@ func TestFindFreePort(t *testing.T) {
 		ctx, cleanup := newTestContext(t, cfg, checker)
 		defer cleanup()
 
-		ctx.allocFile.Data.LastIssuedPort = 20002
+		ctx.tx.SetLastIssuedPort(20002)
 
 		port, err := findFreePort(ctx, "main", time.Now())
 		if err != nil {
@@ -162,7 +148,7 @@ func TestFindFreePort(t *testing.T) {
 		defer cleanup()
 
 		// Port 20000 is locked by another directory
-		ctx.allocFile.SetAllocation(20000, &allocations.Allocation{
+		ctx.tx.Set(20000, &allocations.Allocation{
 			Directory: "/other/project",
 			Name:      "main",
 			Locked:    true,
@@ -192,7 +178,7 @@ func TestFindFreePort(t *testing.T) {
 		defer cleanup()
 
 		// Port 20000 is allocated to another directory
-		ctx.allocFile.SetAllocation(20000, &allocations.Allocation{
+		ctx.tx.Set(20000, &allocations.Allocation{
 			Directory:  "/other/project",
 			Name:       "main",
 			AssignedAt: time.Now(),
@@ -223,7 +209,7 @@ func TestFindFreePort(t *testing.T) {
 
 		// Port 20000 is allocated to this directory with same name - but this is checked elsewhere
 		// findFreePort actually skips it - the reuse logic is in GetPort
-		ctx.allocFile.SetAllocation(20000, &allocations.Allocation{
+		ctx.tx.Set(20000, &allocations.Allocation{
 			Directory:  ctx.directory,
 			Name:       "main",
 			AssignedAt: time.Now(),
@@ -292,7 +278,7 @@ func TestFindFreePort(t *testing.T) {
 		defer cleanup()
 
 		// Port 20000 was recently allocated to another directory
-		ctx.allocFile.SetAllocation(20000, &allocations.Allocation{
+		ctx.tx.Set(20000, &allocations.Allocation{
 			Directory:  "/other/project",
 			Name:       "main",
 			AssignedAt: time.Now().Add(-1 * time.Hour), // 1 hour ago, within freeze period
@@ -0,0 +1,206 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/bamorim/portpls/internal/allocations"
+	"github.com/bamorim/portpls/internal/config"
+	"github.com/bamorim/portpls/internal/port"
+)
+
+// PromptOptions configures Prompt.
+type PromptOptions struct {
+	Check     bool   // check each port with TCP to fill in Status
+	CachePath string // where the allocations last read are kept; empty disables the cache
+}
+
+// Prompt returns the allocations of the selected directory for shell prompt
+// segments, which run on every prompt and must finish in a few
+// milliseconds. It never waits for or writes to the allocations store and
+// never creates the config file. Ports are only checked with prompt.Check;
+// otherwise Status is empty. Allocations past their TTL are left out rather
+// than expired.
+//
+// The allocations read are cached at prompt.CachePath and reused while the
+// store's modification time and size stay the same. While another process
+// is writing the store, the cached allocations are used, or none at all.
+func Prompt(opts Options, prompt PromptOptions) ([]AllocationEntry, error) {
+	snap, err := peek(opts, prompt.CachePath)
+	if errors.Is(err, allocations.ErrBusy) {
+		return []AllocationEntry{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	checker := opts.PortChecker
+	if checker == nil {
+		checker = port.TCPChecker{}
+	}
+	entries := []AllocationEntry{}
+	for _, r := range snap.records {
+		if r.Directory != snap.directory {
+			continue
+		}
+		status := ""
+		if prompt.Check {
+			status = StatusBusy
+			if checker.IsFree(r.Port) {
+				status = StatusFree
+			}
+		}
+		entries = append(entries, entryWithStatus(r, status))
+	}
+	return entries, nil
+}
+
+// snapshot is what peek read: the directory selected by the options, its
+// configuration, the store path and the allocations that haven't expired.
+type snapshot struct {
+	directory string
+	config    config.Config
+	store     string
+	records   []allocations.Record
+}
+
+// peek reads every allocation without waiting for or writing to the store,
+// using the cache at cachePath as described for Prompt. It returns
+// allocations.ErrBusy if the store is being written and nothing is cached.
+// Besides the cache, it writes nothing: missing config and allocations files
+// read as defaults and empty, and legacy files are not migrated.
+func peek(opts Options, cachePath string) (snapshot, error) {
+	opts.NoCreate = true
+	resolved := resolvePaths(opts, false)
+	directory, err := opts.Directory.ResolveDirectory()
+	if err != nil {
+		return snapshot{}, err
+	}
+	layered, err := loadLayered(resolved, directory)
+	if err != nil {
+		return snapshot{}, err
+	}
+	snap := snapshot{directory: directory, config: layered.Config, store: StorePath(opts, layered.Config)}
+	records, err := peekRecords(opts, snap.store, cachePath)
+	if err != nil {
+		return snapshot{}, err
+	}
+	ttl, _ := snap.config.TTLDuration()
+	now := time.Now()
+	for _, r := range records {
+		if ttl == 0 || !r.LastUsedAt.Add(ttl).Before(now) {
+			snap.records = append(snap.records, r)
+		}
+	}
+	return snap, nil
+}
+
+// promptCache is the prompt cache file. Stamp identifies the store contents
+// the records were read from.
+type promptCache struct {
+	Store   string               `json:"store"`
+	Stamp   []fileStamp          `json:"stamp"`
+	Records []allocations.Record `json:"records"`
+}
+
+// fileStamp is the modification time and size of a file, zero if it is
+// missing.
+type fileStamp struct {
+	ModTime int64 `json:"mtime"`
+	Size    int64 `json:"size"`
+}
+
+func peekRecords(opts Options, path, cachePath string) ([]allocations.Record, error) {
+	if opts.Store != nil {
+		var records []allocations.Record
+		err := opts.Store.View(func(tx allocations.Tx) error {
+			var err error
+			records, err = tx.Query(allocations.Query{})
+			return err
+		})
+		return records, err
+	}
+	stamp := storeStamp(path)
+	cached, ok := readPromptCache(cachePath)
+	ok = ok && cached.Store == path
+	if ok && slices.Equal(cached.Stamp, stamp) {
+		return cached.Records, nil
+	}
+	records, err := allocations.Peek(path)
+	if errors.Is(err, allocations.ErrBusy) && ok {
+		return cached.Records, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if cachePath != "" {
+		// Best effort: without a cache the next prompt reads the store again.
+		_ = writePromptCache(cachePath, promptCache{Store: path, Stamp: stamp, Records: records})
+	}
+	return records, nil
+}
+
+// StoreFiles returns the files that change when the store at path is
+// written. SQLite commits go to the write-ahead log first, so it is included.
+func StoreFiles(path string) []string {
+	if allocations.IsSQLitePath(path) {
+		return []string{path, path + "-wal"}
+	}
+	return []string{path}
+}
+
+// storeStamp stamps the files holding the store at path.
+func storeStamp(path string) []fileStamp {
+	files := StoreFiles(path)
+	stamp := make([]fileStamp, len(files))
+	for i, file := range files {
+		if info, err := os.Stat(file); err == nil {
+			stamp[i] = fileStamp{ModTime: info.ModTime().UnixNano(), Size: info.Size()}
+		}
+	}
+	return stamp
+}
+
+func readPromptCache(path string) (promptCache, bool) {
+	var cache promptCache
+	if path == "" {
+		return cache, false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cache, false
+	}
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return cache, false
+	}
+	return cache, true
+}
+
+// writePromptCache replaces the cache file atomically, so concurrent
+// prompts never read a partial one.
+func writePromptCache(path string, cache promptCache) error {
+	payload, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".prompt-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+	if _, err := tmp.Write(payload); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,147 @@
+package app
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bamorim/portpls/internal/allocations"
+)
+
+func TestPrompt(t *testing.T) {
+	configPath, allocPath, dir := setupTestEnv(t)
+	writeConfig(t, configPath, 20000, 20010)
+	cachePath := filepath.Join(t.TempDir(), "prompt.json")
+	opts := func(directory string) Options {
+		return Options{
+			ConfigPath:      configPath,
+			AllocationsPath: allocPath,
+			Directory:       SpecificDirectory{Path: directory},
+			PortChecker:     mockChecker{},
+		}
+	}
+	for _, alloc := range []struct{ dir, name string }{{dir, "web"}, {dir, "api"}, {filepath.Join(dir, "other"), "main"}} {
+		if _, err := GetPort(opts(alloc.dir), alloc.name, Metadata{}); err != nil {
+			t.Fatalf("GetPort: %v", err)
+		}
+	}
+	names := func(entries []AllocationEntry) []string {
+		var out []string
+		for _, e := range entries {
+			out = append(out, e.Name)
+		}
+		return out
+	}
+
+	t.Run("lists the directory without checking ports", func(t *testing.T) {
+		entries, err := Prompt(opts(dir), PromptOptions{CachePath: cachePath})
+		if err != nil {
+			t.Fatalf("Prompt: %v", err)
+		}
+		if len(entries) != 2 || entries[0].Name != "web" || entries[1].Name != "api" || entries[0].Status != "" {
+			t.Errorf("entries = %+v", entries)
+		}
+		if _, err := os.Stat(cachePath); err != nil {
+			t.Errorf("cache not written: %v", err)
+		}
+	})
+
+	t.Run("checks ports when asked", func(t *testing.T) {
+		entries, err := Prompt(opts(dir), PromptOptions{Check: true})
+		if err != nil || len(entries) != 2 || entries[0].Status != StatusFree {
+			t.Errorf("Prompt = %+v, %v", entries, err)
+		}
+	})
+
+	t.Run("reuses the cache until the store changes", func(t *testing.T) {
+		cache, ok := readPromptCache(cachePath)
+		if !ok {
+			t.Fatal("cache not readable")
+		}
+		cache.Records = cache.Records[:1]
+		if err := writePromptCache(cachePath, cache); err != nil {
+			t.Fatalf("writePromptCache: %v", err)
+		}
+		entries, _ := Prompt(opts(dir), PromptOptions{CachePath: cachePath})
+		if got := names(entries); len(got) != 1 || got[0] != "web" {
+			t.Errorf("names = %v, want the cached [web]", got)
+		}
+
+		if _, err := GetPort(opts(dir), "db", Metadata{}); err != nil {
+			t.Fatalf("GetPort: %v", err)
+		}
+		entries, _ = Prompt(opts(dir), PromptOptions{CachePath: cachePath})
+		if got := names(entries); len(got) != 3 {
+			t.Errorf("names = %v, want web, api and db", got)
+		}
+	})
+
+	t.Run("does not wait for a writer", func(t *testing.T) {
+		lf, err := allocations.OpenLocked(allocPath, true)
+		if err != nil {
+			t.Fatalf("OpenLocked: %v", err)
+		}
+		defer lf.Close()
+		// A stale stamp makes Prompt read the store, which is locked.
+		later := time.Now().Add(time.Minute)
+		if err := os.Chtimes(allocPath, later, later); err != nil {
+			t.Fatalf("Chtimes: %v", err)
+		}
+
+		entries, err := Prompt(opts(dir), PromptOptions{CachePath: cachePath})
+		if err != nil || len(entries) != 3 {
+			t.Errorf("Prompt = %v, %v; want the 3 cached entries", names(entries), err)
+		}
+		entries, err = Prompt(opts(dir), PromptOptions{})
+		if err != nil || len(entries) != 0 {
+			t.Errorf("Prompt without cache = %v, %v; want none", names(entries), err)
+		}
+	})
+
+	t.Run("never creates files", func(t *testing.T) {
+		tmp := t.TempDir()
+		missing := Options{
+			ConfigPath:      filepath.Join(tmp, "config.json"),
+			AllocationsPath: filepath.Join(tmp, "allocations.json"),
+			Directory:       SpecificDirectory{Path: dir},
+		}
+		entries, err := Prompt(missing, PromptOptions{})
+		if err != nil || len(entries) != 0 {
+			t.Errorf("Prompt = %+v, %v", entries, err)
+		}
+		for _, path := range []string{missing.ConfigPath, missing.AllocationsPath} {
+			if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("%s was created", path)
+			}
+		}
+	})
+
+	t.Run("leaves legacy files alone", func(t *testing.T) {
+		home := t.TempDir()
+		t.Setenv("HOME", home)
+		t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, "xdg-config"))
+		t.Setenv("XDG_DATA_HOME", filepath.Join(home, "xdg-data"))
+		t.Setenv(EnvConfigPath, "")
+		t.Setenv(EnvAllocationsPath, "")
+		legacy := []string{legacyConfigPath(), legacyAllocationsPath()}
+		for _, path := range legacy {
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatalf("failed to create legacy dir: %v", err)
+			}
+			if err := os.WriteFile(path, []byte(`{}`), 0644); err != nil {
+				t.Fatalf("failed to write legacy file: %v", err)
+			}
+		}
+
+		if _, err := Prompt(Options{Directory: SpecificDirectory{Path: dir}}, PromptOptions{}); err != nil {
+			t.Fatalf("Prompt: %v", err)
+		}
+		for _, path := range legacy {
+			if _, err := os.Stat(path); err != nil {
+				t.Errorf("legacy file %s was moved: %v", path, err)
+			}
+		}
+	})
+}
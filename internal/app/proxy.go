@@ -0,0 +1,44 @@
+package app
+
+import (
+	"time"
+
+	"github.com/bamorim/portpls/internal/allocations"
+	"github.com/bamorim/portpls/internal/proxy"
+)
+
+// ProxyOptions configures ProxyRoutes.
+type ProxyOptions struct {
+	ProjectName string // proxy.ProjectFromDirectory or proxy.ProjectFromBranch
+	Domain      string // empty means proxy.DefaultDomain
+}
+
+// ProxyRoutes returns a proxy route for every allocation, with warnings for
+// allocations that got no host name. Expired allocations are left out
+// rather than removed: the store is only read, so calling this from a
+// watcher on the store doesn't cause further change notifications.
+func ProxyRoutes(opts Options, p ProxyOptions) ([]proxy.Route, []string, error) {
+	var targets []proxy.Target
+	err := withContext(opts, false, func(ctx *context) error {
+		records, err := ctx.tx.Query(allocations.Query{})
+		if err != nil {
+			return err
+		}
+		ttl, _ := ctx.config.TTLDuration()
+		now := time.Now()
+		for _, r := range records {
+			if ttl == 0 || !r.LastUsedAt.Add(ttl).Before(now) {
+				targets = append(targets, proxy.Target{Directory: r.Directory, Name: r.Name, Port: r.Port})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	routes, warnings, err := proxy.Routes(targets, p.ProjectName, p.Domain)
+	if err != nil {
+		return nil, nil, NewCodeError(2, err)
+	}
+	return routes, warnings, nil
+}
@@ -0,0 +1,34 @@
+package app
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/bamorim/portpls/internal/proxy"
+)
+
+func TestProxyRoutes(t *testing.T) {
+	configPath, allocPath, dir := setupTestEnv(t)
+	writeConfig(t, configPath, 20000, 20010)
+	opts := Options{
+		ConfigPath:      configPath,
+		AllocationsPath: allocPath,
+		Directory:       SpecificDirectory{Path: dir},
+		PortChecker:     mockChecker{},
+	}
+	if _, err := GetPort(opts, "web", Metadata{}); err != nil {
+		t.Fatalf("GetPort: %v", err)
+	}
+	routes, warnings, err := ProxyRoutes(opts, ProxyOptions{ProjectName: proxy.ProjectFromDirectory})
+	if err != nil {
+		t.Fatalf("ProxyRoutes: %v", err)
+	}
+	host := "web." + filepath.Base(dir) + ".localhost"
+	if len(routes) != 1 || routes[0].Hosts[0] != host || routes[0].Port != 20000 || len(warnings) != 0 {
+		t.Errorf("ProxyRoutes = %+v, %q; want %s on 20000", routes, warnings, host)
+	}
+
+	if _, _, err := ProxyRoutes(opts, ProxyOptions{ProjectName: "nope"}); err == nil {
+		t.Error("expected error for unknown project name source")
+	}
+}
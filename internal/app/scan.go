@@ -2,7 +2,6 @@ package app
 
 import (
 	"fmt"
-	"strconv"
 	"time"
 
 	"github.com/bamorim/portpls/internal/allocations"
@@ -30,7 +29,11 @@ func Scan(opts Options) (ScanResult, error) {
 			if ctx.portChecker.IsFree(portNum) {
 				continue
 			}
-			if _, exists := ctx.allocFile.Data.Allocations[strconv.Itoa(portNum)]; exists {
+			existing, err := ctx.tx.Get(portNum)
+			if err != nil {
+				return err
+			}
+			if existing != nil {
 				result.Lines = append(result.Lines, fmt.Sprintf("Port %d: already allocated", portNum))
 				continue
 			}
@@ -58,17 +61,22 @@ func Scan(opts Options) (ScanResult, error) {
 				LastUsedAt: now,
 				Locked:     false,
 			}
-			ctx.allocFile.SetAllocation(portNum, alloc)
-			if portNum > ctx.allocFile.Data.LastIssuedPort {
-				ctx.allocFile.Data.LastIssuedPort = portNum
+			if err := ctx.tx.Set(portNum, alloc); err != nil {
+				return err
+			}
+			last, err := ctx.tx.LastIssuedPort()
+			if err != nil {
+				return err
+			}
+			if portNum > last {
+				if err := ctx.tx.SetLastIssuedPort(portNum); err != nil {
+					return err
+				}
 			}
 			_ = ctx.logger.Event("ALLOC_ADD", fmt.Sprintf("port=%d dir=%s name=main", portNum, dir))
 			result.Lines = append(result.Lines, fmt.Sprintf("Port %d: used by %s - recorded", portNum, procLabel))
 			added++
 		}
-		if err := ctx.allocFile.Save(); err != nil {
-			return err
-		}
 		result.Added = added
 		return nil
 	})
@@ -0,0 +1,185 @@
+package app
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/bamorim/portpls/internal/allocations"
+)
+
+// AliasLabel is the label marking the allocation that portpls forward sends
+// an alias port to. Its value is the alias port; at most one allocation
+// carries each alias, and an allocation has at most one alias.
+const AliasLabel = "portpls/alias"
+
+// SwitchResult describes the allocation an alias port was switched to.
+type SwitchResult struct {
+	Alias    int
+	Port     int
+	Previous *AllocationEntry // allocation the alias was switched away from, if any
+}
+
+// Switch makes the named allocation of the selected directory the active one
+// for the alias port, allocating it if needed, and takes the alias away from
+// the allocation that had it. With alias 0 it reuses the alias of the
+// allocations with the same name in other directories, so switching a
+// worktree only needs the name.
+func Switch(opts Options, name string, alias int) (SwitchResult, error) {
+	var result SwitchResult
+	err := withContext(opts, true, func(ctx *context) error {
+		now := time.Now().UTC()
+		if alias == 0 {
+			var err error
+			if alias, err = inferAlias(ctx, name); err != nil {
+				return err
+			}
+		}
+		if alias < 1 || alias > 65535 {
+			return NewCodeError(2, fmt.Errorf("invalid alias port %d", alias))
+		}
+		if alias >= ctx.config.PortStart && alias <= ctx.config.PortEnd {
+			// It could be allocated to something else.
+			return NewCodeError(2, fmt.Errorf("alias port %d is in the allocation range %d-%d; choose one outside it", alias, ctx.config.PortStart, ctx.config.PortEnd))
+		}
+		value := strconv.Itoa(alias)
+
+		portNum, alloc, err := allocate(ctx, name, now)
+		if err != nil {
+			return err
+		}
+
+		holders, err := ctx.tx.Query(allocations.Query{Match: func(r allocations.Record) bool {
+			return r.Labels[AliasLabel] == value && r.Port != portNum
+		}})
+		if err != nil {
+			return err
+		}
+		for _, r := range holders {
+			delete(r.Labels, AliasLabel)
+			if len(r.Labels) == 0 {
+				r.Labels = nil
+			}
+			if err := ctx.tx.Set(r.Port, r.Allocation); err != nil {
+				return err
+			}
+			previous := entryWithStatus(r, "")
+			result.Previous = &previous
+		}
+
+		alloc.LastUsedAt = now
+		if alloc.Labels == nil {
+			alloc.Labels = map[string]string{}
+		}
+		alloc.Labels[AliasLabel] = value
+		if err := ctx.tx.Set(portNum, alloc); err != nil {
+			return err
+		}
+		_ = ctx.logger.Event("ALIAS_SWITCH", fmt.Sprintf("alias=%d port=%d dir=%s name=%s", alias, portNum, ctx.directory, name))
+		result.Alias, result.Port = alias, portNum
+		return nil
+	})
+	if err != nil {
+		if err == ErrNoFreePorts {
+			return SwitchResult{}, NewCodeError(1, err)
+		}
+		return SwitchResult{}, err
+	}
+	return result, nil
+}
+
+// inferAlias returns the alias port used by allocations called name.
+func inferAlias(ctx *context, name string) (int, error) {
+	records, err := ctx.tx.Query(allocations.Query{Name: name, Match: func(r allocations.Record) bool {
+		return r.Labels[AliasLabel] != ""
+	}})
+	if err != nil {
+		return 0, err
+	}
+	aliases := map[string]bool{}
+	for _, r := range records {
+		aliases[r.Labels[AliasLabel]] = true
+	}
+	switch len(aliases) {
+	case 0:
+		return 0, NewCodeError(2, fmt.Errorf("no alias port for %q yet; choose one with --port", name))
+	case 1:
+		for value := range aliases {
+			alias, err := strconv.Atoi(value)
+			if err != nil {
+				return 0, NewCodeError(2, fmt.Errorf("invalid %s label %q", AliasLabel, value))
+			}
+			return alias, nil
+		}
+	}
+	return 0, NewCodeError(2, fmt.Errorf("allocations called %q use several alias ports; choose one with --port", name))
+}
+
+// ActiveTarget returns the allocation active for the alias port, or
+// ErrAllocationNotFound if there is none. It only reads the store.
+func ActiveTarget(opts Options, alias int) (AllocationEntry, error) {
+	targets, err := ActiveTargets(opts, []int{alias})
+	if err != nil {
+		return AllocationEntry{}, err
+	}
+	entry, ok := targets[alias]
+	if !ok {
+		return AllocationEntry{}, NewCodeError(1, ErrAllocationNotFound)
+	}
+	return entry, nil
+}
+
+// ActiveTargets returns the allocation active for each of the alias ports
+// that has one, reading the store once. If several allocations carry an
+// alias, the one switched to last wins.
+func ActiveTargets(opts Options, aliases []int) (map[int]AllocationEntry, error) {
+	wanted := map[string]int{}
+	for _, alias := range aliases {
+		wanted[strconv.Itoa(alias)] = alias
+	}
+	targets := map[int]AllocationEntry{}
+	err := withContext(opts, false, func(ctx *context) error {
+		records, err := ctx.tx.Query(allocations.Query{Match: func(r allocations.Record) bool {
+			_, ok := wanted[r.Labels[AliasLabel]]
+			return ok
+		}})
+		if err != nil {
+			return err
+		}
+		sort.SliceStable(records, func(i, j int) bool { return records[i].LastUsedAt.After(records[j].LastUsedAt) })
+		for _, r := range records {
+			alias := wanted[r.Labels[AliasLabel]]
+			if _, ok := targets[alias]; !ok {
+				targets[alias] = entryWithStatus(r, "")
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return targets, nil
+}
+
+// Aliases returns the alias ports in use, in ascending order.
+func Aliases(opts Options) ([]int, error) {
+	seen := map[int]bool{}
+	err := withContext(opts, false, func(ctx *context) error {
+		records, err := ctx.tx.Query(allocations.Query{Match: func(r allocations.Record) bool {
+			return r.Labels[AliasLabel] != ""
+		}})
+		for _, r := range records {
+			if alias, err := strconv.Atoi(r.Labels[AliasLabel]); err == nil {
+				seen[alias] = true
+			}
+		}
+		return err
+	})
+	aliases := make([]int, 0, len(seen))
+	for alias := range seen {
+		aliases = append(aliases, alias)
+	}
+	sort.Ints(aliases)
+	return aliases, err
+}
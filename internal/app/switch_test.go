@@ -0,0 +1,106 @@
+package app
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSwitch(t *testing.T) {
+	configPath, allocPath, dir := setupTestEnv(t)
+	writeConfig(t, configPath, 20000, 20010)
+	optsIn := func(dir string) Options {
+		return Options{
+			ConfigPath:      configPath,
+			AllocationsPath: allocPath,
+			Directory:       SpecificDirectory{Path: dir},
+			PortChecker:     mockChecker{},
+		}
+	}
+	primary, worktree := optsIn(dir), optsIn(filepath.Join(filepath.Dir(dir), "worktree"))
+
+	t.Run("needs a port the first time", func(t *testing.T) {
+		_, err := Switch(primary, "web", 0)
+		var codeErr CodeError
+		if !errors.As(err, &codeErr) || codeErr.Code != 2 {
+			t.Errorf("Switch error = %v, want code 2", err)
+		}
+	})
+
+	t.Run("allocates and marks the allocation", func(t *testing.T) {
+		result, err := Switch(primary, "web", 3000)
+		if err != nil {
+			t.Fatalf("Switch: %v", err)
+		}
+		if result.Alias != 3000 || result.Port != 20000 || result.Previous != nil {
+			t.Errorf("Switch = %+v", result)
+		}
+		entry, err := ActiveTarget(primary, 3000)
+		if err != nil || entry.Port != 20000 || entry.Directory != dir {
+			t.Errorf("ActiveTarget = %+v, %v", entry, err)
+		}
+	})
+
+	t.Run("another worktree takes the alias over", func(t *testing.T) {
+		result, err := Switch(worktree, "web", 0)
+		if err != nil {
+			t.Fatalf("Switch: %v", err)
+		}
+		if result.Alias != 3000 || result.Port != 20001 || result.Previous == nil || result.Previous.Directory != dir {
+			t.Errorf("Switch = %+v", result)
+		}
+		entry, err := ActiveTarget(primary, 3000)
+		if err != nil || entry.Port != 20001 {
+			t.Errorf("ActiveTarget = %+v, %v; want the worktree", entry, err)
+		}
+		labels, err := Label(primary, "web", Metadata{})
+		if err != nil || len(labels.Labels) != 0 {
+			t.Errorf("labels of the previous allocation = %v, %v; want none", labels.Labels, err)
+		}
+	})
+
+	t.Run("aliases", func(t *testing.T) {
+		if _, err := Switch(primary, "api", 4000); err != nil {
+			t.Fatalf("Switch: %v", err)
+		}
+		aliases, err := Aliases(primary)
+		if err != nil || !reflect.DeepEqual(aliases, []int{3000, 4000}) {
+			t.Errorf("Aliases = %v, %v", aliases, err)
+		}
+	})
+
+	t.Run("active targets of several aliases", func(t *testing.T) {
+		targets, err := ActiveTargets(primary, []int{3000, 4000, 5000})
+		if err != nil {
+			t.Fatalf("ActiveTargets: %v", err)
+		}
+		if len(targets) != 2 || targets[3000].Directory != filepath.Join(filepath.Dir(dir), "worktree") || targets[4000].Name != "api" {
+			t.Errorf("ActiveTargets = %+v", targets)
+		}
+	})
+
+	t.Run("forgotten allocations are no longer active", func(t *testing.T) {
+		filter, _ := FilterByDirectory(dir)
+		if _, err := Forget(primary, filter, nil, "api", true, false, nil); err != nil {
+			t.Fatalf("Forget: %v", err)
+		}
+		var codeErr CodeError
+		if _, err := ActiveTarget(primary, 4000); !errors.As(err, &codeErr) || codeErr.Code != 1 {
+			t.Errorf("ActiveTarget error = %v, want code 1", err)
+		}
+	})
+
+	t.Run("invalid port", func(t *testing.T) {
+		if _, err := Switch(primary, "web", 70000); err == nil {
+			t.Error("expected error for an invalid alias port")
+		}
+	})
+
+	t.Run("alias in the allocation range", func(t *testing.T) {
+		var codeErr CodeError
+		if _, err := Switch(primary, "web", 20005); !errors.As(err, &codeErr) || codeErr.Code != 2 {
+			t.Errorf("Switch error = %v, want code 2", err)
+		}
+	})
+}
@@ -0,0 +1,154 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bamorim/portpls/internal/port"
+)
+
+// WaitOptions describes what Wait waits for.
+type WaitOptions struct {
+	Names    []string      // allocations in the selected directory
+	Timeout  time.Duration // zero waits indefinitely
+	Interval time.Duration // time between checks
+	HTTPPath string        // if set, wait for a 2xx response to GET HTTPPath
+	Free     bool          // wait for the ports to be released instead
+}
+
+// WaitResult maps each waited-for name to its port.
+type WaitResult struct {
+	Ports map[string]int
+}
+
+// Wait blocks until the ports allocated to the given names in the selected
+// directory accept TCP connections (or answer HTTPPath with a 2xx status, or
+// are free, depending on wait). It returns a CodeError with code 3 wrapping
+// ErrWaitTimeout when the timeout passes first.
+func Wait(opts Options, wait WaitOptions) (WaitResult, error) {
+	if wait.Free && wait.HTTPPath != "" {
+		return WaitResult{}, NewCodeError(2, fmt.Errorf("--free cannot be combined with --http"))
+	}
+	if len(wait.Names) == 0 {
+		wait.Names = []string{"main"}
+	}
+	if wait.Interval <= 0 {
+		wait.Interval = 250 * time.Millisecond
+	}
+	result := WaitResult{Ports: map[string]int{}}
+	var checker port.Checker
+	err := withContext(opts, false, func(ctx *context) error {
+		for _, name := range wait.Names {
+			portNum, alloc, err := ctx.tx.Find(ctx.directory, name)
+			if err != nil {
+				return err
+			}
+			if alloc == nil {
+				return fmt.Errorf("%w: '%s' in %s", ErrAllocationNotFound, name, ctx.directory)
+			}
+			result.Ports[name] = portNum
+		}
+		checker = ctx.portChecker
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, ErrAllocationNotFound) {
+			return WaitResult{}, NewCodeError(1, err)
+		}
+		return WaitResult{}, err
+	}
+
+	ready := acceptsTCP
+	switch {
+	case wait.Free:
+		ready = func(portNum int, _ time.Duration) bool { return checker.IsFree(portNum) }
+	case wait.HTTPPath != "":
+		ready = func(portNum int, timeout time.Duration) bool { return respondsHTTP(portNum, wait.HTTPPath, timeout) }
+	}
+
+	var deadline time.Time
+	if wait.Timeout > 0 {
+		deadline = time.Now().Add(wait.Timeout)
+	}
+	pending := append([]string(nil), wait.Names...)
+	for {
+		remaining := pending[:0]
+		for _, name := range pending {
+			if !ready(result.Ports[name], probeTimeout(deadline)) {
+				remaining = append(remaining, name)
+			}
+		}
+		pending = remaining
+		if len(pending) == 0 {
+			return result, nil
+		}
+		sleep := wait.Interval
+		if !deadline.IsZero() {
+			left := time.Until(deadline)
+			if left <= 0 {
+				waiting := make([]string, len(pending))
+				for i, name := range pending {
+					waiting[i] = fmt.Sprintf("%s (port %d)", name, result.Ports[name])
+				}
+				return result, NewCodeError(3, fmt.Errorf("%w after %s waiting for %s", ErrWaitTimeout, wait.Timeout, strings.Join(waiting, ", ")))
+			}
+			// Check once more at the deadline rather than giving up early.
+			sleep = min(sleep, left)
+		}
+		time.Sleep(sleep)
+	}
+}
+
+// Limits on a single check. Checks never run past the deadline, except for
+// minProbeTimeout so that the last check at the deadline can still connect.
+const (
+	tcpProbeTimeout  = time.Second
+	httpProbeTimeout = 2 * time.Second
+	minProbeTimeout  = 50 * time.Millisecond
+)
+
+// probeTimeout returns how long the next check may take: the time left
+// until deadline, or the checks' own limit if there is no deadline.
+func probeTimeout(deadline time.Time) time.Duration {
+	if deadline.IsZero() {
+		return 0
+	}
+	return max(time.Until(deadline), minProbeTimeout)
+}
+
+// acceptsTCP reports whether the port accepts connections within timeout,
+// capped at tcpProbeTimeout; zero means tcpProbeTimeout.
+func acceptsTCP(portNum int, timeout time.Duration) bool {
+	if timeout <= 0 || timeout > tcpProbeTimeout {
+		timeout = tcpProbeTimeout
+	}
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort("localhost", strconv.Itoa(portNum)), timeout)
+	if err != nil {
+		return false
+	}
+	_ = conn.Close()
+	return true
+}
+
+// respondsHTTP reports whether GET path answers with a 2xx status within
+// timeout, capped at httpProbeTimeout; zero means httpProbeTimeout.
+func respondsHTTP(portNum int, path string, timeout time.Duration) bool {
+	if timeout <= 0 || timeout > httpProbeTimeout {
+		timeout = httpProbeTimeout
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Get(fmt.Sprintf("http://localhost:%d%s", portNum, path))
+	if err != nil {
+		return false
+	}
+	_ = resp.Body.Close()
+	return resp.StatusCode >= 200 && resp.StatusCode < 300
+}
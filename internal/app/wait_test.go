@@ -0,0 +1,139 @@
+package app
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestWait(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer listener.Close()
+	portNum := listener.Addr().(*net.TCPAddr).Port
+
+	configPath, allocPath, dir := setupTestEnv(t)
+	writeConfig(t, configPath, portNum, portNum+1)
+	opts := func(freePorts map[int]bool) Options {
+		return Options{
+			ConfigPath:      configPath,
+			AllocationsPath: allocPath,
+			Directory:       SpecificDirectory{Path: dir},
+			PortChecker:     mockChecker{freePorts: freePorts},
+		}
+	}
+	if got, err := GetPort(opts(nil), "api", Metadata{}); err != nil || got != portNum {
+		t.Fatalf("GetPort = %d, %v; want %d", got, err, portNum)
+	}
+	closed, err := GetPort(opts(nil), "web", Metadata{})
+	if err != nil {
+		t.Fatalf("GetPort: %v", err)
+	}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" {
+			http.NotFound(w, r)
+		}
+	}))
+	server.Listener.Close()
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+
+	short := 50 * time.Millisecond
+	tests := []struct {
+		name      string
+		wait      WaitOptions
+		freePorts map[int]bool
+		wantErr   error
+	}{
+		{name: "accepts connections", wait: WaitOptions{Names: []string{"api"}, Timeout: time.Second}},
+		{name: "http 2xx", wait: WaitOptions{Names: []string{"api"}, HTTPPath: "/healthz", Timeout: time.Second}},
+		{name: "http not 2xx", wait: WaitOptions{Names: []string{"api"}, HTTPPath: "missing", Timeout: short, Interval: 10 * time.Millisecond}, wantErr: ErrWaitTimeout},
+		{name: "one of several down", wait: WaitOptions{Names: []string{"api", "web"}, Timeout: short, Interval: 10 * time.Millisecond}, wantErr: ErrWaitTimeout},
+		{name: "free", wait: WaitOptions{Names: []string{"web"}, Free: true, Timeout: time.Second}, freePorts: map[int]bool{closed: true}},
+		{name: "not free", wait: WaitOptions{Names: []string{"web"}, Free: true, Timeout: short, Interval: 10 * time.Millisecond}, freePorts: map[int]bool{}, wantErr: ErrWaitTimeout},
+		{name: "unknown name", wait: WaitOptions{Names: []string{"db"}, Timeout: short}, wantErr: ErrAllocationNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Wait(opts(tt.freePorts), tt.wait)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Wait: %v", err)
+			}
+			for _, name := range tt.wait.Names {
+				if result.Ports[name] == 0 {
+					t.Errorf("no port reported for %s", name)
+				}
+			}
+		})
+	}
+
+	t.Run("timeout exit code", func(t *testing.T) {
+		_, err := Wait(opts(nil), WaitOptions{Names: []string{"web"}, Timeout: short})
+		var codeErr CodeError
+		if !errors.As(err, &codeErr) || codeErr.Code != 3 {
+			t.Errorf("error = %v, want exit code 3", err)
+		}
+	})
+
+	t.Run("checks again at the deadline", func(t *testing.T) {
+		late, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listen: %v", err)
+		}
+		latePort := late.Addr().(*net.TCPAddr).Port
+		late.Close()
+		configPath, allocPath, dir := setupTestEnv(t)
+		writeConfig(t, configPath, latePort, latePort)
+		lateOpts := Options{ConfigPath: configPath, AllocationsPath: allocPath, Directory: SpecificDirectory{Path: dir}, PortChecker: mockChecker{}}
+		if _, err := GetPort(lateOpts, "main", Metadata{}); err != nil {
+			t.Fatalf("GetPort: %v", err)
+		}
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			if l, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(latePort))); err == nil {
+				t.Cleanup(func() { l.Close() })
+			}
+		}()
+		// The interval is longer than the timeout, so only a check at the
+		// deadline sees the port open.
+		if _, err := Wait(lateOpts, WaitOptions{Timeout: 300 * time.Millisecond, Interval: time.Minute}); err != nil {
+			t.Errorf("Wait: %v", err)
+		}
+	})
+
+	t.Run("checks stop at the deadline", func(t *testing.T) {
+		hang := make(chan struct{})
+		slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { <-hang }))
+		defer slow.Close()
+		defer close(hang)
+		slowPort := slow.Listener.Addr().(*net.TCPAddr).Port
+		configPath, allocPath, dir := setupTestEnv(t)
+		writeConfig(t, configPath, slowPort, slowPort)
+		slowOpts := Options{ConfigPath: configPath, AllocationsPath: allocPath, Directory: SpecificDirectory{Path: dir}, PortChecker: mockChecker{}}
+		if _, err := GetPort(slowOpts, "main", Metadata{}); err != nil {
+			t.Fatalf("GetPort: %v", err)
+		}
+		start := time.Now()
+		_, err := Wait(slowOpts, WaitOptions{HTTPPath: "/", Timeout: 200 * time.Millisecond})
+		if !errors.Is(err, ErrWaitTimeout) {
+			t.Fatalf("error = %v, want ErrWaitTimeout", err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("Wait took %v with a 200ms timeout", elapsed)
+		}
+	})
+}
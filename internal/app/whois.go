@@ -0,0 +1,94 @@
+package app
+
+import (
+	"fmt"
+
+	"github.com/bamorim/portpls/internal/allocations"
+	"github.com/bamorim/portpls/internal/docker"
+	"github.com/bamorim/portpls/internal/process"
+)
+
+// Port states reported by Whois.
+const (
+	WhoisAllocatedBusy   = "allocated-busy"
+	WhoisAllocatedFree   = "allocated-free"
+	WhoisUnallocatedBusy = "unallocated-busy"
+	WhoisFree            = "free"
+)
+
+// Holder lookups, replaced in tests.
+var (
+	findProcess   = process.FindByPort
+	findContainer = docker.FindContainerByPort
+)
+
+// WhoisResult describes who owns a port: its allocation, if any, and the
+// process and container currently listening on it, if any.
+type WhoisResult struct {
+	Port       int               `json:"port"`
+	State      string            `json:"state"`
+	Allocation *AllocationEntry  `json:"allocation"`
+	Process    *process.Info     `json:"process"`
+	Container  *docker.Container `json:"container"`
+}
+
+// ExitCode distinguishes the port states for scripts: 0 allocated and busy,
+// 3 allocated and free, 4 unallocated but busy, 5 free. Codes 1 and 2 stay
+// reserved for errors.
+func (r WhoisResult) ExitCode() int {
+	switch r.State {
+	case WhoisAllocatedFree:
+		return 3
+	case WhoisUnallocatedBusy:
+		return 4
+	case WhoisFree:
+		return 5
+	default:
+		return 0
+	}
+}
+
+// Whois looks up the allocation for portNum and, when the port is in use,
+// the process and docker container holding it. Lookup failures only leave
+// the holder details empty.
+func Whois(opts Options, portNum int) (WhoisResult, error) {
+	if portNum < 1 || portNum > 65535 {
+		return WhoisResult{}, NewCodeError(2, fmt.Errorf("%w: %d is not a valid port", ErrInvalidPortRange, portNum))
+	}
+	result := WhoisResult{Port: portNum}
+	err := withContext(opts, false, func(ctx *context) error {
+		alloc, err := ctx.tx.Get(portNum)
+		if err != nil {
+			return err
+		}
+		busy := !ctx.portChecker.IsFree(portNum)
+		if alloc != nil {
+			entry := newEntry(ctx, allocations.Record{Port: portNum, Allocation: alloc})
+			result.Allocation = &entry
+			busy = entry.Status == StatusBusy
+		}
+		switch {
+		case alloc != nil && busy:
+			result.State = WhoisAllocatedBusy
+		case alloc != nil:
+			result.State = WhoisAllocatedFree
+		case busy:
+			result.State = WhoisUnallocatedBusy
+		default:
+			result.State = WhoisFree
+		}
+		return nil
+	})
+	if err != nil {
+		return WhoisResult{}, NewCodeError(1, err)
+	}
+	if result.State == WhoisAllocatedBusy || result.State == WhoisUnallocatedBusy {
+		if info, err := findProcess(portNum); err == nil {
+			result.Process = info
+		}
+		if container, err := findContainer(portNum); err == nil {
+			result.Container = container
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,82 @@
+package app
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bamorim/portpls/internal/docker"
+	"github.com/bamorim/portpls/internal/process"
+)
+
+func TestWhois(t *testing.T) {
+	configPath, allocPath, dir := setupTestEnv(t)
+	writeConfig(t, configPath, 20000, 20010)
+
+	findProcess = func(port int) (*process.Info, error) {
+		return &process.Info{PID: 42, Command: "node", User: "alice"}, nil
+	}
+	findContainer = func(port int) (*docker.Container, error) {
+		return nil, errors.New("no docker container matched")
+	}
+	t.Cleanup(func() {
+		findProcess = process.FindByPort
+		findContainer = docker.FindContainerByPort
+	})
+
+	opts := func(freePorts map[int]bool) Options {
+		return Options{
+			ConfigPath:      configPath,
+			AllocationsPath: allocPath,
+			Directory:       SpecificDirectory{Path: dir},
+			PortChecker:     mockChecker{freePorts: freePorts},
+		}
+	}
+	allocated, err := GetPort(opts(nil), "web", Metadata{})
+	if err != nil {
+		t.Fatalf("GetPort: %v", err)
+	}
+	other := allocated + 1
+
+	tests := []struct {
+		name      string
+		port      int
+		freePorts map[int]bool
+		state     string
+		code      int
+		process   bool
+	}{
+		{"allocated and busy", allocated, map[int]bool{}, WhoisAllocatedBusy, 0, true},
+		{"allocated and free", allocated, nil, WhoisAllocatedFree, 3, false},
+		{"unallocated but busy", other, map[int]bool{}, WhoisUnallocatedBusy, 4, true},
+		{"free", other, nil, WhoisFree, 5, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Whois(opts(tt.freePorts), tt.port)
+			if err != nil {
+				t.Fatalf("Whois: %v", err)
+			}
+			if result.State != tt.state || result.ExitCode() != tt.code {
+				t.Errorf("state = %s (exit %d), want %s (exit %d)", result.State, result.ExitCode(), tt.state, tt.code)
+			}
+			if (result.Allocation != nil) != (tt.port == allocated) {
+				t.Errorf("allocation = %+v", result.Allocation)
+			}
+			if result.Allocation != nil && (result.Allocation.Name != "web" || result.Allocation.Directory != dir) {
+				t.Errorf("allocation = %+v, want web in %s", result.Allocation, dir)
+			}
+			if (result.Process != nil) != tt.process {
+				t.Errorf("process = %+v, want lookup %v", result.Process, tt.process)
+			}
+			if result.Container != nil {
+				t.Errorf("container = %+v, want none", result.Container)
+			}
+		})
+	}
+
+	t.Run("invalid port", func(t *testing.T) {
+		if _, err := Whois(opts(nil), 70000); !errors.Is(err, ErrInvalidPortRange) {
+			t.Errorf("error = %v, want ErrInvalidPortRange", err)
+		}
+	})
+}
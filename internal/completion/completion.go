@@ -0,0 +1,149 @@
+// Package completion computes shell completion candidates for the hidden
+// __complete command and generates the scripts that call it.
+package completion
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// Command is the name of the hidden command the completion scripts call.
+const Command = "__complete"
+
+// Request describes the word being completed, for completing values that
+// depend on allocations or configuration.
+type Request struct {
+	Command []string          // subcommand path, e.g. ["config", "unset"]
+	Flags   map[string]string // values of the flags typed so far, by long name
+	Args    []string          // positional arguments before the current word
+	Flag    string            // long name of the flag whose value is completed, if any
+}
+
+// Complete returns the candidates for the last of words, the arguments typed
+// after the program name. Subcommands and flags come from app; values asks
+// for flag values and positional arguments.
+func Complete(app *cli.App, words []string, values func(Request) []string) []string {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	req := Request{Flags: map[string]string{}}
+	commands := app.Commands
+	flags := append([]cli.Flag{}, app.Flags...)
+	current := words[len(words)-1]
+
+	for i := 0; i < len(words)-1; i++ {
+		word := words[i]
+		if strings.HasPrefix(word, "-") && word != "-" && word != "--" {
+			name, value, hasValue := strings.Cut(strings.TrimLeft(word, "-"), "=")
+			flag := lookupFlag(flags, name)
+			if flag == nil || !takesValue(flag) {
+				continue
+			}
+			long := flag.Names()[0]
+			next := i + 1
+			if !hasValue && next < len(words)-1 && words[next] == "=" {
+				next++ // bash splits --name=value into three words
+			}
+			switch {
+			case hasValue:
+				req.Flags[long] = value
+			case next < len(words)-1:
+				req.Flags[long] = words[next]
+				i = next
+			default:
+				req.Flag = long
+				i = next - 1
+			}
+			continue
+		}
+		if len(req.Args) == 0 {
+			if cmd := lookupCommand(commands, word); cmd != nil {
+				req.Command = append(req.Command, cmd.Name)
+				commands = cmd.Subcommands
+				flags = append(flags, cmd.Flags...)
+				continue
+			}
+		}
+		req.Args = append(req.Args, word)
+	}
+	if current == "=" && req.Flag != "" {
+		current = ""
+	}
+
+	var candidates []string
+	switch {
+	case req.Flag != "":
+		candidates = values(req)
+	case strings.HasPrefix(current, "--") && strings.Contains(current, "="):
+		name, value, _ := strings.Cut(strings.TrimPrefix(current, "--"), "=")
+		if flag := lookupFlag(flags, name); flag != nil && takesValue(flag) {
+			req.Flag = flag.Names()[0]
+			for _, v := range values(req) {
+				candidates = append(candidates, "--"+name+"="+v)
+			}
+			current = "--" + name + "=" + value
+		}
+	case strings.HasPrefix(current, "-"):
+		for _, flag := range flags {
+			if isHidden(flag) {
+				continue
+			}
+			candidates = append(candidates, "--"+flag.Names()[0])
+		}
+	default:
+		if len(req.Args) == 0 {
+			for _, cmd := range commands {
+				if !cmd.Hidden {
+					candidates = append(candidates, cmd.Name)
+				}
+			}
+		}
+		candidates = append(candidates, values(req)...)
+	}
+	return filter(candidates, current)
+}
+
+func filter(candidates []string, prefix string) []string {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, c := range candidates {
+		if strings.HasPrefix(c, prefix) && !seen[c] {
+			seen[c] = true
+			out = append(out, c)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func lookupCommand(commands []*cli.Command, name string) *cli.Command {
+	for _, cmd := range commands {
+		if cmd.HasName(name) {
+			return cmd
+		}
+	}
+	return nil
+}
+
+func lookupFlag(flags []cli.Flag, name string) cli.Flag {
+	for _, flag := range flags {
+		for _, n := range flag.Names() {
+			if n == name {
+				return flag
+			}
+		}
+	}
+	return nil
+}
+
+func takesValue(flag cli.Flag) bool {
+	f, ok := flag.(cli.DocGenerationFlag)
+	return ok && f.TakesValue()
+}
+
+func isHidden(flag cli.Flag) bool {
+	f, ok := flag.(cli.VisibleFlag)
+	return ok && !f.IsVisible()
+}
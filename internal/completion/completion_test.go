@@ -0,0 +1,82 @@
+package completion
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+func testApp() *cli.App {
+	return &cli.App{
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "config"},
+			&cli.BoolFlag{Name: "verbose"},
+		},
+		Commands: []*cli.Command{
+			{Name: "get", Flags: []cli.Flag{&cli.StringFlag{Name: "name", Aliases: []string{"n"}}}},
+			{Name: "forget", Flags: []cli.Flag{
+				&cli.StringFlag{Name: "name", Aliases: []string{"n"}},
+				&cli.StringFlag{Name: "directory"},
+				&cli.BoolFlag{Name: "all"},
+			}},
+			{Name: "config", Subcommands: []*cli.Command{{Name: "unset"}, {Name: "describe"}}},
+			{Name: Command, Hidden: true},
+		},
+	}
+}
+
+// values echoes the request so tests can check what Complete parsed.
+func values(req Request) []string {
+	switch req.Flag {
+	case "name":
+		return []string{"main", "web", "dir=" + req.Flags["directory"]}
+	case "directory":
+		return []string{"/work/a", "/work/b"}
+	case "":
+		return []string{"arg" + strings.Join(append([]string{strings.Join(req.Command, "/")}, req.Args...), ":")}
+	}
+	return nil
+}
+
+func TestComplete(t *testing.T) {
+	tests := []struct {
+		name  string
+		words []string
+		want  []string
+	}{
+		{"commands", []string{""}, []string{"arg", "config", "forget", "get"}},
+		{"command prefix", []string{"f"}, []string{"forget"}},
+		{"flags", []string{"forget", "--"}, []string{"--all", "--config", "--directory", "--name", "--verbose"}},
+		{"flag value", []string{"forget", "--name", ""}, []string{"dir=", "main", "web"}},
+		{"short flag value", []string{"get", "-n", "w"}, []string{"web"}},
+		{"uses earlier flags", []string{"forget", "--directory", "/work/b", "--name", "d"}, []string{"dir=/work/b"}},
+		{"inline value", []string{"forget", "--directory=/work/a", "--name=m"}, []string{"--name=main"}},
+		{"bash split value", []string{"forget", "--name", "=", "w"}, []string{"web"}},
+		{"bool flags take no value", []string{"--verbose", "g"}, []string{"get"}},
+		{"subcommands", []string{"config", "u"}, []string{"unset"}},
+		{"positional args", []string{"config", "storage", ""}, []string{"argconfig:storage"}},
+		{"nested command", []string{"config", "unset", ""}, []string{"argconfig/unset"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Complete(testApp(), tt.words, values); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Complete(%q) = %q, want %q", tt.words, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScript(t *testing.T) {
+	for _, shell := range Shells {
+		script, err := Script(shell)
+		if err != nil || !strings.Contains(script, Command) {
+			t.Errorf("Script(%s) = %q, %v", shell, script, err)
+		}
+	}
+	if _, err := Script("tcsh"); !errors.Is(err, ErrUnknownShell) {
+		t.Errorf("error = %v, want ErrUnknownShell", err)
+	}
+}
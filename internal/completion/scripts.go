@@ -0,0 +1,61 @@
+package completion
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrUnknownShell is returned by Script for shells without a script.
+var ErrUnknownShell = errors.New("unknown shell")
+
+// Shells lists the shells Script supports.
+var Shells = []string{"bash", "zsh", "fish"}
+
+// Script returns the completion script for shell. Each script passes the
+// words typed so far to "portpls __complete --" and offers its output, one
+// candidate per line.
+func Script(shell string) (string, error) {
+	switch shell {
+	case "bash":
+		return bashScript, nil
+	case "zsh":
+		return zshScript, nil
+	case "fish":
+		return fishScript, nil
+	}
+	return "", fmt.Errorf("%w: %s (want bash, zsh or fish)", ErrUnknownShell, shell)
+}
+
+const bashScript = `# portpls completion for bash. Add to ~/.bashrc:
+#   source <(portpls completion bash)
+_portpls() {
+    local IFS=$'\n'
+    COMPREPLY=($(portpls __complete -- "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null))
+}
+complete -o default -F _portpls portpls
+`
+
+const zshScript = `#compdef portpls
+# portpls completion for zsh. Add to ~/.zshrc:
+#   source <(portpls completion zsh)
+_portpls() {
+    local -a candidates
+    candidates=(${(f)"$(portpls __complete -- "${(@)words[2,CURRENT]}" 2>/dev/null)"})
+    if (( ${#candidates} )); then
+        compadd -Q -- "${candidates[@]}"
+    else
+        _files
+    fi
+}
+compdef _portpls portpls
+`
+
+const fishScript = `# portpls completion for fish. Add to ~/.config/fish/config.fish:
+#   portpls completion fish | source
+function __portpls_complete
+    set -l tokens (commandline -opc)
+    set -l current (commandline -ct)
+    portpls __complete -- $tokens[2..-1] "$current" 2>/dev/null
+end
+complete -c portpls -f -a '(__portpls_complete)'
+`
@@ -0,0 +1,240 @@
+// Package compose reads the published ports of Docker Compose services and
+// writes the override file that moves them to allocated ports.
+package compose
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileNames are the compose files looked for in a directory, in the order
+// Docker Compose prefers them.
+var FileNames = []string{"compose.yaml", "compose.yml", "docker-compose.yaml", "docker-compose.yml"}
+
+// ErrNoComposeFile is returned by Find when a directory has no compose file.
+var ErrNoComposeFile = errors.New("no compose file found")
+
+// Find returns the compose file in dir.
+func Find(dir string) (string, error) {
+	for _, name := range FileNames {
+		path := filepath.Join(dir, name)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("%w in %s (looked for %s)", ErrNoComposeFile, dir, strings.Join(FileNames, ", "))
+}
+
+// OverridePath returns the override file Docker Compose loads by default
+// next to file: compose.yaml has compose.override.yaml and so on.
+func OverridePath(file string) string {
+	ext := filepath.Ext(file)
+	return strings.TrimSuffix(file, ext) + ".override" + ext
+}
+
+// ProjectName returns a compose project name unique to dir, so separate
+// checkouts and worktrees of a project don't share containers, networks
+// and volumes: the directory name followed by a hash of its path.
+func ProjectName(dir string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(filepath.Base(dir)) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_' || r == '-':
+			b.WriteRune(r)
+		default:
+			b.WriteByte('-')
+		}
+	}
+	base := strings.TrimLeft(b.String(), "_-")
+	sum := sha256.Sum256([]byte(dir))
+	hash := hex.EncodeToString(sum[:])[:8]
+	if base == "" {
+		return "portpls-" + hash
+	}
+	return base + "-" + hash
+}
+
+// Service is a compose service and the ports it publishes.
+type Service struct {
+	Name string
+	// Allocation is the allocation name from the service's x-portpls
+	// extension, or the service name.
+	Allocation string
+	Ports      []Port
+}
+
+// Port is a published port in compose's short syntax parts.
+type Port struct {
+	HostIP    string
+	Published string // host port or range; empty lets Docker pick one
+	Target    string // container port or range
+	Protocol  string // empty means tcp
+}
+
+// IsRange reports whether the port maps a range, which portpls leaves alone.
+func (p Port) IsRange() bool {
+	return strings.Contains(p.Target, "-")
+}
+
+// String formats p in compose's short syntax.
+func (p Port) String() string {
+	s := p.Target
+	if p.Published != "" {
+		s = p.Published + ":" + s
+	}
+	if p.HostIP != "" {
+		ip := p.HostIP
+		if strings.Contains(ip, ":") {
+			ip = "[" + ip + "]"
+		}
+		s = ip + ":" + s
+	}
+	if p.Protocol != "" {
+		s += "/" + p.Protocol
+	}
+	return s
+}
+
+// Parse reads the services of a compose file that publish ports, ordered by
+// name.
+func Parse(data []byte) ([]Service, error) {
+	var doc struct {
+		Services map[string]struct {
+			Ports   []Port    `yaml:"ports"`
+			Portpls yaml.Node `yaml:"x-portpls"`
+		} `yaml:"services"`
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	var services []Service
+	for name, svc := range doc.Services {
+		if len(svc.Ports) == 0 {
+			continue
+		}
+		allocation, err := allocationName(name, svc.Portpls)
+		if err != nil {
+			return nil, err
+		}
+		services = append(services, Service{Name: name, Allocation: allocation, Ports: svc.Ports})
+	}
+	sort.Slice(services, func(i, j int) bool { return services[i].Name < services[j].Name })
+	return services, nil
+}
+
+// allocationName reads the x-portpls extension of a service, either the
+// allocation name or a mapping with a name key.
+func allocationName(service string, ext yaml.Node) (string, error) {
+	var name string
+	switch ext.Kind {
+	case 0:
+		return service, nil
+	case yaml.ScalarNode:
+		name = ext.Value
+	case yaml.MappingNode:
+		var fields struct {
+			Name string `yaml:"name"`
+		}
+		if err := ext.Decode(&fields); err != nil {
+			return "", fmt.Errorf("service %s: x-portpls: %w", service, err)
+		}
+		name = fields.Name
+	}
+	if name = strings.TrimSpace(name); name == "" {
+		return "", fmt.Errorf("service %s: x-portpls must be an allocation name or have a name key", service)
+	}
+	return name, nil
+}
+
+// UnmarshalYAML reads a port in the short ("127.0.0.1:8080:80/tcp") or
+// long (target, published, host_ip, protocol) syntax.
+func (p *Port) UnmarshalYAML(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		parsed, err := ParsePort(node.Value)
+		if err != nil {
+			return err
+		}
+		*p = parsed
+		return nil
+	case yaml.MappingNode:
+		var long struct {
+			Target    yaml.Node `yaml:"target"`
+			Published yaml.Node `yaml:"published"`
+			HostIP    string    `yaml:"host_ip"`
+			Protocol  string    `yaml:"protocol"`
+		}
+		if err := node.Decode(&long); err != nil {
+			return err
+		}
+		if long.Target.Value == "" {
+			return fmt.Errorf("line %d: port has no target", node.Line)
+		}
+		*p = Port{HostIP: long.HostIP, Published: long.Published.Value, Target: long.Target.Value, Protocol: long.Protocol}
+		return nil
+	}
+	return fmt.Errorf("line %d: invalid port", node.Line)
+}
+
+// ParsePort parses compose's short port syntax,
+// [[HOST_IP:]PUBLISHED:]TARGET[/PROTOCOL].
+func ParsePort(s string) (Port, error) {
+	var p Port
+	rest := strings.TrimSpace(s)
+	if before, protocol, ok := strings.Cut(rest, "/"); ok {
+		rest, p.Protocol = before, protocol
+	}
+	i := lastColon(rest)
+	p.Target = rest[i+1:]
+	if i >= 0 {
+		rest = rest[:i]
+		j := lastColon(rest)
+		p.Published = rest[j+1:]
+		if j >= 0 {
+			p.HostIP = strings.Trim(rest[:j], "[]")
+		}
+	}
+	if p.Target == "" || !isPortOrRange(p.Target) {
+		return Port{}, fmt.Errorf("invalid port %q", s)
+	}
+	return p, nil
+}
+
+// lastColon returns the index of the last colon in s outside of ${...}
+// interpolations, or -1.
+func lastColon(s string) int {
+	depth := 0
+	for i := len(s) - 1; i >= 0; i-- {
+		switch s[i] {
+		case '}':
+			depth++
+		case '{':
+			if depth > 0 {
+				depth--
+			}
+		case ':':
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func isPortOrRange(s string) bool {
+	for _, part := range strings.SplitN(s, "-", 2) {
+		if n, err := strconv.Atoi(part); err != nil || n < 1 || n > 65535 {
+			return false
+		}
+	}
+	return true
+}
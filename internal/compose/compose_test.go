@@ -0,0 +1,174 @@
+package compose
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsePort(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Port
+		wantErr bool
+	}{
+		{"3000", Port{Target: "3000"}, false},
+		{"8080:80", Port{Published: "8080", Target: "80"}, false},
+		{"127.0.0.1:8080:80/udp", Port{HostIP: "127.0.0.1", Published: "8080", Target: "80", Protocol: "udp"}, false},
+		{"127.0.0.1::80", Port{HostIP: "127.0.0.1", Target: "80"}, false},
+		{"[::1]:8080:80", Port{HostIP: "::1", Published: "8080", Target: "80"}, false},
+		{"${WEB_PORT:-3000}:3000", Port{Published: "${WEB_PORT:-3000}", Target: "3000"}, false},
+		{"9000-9002:9000-9002", Port{Published: "9000-9002", Target: "9000-9002"}, false},
+		{"8080:http", Port{}, true},
+		{"", Port{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParsePort(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePort(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParsePort(%q) = %+v, want %+v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPortString(t *testing.T) {
+	p := Port{HostIP: "::1", Published: "20000", Target: "80", Protocol: "udp"}
+	if got := p.String(); got != "[::1]:20000:80/udp" {
+		t.Errorf("String() = %q", got)
+	}
+}
+
+func TestParse(t *testing.T) {
+	services, err := Parse([]byte(`
+services:
+  web:
+    image: nginx
+    ports:
+      - "8080:80"
+      - 9229
+  api:
+    x-portpls: backend
+    ports:
+      - target: 4000
+        published: "4000"
+        host_ip: 127.0.0.1
+  db:
+    x-portpls:
+      name: postgres
+    ports: ["5432:5432"]
+  worker:
+    image: worker
+`))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	want := []Service{
+		{Name: "api", Allocation: "backend", Ports: []Port{{HostIP: "127.0.0.1", Published: "4000", Target: "4000"}}},
+		{Name: "db", Allocation: "postgres", Ports: []Port{{Published: "5432", Target: "5432"}}},
+		{Name: "web", Allocation: "web", Ports: []Port{{Published: "8080", Target: "80"}, {Target: "9229"}}},
+	}
+	if !reflect.DeepEqual(services, want) {
+		t.Errorf("Parse = %+v, want %+v", services, want)
+	}
+
+	if _, err := Parse([]byte("services:\n  web:\n    x-portpls: ''\n    ports: [80]\n")); err == nil {
+		t.Error("expected error for empty x-portpls")
+	}
+}
+
+func TestFind(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := Find(dir); err == nil {
+		t.Error("expected error without a compose file")
+	}
+	for _, name := range []string{"docker-compose.yml", "compose.yaml"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("services: {}\n"), 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	if got, err := Find(dir); err != nil || got != filepath.Join(dir, "compose.yaml") {
+		t.Errorf("Find = %q, %v; want compose.yaml first", got, err)
+	}
+	if got := OverridePath("/app/docker-compose.yml"); got != "/app/docker-compose.override.yml" {
+		t.Errorf("OverridePath = %q", got)
+	}
+}
+
+func TestProjectName(t *testing.T) {
+	a := ProjectName("/work/My App")
+	b := ProjectName("/worktrees/feature/My App")
+	if !strings.HasPrefix(a, "my-app-") || !strings.HasPrefix(b, "my-app-") || a == b {
+		t.Errorf("ProjectName = %q and %q, want distinct my-app-<hash> names", a, b)
+	}
+	if got := ProjectName("/work/.hidden"); !strings.HasPrefix(got, "hidden-") {
+		t.Errorf("ProjectName = %q", got)
+	}
+}
+
+func TestOverride(t *testing.T) {
+	o := Override{Project: "app-1234", Services: map[string][]string{
+		"web": {"20000:80", "20001:9229"},
+		"db":  {"127.0.0.1:20002:5432"},
+	}}
+	data := o.Render("/app/compose.yaml")
+	if !IsGenerated(data) || !strings.Contains(string(data), "ports: !override") || !strings.Contains(string(data), "Compose "+MinVersion) {
+		t.Errorf("Render =\n%s", data)
+	}
+	parsed, err := ParseOverride(data)
+	if err != nil {
+		t.Fatalf("ParseOverride: %v", err)
+	}
+	if !reflect.DeepEqual(parsed, o) {
+		t.Errorf("ParseOverride = %+v, want %+v", parsed, o)
+	}
+	if diff := Diff(parsed, o); len(diff) != 0 {
+		t.Errorf("Diff = %v, want none", diff)
+	}
+
+	want := Override{Project: "app-5678", Services: map[string][]string{
+		"web":   {"20000:80", "20003:9229"},
+		"cache": {"20004:6379"},
+	}}
+	wantDiff := []string{
+		`project name is "app-1234", want "app-5678"`,
+		"service cache is missing, want ports [20004:6379]",
+		"service db is no longer in the compose file",
+		"service web publishes [20000:80 20001:9229], want [20000:80 20003:9229]",
+	}
+	if diff := Diff(o, want); !reflect.DeepEqual(diff, wantDiff) {
+		t.Errorf("Diff = %q, want %q", diff, wantDiff)
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "compose.override.yaml")
+	if err := WriteFile(path, []byte("new")); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o644 {
+		t.Errorf("mode = %v, %v; want 0644", info.Mode().Perm(), err)
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(path, []byte("newer")); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "newer" {
+		t.Errorf("content = %q, %v; want newer", data, err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("mode = %v, %v; want the existing 0600 kept", info.Mode().Perm(), err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("temporary files left behind: %v", entries)
+	}
+}
@@ -0,0 +1,152 @@
+package compose
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Header starts every override file written by portpls. Files without it
+// were written by hand and are only replaced when forced.
+const Header = "# Generated by portpls compose"
+
+// MinVersion is the oldest Docker Compose release that understands the
+// !override tag used by Render.
+const MinVersion = "2.24.4"
+
+// Override is the content of a generated override file: the project name
+// and the ports each service publishes instead of those in the compose file.
+type Override struct {
+	Project  string
+	Services map[string][]string // service name to ports in short syntax
+}
+
+// IsGenerated reports whether data is an override file written by portpls.
+func IsGenerated(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(Header))
+}
+
+// Render writes o as YAML. The ports use compose's !override tag so they
+// replace the compose file's ports instead of being added to them; older
+// Compose releases reject the file rather than merging the ports.
+//
+// The project name goes in the top-level name element rather than in
+// COMPOSE_PROJECT_NAME: Compose reads it from the override file for every
+// command run in the directory, without touching the user's .env or shell.
+// COMPOSE_PROJECT_NAME and -p still take precedence over it.
+func (o Override) Render(source string) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s from %s.\n# Run `portpls compose` again instead of editing it.\n", Header, filepath.Base(source))
+	fmt.Fprintf(&b, "# Needs Docker Compose %s or later for !override.\n", MinVersion)
+	fmt.Fprintf(&b, "name: %s\n", quote(o.Project))
+	b.WriteString("services:\n")
+	names := make([]string, 0, len(o.Services))
+	for name := range o.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&b, "  %s:\n    ports: !override\n", quote(name))
+		for _, port := range o.Services[name] {
+			fmt.Fprintf(&b, "      - %s\n", quote(port))
+		}
+	}
+	return b.Bytes()
+}
+
+// ParseOverride reads an override file as written by Render.
+func ParseOverride(data []byte) (Override, error) {
+	var doc struct {
+		Name     string `yaml:"name"`
+		Services map[string]struct {
+			Ports []string `yaml:"ports"`
+		} `yaml:"services"`
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return Override{}, err
+	}
+	o := Override{Project: doc.Name, Services: map[string][]string{}}
+	for name, svc := range doc.Services {
+		o.Services[name] = svc.Ports
+	}
+	return o, nil
+}
+
+// Diff describes how have differs from want, one line per difference.
+func Diff(have, want Override) []string {
+	var out []string
+	if have.Project != want.Project {
+		out = append(out, fmt.Sprintf("project name is %q, want %q", have.Project, want.Project))
+	}
+	names := map[string]bool{}
+	for name := range have.Services {
+		names[name] = true
+	}
+	for name := range want.Services {
+		names[name] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	for _, name := range sorted {
+		havePorts, inHave := have.Services[name]
+		wantPorts, inWant := want.Services[name]
+		switch {
+		case !inHave:
+			out = append(out, fmt.Sprintf("service %s is missing, want ports %v", name, wantPorts))
+		case !inWant:
+			out = append(out, fmt.Sprintf("service %s is no longer in the compose file", name))
+		case !slices.Equal(havePorts, wantPorts):
+			out = append(out, fmt.Sprintf("service %s publishes %v, want %v", name, havePorts, wantPorts))
+		}
+	}
+	return out
+}
+
+// WriteFile replaces the override file at path with data through a
+// temporary file and a rename, so a compose command started meanwhile reads
+// either the old file or the new one. An existing file keeps its mode.
+func WriteFile(path string, data []byte) error {
+	mode := fs.FileMode(0o644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// quote writes s as a JSON string, which is a valid YAML double-quoted
+// scalar.
+func quote(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
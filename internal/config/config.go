@@ -1,11 +1,13 @@
 package config
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -18,22 +20,25 @@ const (
 	defaultAllocationTTL = "0"
 )
 
+// Values of the storage key.
+const (
+	StorageJSON   = "json"
+	StorageSQLite = "sqlite"
+)
+
 // Config represents user configuration on disk.
 type Config struct {
-	PortStart     int    `json:"port_start"`
-	PortEnd       int    `json:"port_end"`
-	FreezePeriod  string `json:"freeze_period"`
-	AllocationTTL string `json:"allocation_ttl"`
-	LogFile       string `json:"log_file"`
+	PortStart     int               `json:"port_start"`
+	PortEnd       int               `json:"port_end"`
+	FreezePeriod  string            `json:"freeze_period"`
+	AllocationTTL string            `json:"allocation_ttl"`
+	LogFile       string            `json:"log_file"`
+	Storage       string            `json:"storage"`
+	EnvNames      map[string]string `json:"env_names,omitempty"`
 }
 
-type configOnDisk struct {
-	PortStart     *int    `json:"port_start"`
-	PortEnd       *int    `json:"port_end"`
-	FreezePeriod  *string `json:"freeze_period"`
-	AllocationTTL *string `json:"allocation_ttl"`
-	LogFile       *string `json:"log_file"`
-}
+// rawConfig holds the keys present in a config file, still JSON-encoded.
+type rawConfig map[string]json.RawMessage
 
 func Default() Config {
 	return Config{
@@ -42,50 +47,147 @@ func Default() Config {
 		FreezePeriod:  defaultFreezePeriod,
 		AllocationTTL: defaultAllocationTTL,
 		LogFile:       "",
+		Storage:       StorageJSON,
 	}
 }
 
 func Load(path string) (Config, error) {
+	cfg, err := loadGlobal(path, true, nil)
+	if err != nil {
+		return Config{}, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// loadGlobal reads the config file at path on top of the defaults. A missing
+// file is created with default values when create is set and otherwise left
+// alone. The result is not validated so callers can layer further values on
+// top first.
+func loadGlobal(path string, create bool, origins map[string]string) (Config, error) {
 	if path == "" {
 		return Config{}, errors.New("config path is empty")
 	}
 	path = ExpandPath(path)
-	if err := ensureDir(filepath.Dir(path)); err != nil {
-		return Config{}, err
-	}
 	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
-		cfg := Default()
-		if err := Save(path, cfg); err != nil {
+		if !create {
+			return Default(), nil
+		}
+		if err := Save(path, Default()); err != nil {
 			return Config{}, err
 		}
-		return cfg, nil
 	} else if err != nil {
 		return Config{}, err
 	}
 
+	raw, err := readOnDisk(path)
+	if err != nil {
+		return Config{}, withBackupHint(path, err)
+	}
+	cfg := Default()
+	if err := raw.apply(&cfg, path, origins); err != nil {
+		return Config{}, withBackupHint(path, err)
+	}
+	return cfg, nil
+}
+
+// withBackupHint points at the backup of the previous version when the
+// config at path cannot be read.
+func withBackupHint(path string, err error) error {
+	if _, statErr := os.Stat(path + BackupSuffix); statErr != nil {
+		return err
+	}
+	return fmt.Errorf("%w (previous version saved at %s)", err, path+BackupSuffix)
+}
+
+func readOnDisk(path string) (rawConfig, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
-		return Config{}, err
+		return nil, err
 	}
-	var raw configOnDisk
+	return parseRaw(data)
+}
+
+func parseRaw(data []byte) (rawConfig, error) {
+	var raw rawConfig
 	if err := json.Unmarshal(data, &raw); err != nil {
-		return Config{}, fmt.Errorf("parse config: %w", err)
+		return nil, fmt.Errorf("parse config: %w", err)
 	}
-	cfg := Default()
-	if raw.PortStart != nil {
-		cfg.PortStart = *raw.PortStart
+	return raw, nil
+}
+
+// apply overlays the values present in raw onto cfg, recording source as the
+// origin of each one when origins is non-nil. Unknown keys are ignored.
+func (raw rawConfig) apply(cfg *Config, source string, origins map[string]string) error {
+	for _, key := range registry {
+		value, ok := raw[key.Name]
+		if !ok {
+			continue
+		}
+		if err := key.codec.decode(cfg, value); err != nil {
+			return fmt.Errorf("parse config: %s: %w", key.Name, err)
+		}
+		if origins != nil {
+			origins[key.Name] = source
+		}
+	}
+	return nil
+}
+
+// encode renders raw as indented JSON with registered keys in registry
+// order followed by any unknown keys, so edits keep files readable.
+func (raw rawConfig) encode() ([]byte, error) {
+	var names []string
+	seen := map[string]bool{}
+	for _, key := range registry {
+		if _, ok := raw[key.Name]; ok {
+			names = append(names, key.Name)
+			seen[key.Name] = true
+		}
 	}
-	if raw.PortEnd != nil {
-		cfg.PortEnd = *raw.PortEnd
+	var unknown []string
+	for name := range raw {
+		if !seen[name] {
+			unknown = append(unknown, name)
+		}
 	}
-	if raw.FreezePeriod != nil {
-		cfg.FreezePeriod = strings.TrimSpace(*raw.FreezePeriod)
+	sort.Strings(unknown)
+	names = append(names, unknown...)
+
+	var buf bytes.Buffer
+	buf.WriteString("{")
+	for i, name := range names {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		buf.WriteString("\n  ")
+		keyJSON, _ := json.Marshal(name)
+		buf.Write(keyJSON)
+		buf.WriteString(": ")
+		var value bytes.Buffer
+		if err := json.Indent(&value, raw[name], "  ", "  "); err != nil {
+			return nil, err
+		}
+		buf.Write(value.Bytes())
 	}
-	if raw.AllocationTTL != nil {
-		cfg.AllocationTTL = strings.TrimSpace(*raw.AllocationTTL)
+	if len(names) > 0 {
+		buf.WriteString("\n")
 	}
-	if raw.LogFile != nil {
-		cfg.LogFile = strings.TrimSpace(*raw.LogFile)
+	buf.WriteString("}")
+	return buf.Bytes(), nil
+}
+
+// Parse decodes and validates the contents of a config file.
+func Parse(data []byte) (Config, error) {
+	raw, err := parseRaw(data)
+	if err != nil {
+		return Config{}, err
+	}
+	cfg := Default()
+	if err := raw.apply(&cfg, "", nil); err != nil {
+		return Config{}, err
 	}
 	if err := cfg.Validate(); err != nil {
 		return Config{}, err
@@ -93,6 +195,96 @@ func Load(path string) (Config, error) {
 	return cfg, nil
 }
 
+// SetValue sets name to value, given in its command-line form, in the config
+// file at path. Other keys in the file are left untouched.
+func SetValue(path, name, value string) error {
+	key, err := Lookup(name)
+	if err != nil {
+		return err
+	}
+	return editRaw(path, func(raw rawConfig) error {
+		cfg := Default()
+		if err := key.Set(&cfg, value); err != nil {
+			return err
+		}
+		encoded, err := json.Marshal(key.Get(cfg))
+		if err != nil {
+			return err
+		}
+		raw[name] = encoded
+		return nil
+	})
+}
+
+// UnsetValue removes name from the config file at path so that it falls back
+// to the default.
+func UnsetValue(path, name string) error {
+	if _, err := Lookup(name); err != nil {
+		return err
+	}
+	return editRaw(path, func(raw rawConfig) error {
+		delete(raw, name)
+		return nil
+	})
+}
+
+// Reset replaces the config file at path with the defaults. Keys named in
+// keep retain the value set in the file, if any.
+func Reset(path string, keep ...string) error {
+	defaults, err := json.Marshal(Default())
+	if err != nil {
+		return err
+	}
+	return editRaw(path, func(raw rawConfig) error {
+		reset, err := parseRaw(defaults)
+		if err != nil {
+			return err
+		}
+		for _, name := range keep {
+			if value, ok := raw[name]; ok {
+				reset[name] = value
+			}
+		}
+		for name := range raw {
+			delete(raw, name)
+		}
+		for name, value := range reset {
+			raw[name] = value
+		}
+		return nil
+	})
+}
+
+// editRaw applies fn to the keys in the config file at path, creating the
+// file first if needed, and saves the result if it is still valid. The whole
+// read-modify-write cycle runs under the config lock.
+func editRaw(path string, fn func(rawConfig) error) error {
+	if _, err := loadGlobal(path, true, nil); err != nil {
+		return err
+	}
+	path = ExpandPath(path)
+	return withLock(path, func() error {
+		raw, err := readOnDisk(path)
+		if err != nil {
+			return err
+		}
+		if raw == nil {
+			raw = rawConfig{}
+		}
+		if err := fn(raw); err != nil {
+			return err
+		}
+		payload, err := raw.encode()
+		if err != nil {
+			return err
+		}
+		if _, err := Parse(payload); err != nil {
+			return err
+		}
+		return replaceFile(path, payload)
+	})
+}
+
 func Save(path string, cfg Config) error {
 	if path == "" {
 		return errors.New("config path is empty")
@@ -105,25 +297,44 @@ func Save(path string, cfg Config) error {
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(path, payload, 0o644)
+	return writeFile(path, payload)
 }
 
-func (c Config) Validate() error {
-	if c.PortStart <= 0 {
-		return fmt.Errorf("port_start must be > 0")
+// WriteFile replaces the config file at path with data after checking that
+// it parses and validates. baseHash is the Hash of the contents data was
+// derived from; if the file no longer matches it, ErrConcurrentModification
+// is returned and nothing is written. An empty baseHash skips the check.
+func WriteFile(path string, data []byte, baseHash string) error {
+	if path == "" {
+		return errors.New("config path is empty")
 	}
-	if c.PortEnd <= 0 {
-		return fmt.Errorf("port_end must be > 0")
+	if _, err := Parse(data); err != nil {
+		return err
+	}
+	path = ExpandPath(path)
+	return withLock(path, func() error {
+		if baseHash != "" {
+			current, err := os.ReadFile(path)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+			if Hash(current) != baseHash {
+				return ErrConcurrentModification
+			}
+		}
+		return replaceFile(path, data)
+	})
+}
+
+func (c Config) Validate() error {
+	for _, key := range registry {
+		if err := key.codec.check(c); err != nil {
+			return err
+		}
 	}
 	if c.PortStart > c.PortEnd {
 		return fmt.Errorf("port_start must be <= port_end")
 	}
-	if _, err := ParseDuration(c.FreezePeriod); err != nil {
-		return fmt.Errorf("invalid freeze_period: %w", err)
-	}
-	if _, err := ParseDuration(c.AllocationTTL); err != nil {
-		return fmt.Errorf("invalid allocation_ttl: %w", err)
-	}
 	return nil
 }
 
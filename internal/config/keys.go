@@ -0,0 +1,353 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrUnknownKey is returned when looking up a key that is not registered.
+var ErrUnknownKey = errors.New("unknown configuration key")
+
+// Type is the value type of a configuration key.
+type Type string
+
+const (
+	TypeInt      Type = "int"
+	TypeDuration Type = "duration"
+	TypeString   Type = "string"
+	TypeList     Type = "list"
+	TypeMap      Type = "map"
+)
+
+// Key describes one configuration key. Every place that reads, writes or
+// displays configuration goes through the registry of keys, so adding a key
+// only means adding a field to Config and an entry below.
+type Key struct {
+	Name        string
+	Type        Type
+	Description string
+	// Project reports whether the key may be set in a project config file.
+	Project bool
+	codec   codec
+}
+
+// codec converts between a Config field and its string and JSON forms.
+type codec interface {
+	get(cfg Config) any
+	format(cfg Config) string
+	parse(cfg *Config, value string) error
+	decode(cfg *Config, raw json.RawMessage) error
+	check(cfg Config) error
+	values() []string
+}
+
+var registry = []Key{
+	{
+		Name:        "port_start",
+		Type:        TypeInt,
+		Description: "Start of the port range to allocate from",
+		Project:     true,
+		codec:       intField(func(c *Config) *int { return &c.PortStart }, positive("port_start")),
+	},
+	{
+		Name:        "port_end",
+		Type:        TypeInt,
+		Description: "End of the port range to allocate from (inclusive)",
+		Project:     true,
+		codec:       intField(func(c *Config) *int { return &c.PortEnd }, positive("port_end")),
+	},
+	{
+		Name:        "freeze_period",
+		Type:        TypeDuration,
+		Description: "How long an allocated port is kept from other directories, e.g. 24h or 7d; 0 disables",
+		Project:     true,
+		codec:       durationField(func(c *Config) *string { return &c.FreezePeriod }, "freeze_period"),
+	},
+	{
+		Name:        "allocation_ttl",
+		Type:        TypeDuration,
+		Description: "Remove allocations unused for this long, e.g. 30d; 0 disables",
+		Project:     true,
+		codec:       durationField(func(c *Config) *string { return &c.AllocationTTL }, "allocation_ttl"),
+	},
+	{
+		Name:        "log_file",
+		Type:        TypeString,
+		Description: "Log file for allocation changes; relative paths go in the state directory, empty disables",
+		codec:       stringField(func(c *Config) *string { return &c.LogFile }),
+	},
+	{
+		Name:        "storage",
+		Type:        TypeString,
+		Description: "Backend for the default allocations file: json or sqlite; explicit paths choose by extension",
+		codec:       choiceField(func(c *Config) *string { return &c.Storage }, "storage", StorageJSON, StorageSQLite),
+	},
+	{
+		Name:        "env_names",
+		Type:        TypeMap,
+		Description: "Environment variables exported by the shell hook, per allocation name, e.g. web=WEB_PORT; others use PORT and NAME_PORT",
+		Project:     true,
+		codec:       mapField(func(c *Config) *map[string]string { return &c.EnvNames }, envNames),
+	},
+}
+
+// AllKeys returns the registered keys in display order.
+func AllKeys() []Key {
+	out := make([]Key, len(registry))
+	copy(out, registry)
+	return out
+}
+
+// Lookup returns the registered key with the given name.
+func Lookup(name string) (Key, error) {
+	for _, key := range registry {
+		if key.Name == name {
+			return key, nil
+		}
+	}
+	return Key{}, fmt.Errorf("%w: %s", ErrUnknownKey, name)
+}
+
+// Get returns the typed value of the key in cfg, suitable for JSON encoding.
+func (k Key) Get(cfg Config) any { return k.codec.get(cfg) }
+
+// Format returns the value of the key in cfg in its command-line form.
+func (k Key) Format(cfg Config) string { return k.codec.format(cfg) }
+
+// Values returns the allowed values of a key limited to a fixed set, and
+// nil for any other key.
+func (k Key) Values() []string { return k.codec.values() }
+
+// Default returns the default value in its command-line form.
+func (k Key) Default() string { return k.codec.format(Default()) }
+
+// Set parses value in its command-line form and stores it in cfg.
+func (k Key) Set(cfg *Config, value string) error {
+	if err := k.codec.parse(cfg, strings.TrimSpace(value)); err != nil {
+		return err
+	}
+	return k.codec.check(*cfg)
+}
+
+// Syntax describes the command-line form of values of type t.
+func (t Type) Syntax() string {
+	switch t {
+	case TypeInt:
+		return "integer"
+	case TypeDuration:
+		return "duration such as 30m, 24h or 7d; 0 disables"
+	case TypeList:
+		return "comma-separated list"
+	case TypeMap:
+		return "comma-separated key=value pairs"
+	default:
+		return "text"
+	}
+}
+
+type field[T any] struct {
+	ptr     func(*Config) *T
+	toStr   func(T) string
+	fromStr func(string) (T, error)
+	valid   func(T) error
+	choices []string // allowed values, if limited to a fixed set
+}
+
+func (f field[T]) get(cfg Config) any       { return *f.ptr(&cfg) }
+func (f field[T]) format(cfg Config) string { return f.toStr(*f.ptr(&cfg)) }
+func (f field[T]) check(cfg Config) error   { return f.validate(*f.ptr(&cfg)) }
+func (f field[T]) values() []string         { return f.choices }
+func (f field[T]) validate(value T) error {
+	if f.valid == nil {
+		return nil
+	}
+	return f.valid(value)
+}
+
+func (f field[T]) parse(cfg *Config, value string) error {
+	parsed, err := f.fromStr(value)
+	if err != nil {
+		return err
+	}
+	*f.ptr(cfg) = parsed
+	return nil
+}
+
+func (f field[T]) decode(cfg *Config, raw json.RawMessage) error {
+	var value T
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return err
+	}
+	if s, ok := any(&value).(*string); ok {
+		*s = strings.TrimSpace(*s)
+	}
+	*f.ptr(cfg) = value
+	return nil
+}
+
+func intField(ptr func(*Config) *int, valid func(int) error) field[int] {
+	return field[int]{
+		ptr:   ptr,
+		toStr: strconv.Itoa,
+		fromStr: func(s string) (int, error) {
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				return 0, fmt.Errorf("%q is not an integer", s)
+			}
+			return n, nil
+		},
+		valid: valid,
+	}
+}
+
+func durationField(ptr func(*Config) *string, name string) field[string] {
+	return field[string]{
+		ptr:     ptr,
+		toStr:   func(s string) string { return s },
+		fromStr: func(s string) (string, error) { return s, nil },
+		valid: func(s string) error {
+			if _, err := ParseDuration(s); err != nil {
+				return fmt.Errorf("invalid %s: %w", name, err)
+			}
+			return nil
+		},
+	}
+}
+
+func stringField(ptr func(*Config) *string) field[string] {
+	return field[string]{
+		ptr:     ptr,
+		toStr:   func(s string) string { return s },
+		fromStr: func(s string) (string, error) { return s, nil },
+	}
+}
+
+func choiceField(ptr func(*Config) *string, name string, choices ...string) field[string] {
+	f := stringField(ptr)
+	f.valid = func(s string) error {
+		if s == "" {
+			return nil // unset, the caller applies the default
+		}
+		for _, choice := range choices {
+			if s == choice {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s must be one of %s", name, strings.Join(choices, ", "))
+	}
+	f.choices = choices
+	return f
+}
+
+func listField(ptr func(*Config) *[]int) field[[]int] {
+	return field[[]int]{
+		ptr: ptr,
+		toStr: func(values []int) string {
+			parts := make([]string, len(values))
+			for i, v := range values {
+				parts[i] = strconv.Itoa(v)
+			}
+			return strings.Join(parts, ",")
+		},
+		fromStr: func(s string) ([]int, error) {
+			var out []int
+			for _, part := range splitList(s) {
+				n, err := strconv.Atoi(part)
+				if err != nil {
+					return nil, fmt.Errorf("%q is not an integer", part)
+				}
+				out = append(out, n)
+			}
+			return out, nil
+		},
+		valid: func(values []int) error {
+			for _, v := range values {
+				if v <= 0 || v > 65535 {
+					return fmt.Errorf("port %d is out of range", v)
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func mapField(ptr func(*Config) *map[string]string, valid func(map[string]string) error) field[map[string]string] {
+	return field[map[string]string]{
+		ptr: ptr,
+		toStr: func(values map[string]string) string {
+			keys := make([]string, 0, len(values))
+			for k := range values {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			parts := make([]string, len(keys))
+			for i, k := range keys {
+				parts[i] = k + "=" + values[k]
+			}
+			return strings.Join(parts, ",")
+		},
+		fromStr: func(s string) (map[string]string, error) {
+			out := map[string]string{}
+			for _, part := range splitList(s) {
+				k, v, ok := strings.Cut(part, "=")
+				k = strings.TrimSpace(k)
+				if !ok || k == "" {
+					return nil, fmt.Errorf("%q is not a key=value pair", part)
+				}
+				out[k] = strings.TrimSpace(v)
+			}
+			return out, nil
+		},
+		valid: valid,
+	}
+}
+
+// envNames checks that the values of the env_names key are variable names.
+func envNames(names map[string]string) error {
+	for name, variable := range names {
+		if !IsEnvVariable(variable) {
+			return fmt.Errorf("env_names: %q for %s is not a valid environment variable name", variable, name)
+		}
+	}
+	return nil
+}
+
+// IsEnvVariable reports whether s can be exported as a shell variable:
+// letters, digits and underscores, not starting with a digit.
+func IsEnvVariable(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		switch {
+		case r == '_', r >= 'A' && r <= 'Z', r >= 'a' && r <= 'z':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+func positive(name string) func(int) error {
+	return func(n int) error {
+		if n <= 0 {
+			return fmt.Errorf("%s must be > 0", name)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,262 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	key, err := Lookup("port_start")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if key.Type != TypeInt {
+		t.Errorf("Type = %q, want %q", key.Type, TypeInt)
+	}
+
+	if _, err := Lookup("nope"); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Lookup(nope) error = %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestKeyValues(t *testing.T) {
+	storage, _ := Lookup("storage")
+	if got := storage.Values(); !reflect.DeepEqual(got, []string{StorageJSON, StorageSQLite}) {
+		t.Errorf("storage values = %v", got)
+	}
+	portStart, _ := Lookup("port_start")
+	if got := portStart.Values(); got != nil {
+		t.Errorf("port_start values = %v, want nil", got)
+	}
+}
+
+func TestRegistryCoversConfig(t *testing.T) {
+	// Every JSON field of Config must have a registered key.
+	typ := reflect.TypeOf(Config{})
+	for i := 0; i < typ.NumField(); i++ {
+		name := strings.Split(typ.Field(i).Tag.Get("json"), ",")[0]
+		if _, err := Lookup(name); err != nil {
+			t.Errorf("Config field %s has no registered key %q", typ.Field(i).Name, name)
+		}
+	}
+}
+
+func TestKeySet(t *testing.T) {
+	tests := []struct {
+		key     string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"port_start", "21000", "21000", false},
+		{"port_start", "abc", "", true},
+		{"port_start", "0", "", true},
+		{"freeze_period", " 7d ", "7d", false},
+		{"freeze_period", "soon", "", true},
+		{"log_file", "portpls.log", "portpls.log", false},
+		{"storage", "sqlite", "sqlite", false},
+		{"storage", "postgres", "", true},
+		{"env_names", "web=WEB_PORT, main=PORT", "main=PORT,web=WEB_PORT", false},
+		{"env_names", "web=2PORT", "", true},
+		{"env_names", "web=WEB-PORT", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key+"="+tt.value, func(t *testing.T) {
+			key, err := Lookup(tt.key)
+			if err != nil {
+				t.Fatalf("unexpected lookup error: %v", err)
+			}
+			cfg := Default()
+			err = key.Set(&cfg, tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := key.Format(cfg); got != tt.want {
+				t.Errorf("Format() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMapField(t *testing.T) {
+	type holder struct{ values map[string]string }
+	var h holder
+	field := mapField(func(*Config) *map[string]string { return &h.values }, nil)
+
+	cfg := Default()
+	if err := field.parse(&cfg, "web=WEB_PORT, main=PORT"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]string{"web": "WEB_PORT", "main": "PORT"}
+	if !reflect.DeepEqual(h.values, want) {
+		t.Errorf("parsed = %v, want %v", h.values, want)
+	}
+	if got := field.format(cfg); got != "main=PORT,web=WEB_PORT" {
+		t.Errorf("format() = %q, want %q", got, "main=PORT,web=WEB_PORT")
+	}
+	if err := field.parse(&cfg, "novalue"); err == nil {
+		t.Error("expected error for entry without '=', got nil")
+	}
+	if err := field.decode(&cfg, json.RawMessage(`{"api": "API_PORT"}`)); err != nil {
+		t.Fatalf("unexpected decode error: %v", err)
+	}
+	if h.values["api"] != "API_PORT" {
+		t.Errorf("decoded = %v", h.values)
+	}
+}
+
+func TestListField(t *testing.T) {
+	type holder struct{ values []int }
+	var h holder
+	key := Key{
+		Name:  "ports",
+		Type:  TypeList,
+		codec: listField(func(*Config) *[]int { return &h.values }),
+	}
+
+	cfg := Default()
+	if err := key.Set(&cfg, " 20080, 20443 "); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(h.values, []int{20080, 20443}) {
+		t.Errorf("parsed = %v, want [20080 20443]", h.values)
+	}
+	if got := key.Format(cfg); got != "20080,20443" {
+		t.Errorf("Format() = %q, want %q", got, "20080,20443")
+	}
+	if !reflect.DeepEqual(key.Get(cfg), []int{20080, 20443}) {
+		t.Errorf("Get() = %v", key.Get(cfg))
+	}
+	for _, bad := range []string{"80,x", "70000", "0"} {
+		if err := key.Set(&cfg, bad); err == nil {
+			t.Errorf("Set(%q) expected error, got nil", bad)
+		}
+	}
+	if err := key.Set(&cfg, ""); err != nil {
+		t.Fatalf("unexpected error clearing list: %v", err)
+	}
+	if got := key.Format(cfg); got != "" {
+		t.Errorf("Format() after clearing = %q, want empty", got)
+	}
+	if err := key.codec.decode(&cfg, json.RawMessage(`[3000, 3001]`)); err != nil {
+		t.Fatalf("unexpected decode error: %v", err)
+	}
+	if !reflect.DeepEqual(h.values, []int{3000, 3001}) {
+		t.Errorf("decoded = %v", h.values)
+	}
+	if got := key.Type.Syntax(); got != "comma-separated list" {
+		t.Errorf("Syntax() = %q", got)
+	}
+}
+
+func TestSetValue(t *testing.T) {
+	t.Run("updates one key and keeps the rest", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		path := filepath.Join(tmpDir, "config.json")
+		if err := os.WriteFile(path, []byte(`{"port_end": 25000, "custom": true}`), 0644); err != nil {
+			t.Fatalf("failed to write config: %v", err)
+		}
+
+		if err := SetValue(path, "freeze_period", "12h"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		data, _ := os.ReadFile(path)
+		var raw map[string]any
+		if err := json.Unmarshal(data, &raw); err != nil {
+			t.Fatalf("saved config is not valid JSON: %v", err)
+		}
+		if raw["port_end"] != float64(25000) {
+			t.Errorf("port_end = %v, want 25000", raw["port_end"])
+		}
+		if raw["custom"] != true {
+			t.Errorf("unknown key was dropped: %v", raw)
+		}
+		if _, ok := raw["port_start"]; ok {
+			t.Errorf("port_start should not have been written: %v", raw)
+		}
+		cfg, err := Load(path)
+		if err != nil {
+			t.Fatalf("failed to load: %v", err)
+		}
+		if cfg.FreezePeriod != "12h" {
+			t.Errorf("FreezePeriod = %q, want 12h", cfg.FreezePeriod)
+		}
+	})
+
+	t.Run("rejects values that make the config invalid", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		path := filepath.Join(tmpDir, "config.json")
+		if err := os.WriteFile(path, []byte(`{"port_end": 25000}`), 0644); err != nil {
+			t.Fatalf("failed to write config: %v", err)
+		}
+
+		if err := SetValue(path, "port_start", "30000"); err == nil {
+			t.Error("expected validation error, got nil")
+		}
+		data, _ := os.ReadFile(path)
+		if string(data) != `{"port_end": 25000}` {
+			t.Errorf("config was modified: %s", data)
+		}
+	})
+
+	t.Run("rejects unknown keys", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.json")
+		if err := SetValue(path, "nope", "1"); !errors.Is(err, ErrUnknownKey) {
+			t.Errorf("error = %v, want ErrUnknownKey", err)
+		}
+	})
+}
+
+func TestUnsetValue(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "config.json")
+	if err := os.WriteFile(path, []byte(`{"port_start": 21000, "freeze_period": "1h"}`), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	if err := UnsetValue(path, "freeze_period"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	layered, err := LoadLayered(path, "", LoadOptions{})
+	if err != nil {
+		t.Fatalf("failed to load: %v", err)
+	}
+	if layered.Config.FreezePeriod != "24h" {
+		t.Errorf("FreezePeriod = %q, want default 24h", layered.Config.FreezePeriod)
+	}
+	if origin := layered.Origin("freeze_period"); origin != OriginDefault {
+		t.Errorf("Origin(freeze_period) = %q, want %q", origin, OriginDefault)
+	}
+	if layered.Config.PortStart != 21000 {
+		t.Errorf("PortStart = %d, want 21000", layered.Config.PortStart)
+	}
+}
+
+func TestParse(t *testing.T) {
+	if _, err := Parse([]byte(`{"port_start": "abc"}`)); err == nil {
+		t.Error("expected error for string port_start, got nil")
+	}
+	if _, err := Parse([]byte(`{"port_start": 30000, "port_end": 20000}`)); err == nil {
+		t.Error("expected validation error, got nil")
+	}
+	cfg, err := Parse([]byte(`{"env_names": {"web": "WEB_PORT"}}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(cfg.EnvNames, map[string]string{"web": "WEB_PORT"}) {
+		t.Errorf("EnvNames = %v", cfg.EnvNames)
+	}
+}
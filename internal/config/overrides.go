@@ -0,0 +1,61 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// EnvPrefix is prepended to the upper-cased key to form the environment
+// variable that overrides it, e.g. PORTPLS_PORT_START.
+const EnvPrefix = "PORTPLS_"
+
+// LoadOptions controls how LoadLayered resolves the configuration.
+type LoadOptions struct {
+	// NoCreate leaves a missing global config file alone and uses the
+	// defaults instead of writing them to disk.
+	NoCreate bool
+	// Env holds values taken from PORTPLS_<KEY> environment variables.
+	Env Overrides
+	// Flags holds values taken from command-line flags.
+	Flags Overrides
+}
+
+// Overrides maps configuration keys to raw string values set outside of
+// config files.
+type Overrides map[string]string
+
+// EnvName returns the environment variable that overrides key.
+func EnvName(key string) string {
+	return EnvPrefix + strings.ToUpper(key)
+}
+
+// FlagName returns the command-line flag that overrides key.
+func FlagName(key string) string {
+	return strings.ReplaceAll(key, "_", "-")
+}
+
+// EnvOverrides collects the PORTPLS_<KEY> variables found through lookup,
+// which is usually os.LookupEnv.
+func EnvOverrides(lookup func(string) (string, bool)) Overrides {
+	out := Overrides{}
+	for _, key := range registry {
+		if value, ok := lookup(EnvName(key.Name)); ok {
+			out[key.Name] = value
+		}
+	}
+	return out
+}
+
+func (o Overrides) apply(cfg *Config, origins map[string]string, origin func(key string) string) error {
+	for _, key := range registry {
+		value, ok := o[key.Name]
+		if !ok {
+			continue
+		}
+		if err := key.Set(cfg, value); err != nil {
+			return fmt.Errorf("%s: %w", origin(key.Name), err)
+		}
+		origins[key.Name] = origin(key.Name)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestEnvOverrides(t *testing.T) {
+	env := map[string]string{
+		"PORTPLS_PORT_START":    "21000",
+		"PORTPLS_FREEZE_PERIOD": "1h",
+		"PORTPLS_UNRELATED":     "x",
+	}
+	lookup := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+
+	got := EnvOverrides(lookup)
+	if len(got) != 2 {
+		t.Fatalf("expected 2 overrides, got %d: %v", len(got), got)
+	}
+	if got["port_start"] != "21000" {
+		t.Errorf("port_start = %q, want %q", got["port_start"], "21000")
+	}
+	if got["freeze_period"] != "1h" {
+		t.Errorf("freeze_period = %q, want %q", got["freeze_period"], "1h")
+	}
+}
+
+func TestLoadLayeredPrecedence(t *testing.T) {
+	tmpDir := t.TempDir()
+	globalPath := filepath.Join(tmpDir, "config.json")
+	if err := os.WriteFile(globalPath, []byte(`{"port_start": 20000, "port_end": 29000, "freeze_period": "1h", "allocation_ttl": "1d"}`), 0644); err != nil {
+		t.Fatalf("failed to write global config: %v", err)
+	}
+	project := filepath.Join(tmpDir, "project")
+	projectPath := writeProjectConfig(t, project, `{"port_start": 21000, "port_end": 28000, "freeze_period": "2h"}`)
+
+	layered, err := LoadLayered(globalPath, project, LoadOptions{
+		Env:   Overrides{"port_start": "22000", "port_end": "27000"},
+		Flags: Overrides{"port_start": "23000"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		key    string
+		value  any
+		got    any
+		origin string
+	}{
+		{"port_start", 23000, layered.Config.PortStart, "flag --port-start"},
+		{"port_end", 27000, layered.Config.PortEnd, "env PORTPLS_PORT_END"},
+		{"freeze_period", "2h", layered.Config.FreezePeriod, projectPath},
+		{"allocation_ttl", "1d", layered.Config.AllocationTTL, globalPath},
+		{"log_file", "", layered.Config.LogFile, OriginDefault},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if tt.got != tt.value {
+				t.Errorf("%s = %v, want %v", tt.key, tt.got, tt.value)
+			}
+			if origin := layered.Origin(tt.key); origin != tt.origin {
+				t.Errorf("Origin(%s) = %q, want %q", tt.key, origin, tt.origin)
+			}
+		})
+	}
+}
+
+func TestLoadLayeredOverrides(t *testing.T) {
+	t.Run("rejects non-integer port", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		_, err := LoadLayered(filepath.Join(tmpDir, "config.json"), "", LoadOptions{
+			Env: Overrides{"port_start": "abc"},
+		})
+		if err == nil {
+			t.Error("expected error for non-integer port_start, got nil")
+		}
+	})
+
+	t.Run("validates overridden values", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		_, err := LoadLayered(filepath.Join(tmpDir, "config.json"), "", LoadOptions{
+			Flags: Overrides{"allocation_ttl": "soon"},
+		})
+		if err == nil {
+			t.Error("expected error for invalid allocation_ttl, got nil")
+		}
+	})
+
+	t.Run("no-create leaves missing config alone", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		path := filepath.Join(tmpDir, "readonly", "config.json")
+
+		layered, err := LoadLayered(path, "", LoadOptions{NoCreate: true})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(layered.Config, Default()) {
+			t.Errorf("Config = %+v, want defaults", layered.Config)
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("config file should not have been created, stat err = %v", err)
+		}
+	})
+}
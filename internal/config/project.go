@@ -0,0 +1,91 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// ProjectDir is the directory holding project-local configuration.
+	ProjectDir = ".portpls"
+	// ProjectFile is the name of the project-local config file inside ProjectDir.
+	ProjectFile = "config.json"
+	// OriginDefault is the origin reported for values that no file sets.
+	OriginDefault = "default"
+)
+
+// Layered is an effective configuration together with the origin of each
+// value: OriginDefault or the path of the file that set it.
+type Layered struct {
+	Config  Config
+	Origins map[string]string
+}
+
+// Origin returns where the effective value of key came from.
+func (l Layered) Origin(key string) string {
+	if origin, ok := l.Origins[key]; ok {
+		return origin
+	}
+	return OriginDefault
+}
+
+// FindProjectConfig walks up from dir looking for .portpls/config.json and
+// returns the first one found.
+func FindProjectConfig(dir string) (string, bool) {
+	if dir == "" {
+		return "", false
+	}
+	current := filepath.Clean(dir)
+	for {
+		candidate := filepath.Join(current, ProjectDir, ProjectFile)
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate, true
+		}
+		parent := filepath.Dir(current)
+		if parent == current {
+			return "", false
+		}
+		current = parent
+	}
+}
+
+// LoadLayered resolves the effective configuration for directory. Layers
+// apply in increasing precedence: defaults, the global config at globalPath,
+// the closest project .portpls/config.json, PORTPLS_<KEY> environment
+// variables and finally flag values. Project files may only set keys marked
+// as Project in the registry.
+func LoadLayered(globalPath, directory string, opts LoadOptions) (Layered, error) {
+	origins := map[string]string{}
+	cfg, err := loadGlobal(globalPath, !opts.NoCreate, origins)
+	if err != nil {
+		return Layered{}, err
+	}
+
+	if projectPath, ok := FindProjectConfig(directory); ok {
+		project, err := readOnDisk(projectPath)
+		if err != nil {
+			return Layered{}, fmt.Errorf("%s: %w", projectPath, err)
+		}
+		for _, key := range registry {
+			if _, set := project[key.Name]; set && !key.Project {
+				return Layered{}, fmt.Errorf("%s: %s cannot be set in a project config", projectPath, key.Name)
+			}
+		}
+		if err := project.apply(&cfg, projectPath, origins); err != nil {
+			return Layered{}, fmt.Errorf("%s: %w", projectPath, err)
+		}
+	}
+
+	if err := opts.Env.apply(&cfg, origins, func(key string) string { return "env " + EnvName(key) }); err != nil {
+		return Layered{}, err
+	}
+	if err := opts.Flags.apply(&cfg, origins, func(key string) string { return "flag --" + FlagName(key) }); err != nil {
+		return Layered{}, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return Layered{}, err
+	}
+	return Layered{Config: cfg, Origins: origins}, nil
+}
@@ -0,0 +1,122 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeProjectConfig(t *testing.T, dir, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, ProjectDir, ProjectFile)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("failed to create project config dir: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write project config: %v", err)
+	}
+	return path
+}
+
+func TestFindProjectConfig(t *testing.T) {
+	t.Run("finds config in an ancestor directory", func(t *testing.T) {
+		root := t.TempDir()
+		want := writeProjectConfig(t, root, `{}`)
+		nested := filepath.Join(root, "a", "b")
+		if err := os.MkdirAll(nested, 0755); err != nil {
+			t.Fatalf("failed to create nested dir: %v", err)
+		}
+
+		got, ok := FindProjectConfig(nested)
+		if !ok {
+			t.Fatal("expected project config to be found")
+		}
+		if got != want {
+			t.Errorf("FindProjectConfig() = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("prefers the closest config", func(t *testing.T) {
+		root := t.TempDir()
+		writeProjectConfig(t, root, `{}`)
+		nested := filepath.Join(root, "sub")
+		want := writeProjectConfig(t, nested, `{}`)
+
+		got, ok := FindProjectConfig(nested)
+		if !ok || got != want {
+			t.Errorf("FindProjectConfig() = %q, %v, want %q", got, ok, want)
+		}
+	})
+
+	t.Run("returns false for empty directory", func(t *testing.T) {
+		if _, ok := FindProjectConfig(""); ok {
+			t.Error("expected no project config for empty directory")
+		}
+	})
+}
+
+func TestLoadLayered(t *testing.T) {
+	t.Run("project values override global ones", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		globalPath := filepath.Join(tmpDir, "config.json")
+		if err := os.WriteFile(globalPath, []byte(`{"port_start": 20000, "port_end": 22000, "freeze_period": "1h"}`), 0644); err != nil {
+			t.Fatalf("failed to write global config: %v", err)
+		}
+		project := filepath.Join(tmpDir, "project")
+		projectPath := writeProjectConfig(t, project, `{"port_start": 21000, "port_end": 21100}`)
+
+		layered, err := LoadLayered(globalPath, project, LoadOptions{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if layered.Config.PortStart != 21000 || layered.Config.PortEnd != 21100 {
+			t.Errorf("port range = %d-%d, want 21000-21100", layered.Config.PortStart, layered.Config.PortEnd)
+		}
+		if layered.Config.FreezePeriod != "1h" {
+			t.Errorf("FreezePeriod = %q, want %q", layered.Config.FreezePeriod, "1h")
+		}
+		if got := layered.Origin("port_start"); got != projectPath {
+			t.Errorf("Origin(port_start) = %q, want %q", got, projectPath)
+		}
+		if got := layered.Origin("freeze_period"); got != globalPath {
+			t.Errorf("Origin(freeze_period) = %q, want %q", got, globalPath)
+		}
+		if got := layered.Origin("allocation_ttl"); got != OriginDefault {
+			t.Errorf("Origin(allocation_ttl) = %q, want %q", got, OriginDefault)
+		}
+	})
+
+	t.Run("uses global config outside a project", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		globalPath := filepath.Join(tmpDir, "config.json")
+
+		layered, err := LoadLayered(globalPath, filepath.Join(tmpDir, "elsewhere"), LoadOptions{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(layered.Config, Default()) {
+			t.Errorf("Config = %+v, want defaults", layered.Config)
+		}
+	})
+
+	t.Run("rejects log_file in project config", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		project := filepath.Join(tmpDir, "project")
+		writeProjectConfig(t, project, `{"log_file": "/tmp/portpls.log"}`)
+
+		if _, err := LoadLayered(filepath.Join(tmpDir, "config.json"), project, LoadOptions{}); err == nil {
+			t.Error("expected error for log_file in project config, got nil")
+		}
+	})
+
+	t.Run("validates the layered result", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		project := filepath.Join(tmpDir, "project")
+		writeProjectConfig(t, project, `{"port_start": 30000}`)
+
+		if _, err := LoadLayered(filepath.Join(tmpDir, "config.json"), project, LoadOptions{}); err == nil {
+			t.Error("expected validation error, got nil")
+		}
+	})
+}
@@ -0,0 +1,142 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// BackupSuffix is appended to the config path to name the copy of the
+	// previous version kept on every write.
+	BackupSuffix = ".bak"
+	// lockSuffix names the sidecar file used for locking. The config file
+	// itself is replaced on every write, so it cannot carry the lock.
+	lockSuffix = ".lock"
+
+	lockWait      = 5 * time.Second
+	lockSleepStep = 50 * time.Millisecond
+)
+
+// ErrConcurrentModification is returned when the config file changed between
+// reading it and writing the edited version back.
+var ErrConcurrentModification = errors.New("config file was modified by another process")
+
+// Hash returns a hash of config file contents, used to detect concurrent
+// modification.
+func Hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// writeFile replaces the file at path with payload under the config lock.
+func writeFile(path string, payload []byte) error {
+	return withLock(path, func() error {
+		return replaceFile(path, payload)
+	})
+}
+
+// withLock runs fn while holding an exclusive lock on path's lock file.
+func withLock(path string, fn func() error) error {
+	if err := ensureDir(filepath.Dir(path)); err != nil {
+		return err
+	}
+	lock, err := os.OpenFile(path+lockSuffix, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+	deadline := time.Now().Add(lockWait)
+	for {
+		err := unix.Flock(int(lock.Fd()), unix.LOCK_EX|unix.LOCK_NB)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, unix.EWOULDBLOCK) {
+			return err
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for config lock")
+		}
+		time.Sleep(lockSleepStep)
+	}
+	defer func() {
+		_ = unix.Flock(int(lock.Fd()), unix.LOCK_UN)
+	}()
+	return fn()
+}
+
+// replaceFile atomically replaces path with payload: the data is written and
+// fsynced to a temp file in the same directory, the current file is copied
+// to path.bak, and the temp file is renamed over path. Callers must hold the
+// config lock.
+func replaceFile(path string, payload []byte) error {
+	dir := filepath.Dir(path)
+	mode := fs.FileMode(0o644)
+	current, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if info, statErr := os.Stat(path); statErr == nil {
+			mode = info.Mode().Perm()
+		}
+	case errors.Is(err, os.ErrNotExist):
+		current = nil
+	default:
+		return err
+	}
+
+	if current != nil {
+		if err := writeTemp(dir, path+BackupSuffix, current, mode); err != nil {
+			return fmt.Errorf("write config backup: %w", err)
+		}
+	}
+	return writeTemp(dir, path, payload, mode)
+}
+
+func writeTemp(dir, path string, payload []byte, mode fs.FileMode) error {
+	tmp, err := os.CreateTemp(dir, ".config-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+	if _, err := tmp.Write(payload); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	syncDir(dir)
+	return nil
+}
+
+// syncDir makes a rename in dir durable. Not every platform supports
+// fsync on directories, so failures are ignored.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	_ = d.Sync()
+	_ = d.Close()
+}
@@ -0,0 +1,152 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSaveKeepsBackup(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "config.json")
+
+	first := Default()
+	first.PortStart = 21000
+	if err := Save(path, first); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(path + BackupSuffix); !os.IsNotExist(err) {
+		t.Errorf("no backup expected for the first write, stat err = %v", err)
+	}
+	firstData, _ := os.ReadFile(path)
+
+	second := Default()
+	second.PortStart = 21500
+	if err := Save(path, second); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	backup, err := os.ReadFile(path + BackupSuffix)
+	if err != nil {
+		t.Fatalf("backup missing: %v", err)
+	}
+	if string(backup) != string(firstData) {
+		t.Errorf("backup = %s, want previous version %s", backup, firstData)
+	}
+
+	entries, _ := os.ReadDir(tmpDir)
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".tmp") {
+			t.Errorf("temp file left behind: %s", entry.Name())
+		}
+	}
+}
+
+func TestWriteFileDetectsConcurrentModification(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "config.json")
+	if err := os.WriteFile(path, []byte(`{"port_start": 20000}`), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	base, _ := os.ReadFile(path)
+	baseHash := Hash(base)
+
+	// Someone else changes the file in the meantime.
+	if err := SetValue(path, "port_end", "25000"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err := WriteFile(path, []byte(`{"port_start": 21000}`), baseHash)
+	if !errors.Is(err, ErrConcurrentModification) {
+		t.Fatalf("error = %v, want ErrConcurrentModification", err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("failed to load: %v", err)
+	}
+	if cfg.PortEnd != 25000 || cfg.PortStart != 20000 {
+		t.Errorf("config = %d-%d, want the concurrent change to survive", cfg.PortStart, cfg.PortEnd)
+	}
+
+	current, _ := os.ReadFile(path)
+	if err := WriteFile(path, []byte(`{"port_start": 21000}`), Hash(current)); err != nil {
+		t.Fatalf("unexpected error with up-to-date hash: %v", err)
+	}
+}
+
+func TestWriteFileRejectsInvalidConfig(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "config.json")
+	if err := os.WriteFile(path, []byte(`{"port_start": 20000}`), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	if err := WriteFile(path, []byte(`{"port_start": `), ""); err == nil {
+		t.Error("expected error for truncated config, got nil")
+	}
+	data, _ := os.ReadFile(path)
+	if string(data) != `{"port_start": 20000}` {
+		t.Errorf("config was modified: %s", data)
+	}
+}
+
+func TestConcurrentSetValue(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "config.json")
+	if err := Save(path, Default()); err != nil {
+		t.Fatalf("failed to save: %v", err)
+	}
+
+	keys := []string{"port_start", "port_end", "freeze_period", "allocation_ttl", "log_file", "storage"}
+	values := []string{"20001", "21999", "1h", "2d", "portpls.log", "sqlite"}
+	var wg sync.WaitGroup
+	errs := make(chan error, len(keys))
+	for i := range keys {
+		wg.Add(1)
+		go func(key, value string) {
+			defer wg.Done()
+			if err := SetValue(path, key, value); err != nil {
+				errs <- fmt.Errorf("%s: %w", key, err)
+			}
+		}(keys[i], values[i])
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("config is corrupt after concurrent writes: %v", err)
+	}
+	for i, name := range keys {
+		key, _ := Lookup(name)
+		if got := key.Format(cfg); got != values[i] {
+			t.Errorf("%s = %q, want %q (lost update)", name, got, values[i])
+		}
+	}
+}
+
+func TestLoadPointsAtBackup(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "config.json")
+	if err := Save(path, Default()); err != nil {
+		t.Fatalf("failed to save: %v", err)
+	}
+	if err := Save(path, Default()); err != nil {
+		t.Fatalf("failed to save: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(`{"port_start": 2`), 0644); err != nil {
+		t.Fatalf("failed to corrupt config: %v", err)
+	}
+
+	_, err := Load(path)
+	if err == nil || !strings.Contains(err.Error(), path+BackupSuffix) {
+		t.Errorf("error = %v, want a hint pointing at the backup", err)
+	}
+}
@@ -3,13 +3,27 @@ package docker
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"os/exec"
 	"strconv"
 	"strings"
 )
 
+// Container describes a running container that publishes a port.
+type Container struct {
+	ID             string `json:"id"`
+	Name           string `json:"name"`
+	Image          string `json:"image"`
+	ComposeProject string `json:"compose_project,omitempty"`
+	ComposeService string `json:"compose_service,omitempty"`
+	WorkingDir     string `json:"working_dir,omitempty"`
+}
+
 type inspectResult struct {
+	ID     string `json:"Id"`
+	Name   string `json:"Name"`
 	Config struct {
+		Image  string            `json:"Image"`
 		Labels map[string]string `json:"Labels"`
 	} `json:"Config"`
 	Mounts []struct {
@@ -28,16 +42,40 @@ func FindWorkingDirByPort(port int) (string, error) {
 		return "", err
 	}
 	for _, id := range ids {
-		match, dir := inspectContainerForPort(id, port)
-		if match {
-			if dir != "" {
-				return dir, nil
-			}
+		if container := inspectContainerForPort(id, port); container != nil && container.WorkingDir != "" {
+			return container.WorkingDir, nil
 		}
 	}
 	return "", errors.New("no docker container matched")
 }
 
+// FindContainerByPort returns the running container that publishes port on
+// the host.
+func FindContainerByPort(port int) (*Container, error) {
+	ids, err := dockerIDs()
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		if container := inspectContainerForPort(id, port); container != nil {
+			return container, nil
+		}
+	}
+	return nil, errors.New("no docker container matched")
+}
+
+// Stop stops the container with the given ID.
+func Stop(id string) error {
+	out, err := exec.Command("docker", "stop", id).CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("docker stop: %s", msg)
+		}
+		return fmt.Errorf("docker stop: %w", err)
+	}
+	return nil
+}
+
 func dockerIDs() ([]string, error) {
 	cmd := exec.Command("docker", "ps", "-q")
 	out, err := cmd.Output()
@@ -56,32 +94,45 @@ func dockerIDs() ([]string, error) {
 	return ids, nil
 }
 
-func inspectContainerForPort(id string, port int) (bool, string) {
+func inspectContainerForPort(id string, port int) *Container {
 	cmd := exec.Command("docker", "inspect", id)
 	out, err := cmd.Output()
 	if err != nil {
-		return false, ""
+		return nil
 	}
 	var results []inspectResult
 	if err := json.Unmarshal(out, &results); err != nil {
-		return false, ""
+		return nil
 	}
 	for _, result := range results {
 		for _, bindings := range result.NetworkSettings.Ports {
 			for _, binding := range bindings {
 				if binding.HostPort == strconv.Itoa(port) {
-					if dir := result.Config.Labels["com.docker.compose.project.working_dir"]; dir != "" {
-						return true, dir
-					}
-					for _, mount := range result.Mounts {
-						if mount.Source != "" {
-							return true, mount.Source
-						}
-					}
-					return true, ""
+					return newContainer(result)
 				}
 			}
 		}
 	}
-	return false, ""
+	return nil
+}
+
+func newContainer(result inspectResult) *Container {
+	labels := result.Config.Labels
+	container := &Container{
+		ID:             result.ID,
+		Name:           strings.TrimPrefix(result.Name, "/"),
+		Image:          result.Config.Image,
+		ComposeProject: labels["com.docker.compose.project"],
+		ComposeService: labels["com.docker.compose.service"],
+		WorkingDir:     labels["com.docker.compose.project.working_dir"],
+	}
+	if container.WorkingDir == "" {
+		for _, mount := range result.Mounts {
+			if mount.Source != "" {
+				container.WorkingDir = mount.Source
+				break
+			}
+		}
+	}
+	return container
 }
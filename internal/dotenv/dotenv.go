@@ -0,0 +1,148 @@
+// Package dotenv keeps a block of port variables up to date inside .env
+// files, leaving the rest of the file as it is.
+package dotenv
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Begin and End mark the block portpls manages. Lines outside the block are
+// never changed.
+const (
+	Begin = "# BEGIN portpls"
+	End   = "# END portpls"
+)
+
+// beginLine is written as the block's first line; any line starting with
+// Begin is recognised.
+const beginLine = Begin + " (managed by `portpls dotenv`, do not edit)"
+
+// ErrMalformed is returned for files whose block markers don't pair up.
+var ErrMalformed = errors.New("malformed portpls block")
+
+// Update returns content with the block replaced by one assigning vars, or
+// with the block appended if there is none. The block lists the variables
+// sorted by name, so updating with the same vars is a no-op.
+func Update(content string, vars map[string]string) (string, error) {
+	lines := strings.SplitAfter(content, "\n")
+	start, end, err := find(lines)
+	if err != nil {
+		return "", err
+	}
+	newline := "\n"
+	if strings.Contains(content, "\r\n") {
+		newline = "\r\n"
+	}
+	block := render(vars, newline)
+	if start < 0 {
+		switch {
+		case content == "":
+		case strings.HasSuffix(content, newline+newline) || content == newline:
+		case strings.HasSuffix(content, "\n"):
+			content += newline
+		default:
+			content += newline + newline
+		}
+		return content + block, nil
+	}
+	return strings.Join(lines[:start], "") + block + strings.Join(lines[end+1:], ""), nil
+}
+
+// Remove returns content without the block. A blank line left at the end
+// of the file by removing it is removed too, undoing what Update appended.
+func Remove(content string) (string, error) {
+	lines := strings.SplitAfter(content, "\n")
+	start, end, err := find(lines)
+	if err != nil || start < 0 {
+		return content, err
+	}
+	rest := strings.Join(lines[end+1:], "")
+	if rest == "" && start > 0 && strings.TrimSpace(lines[start-1]) == "" {
+		start--
+	}
+	return strings.Join(lines[:start], "") + rest, nil
+}
+
+// Shadowed returns, sorted, the names in vars that content also assigns
+// outside the block. Which assignment wins depends on the tool reading the
+// file.
+func Shadowed(content string, vars map[string]string) ([]string, error) {
+	lines := strings.SplitAfter(content, "\n")
+	start, end, err := find(lines)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	for i, line := range lines {
+		if start >= 0 && i >= start && i <= end {
+			continue
+		}
+		if name, ok := assignment(line); ok {
+			if _, managed := vars[name]; managed {
+				seen[name] = true
+			}
+		}
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// find returns the indexes of the block's first and last lines, or -1 if
+// there is no block.
+func find(lines []string) (start, end int, err error) {
+	start, end = -1, -1
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, Begin):
+			if start >= 0 {
+				return 0, 0, fmt.Errorf("%w: line %d starts a second block", ErrMalformed, i+1)
+			}
+			start = i
+		case line == End:
+			if start < 0 || end >= 0 {
+				return 0, 0, fmt.Errorf("%w: line %d ends a block that wasn't started", ErrMalformed, i+1)
+			}
+			end = i
+		}
+	}
+	if start >= 0 && end < 0 {
+		return 0, 0, fmt.Errorf("%w: line %d starts a block without %q", ErrMalformed, start+1, End)
+	}
+	return start, end, nil
+}
+
+func render(vars map[string]string, newline string) string {
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	b.WriteString(beginLine + newline)
+	for _, name := range names {
+		b.WriteString(name + "=" + vars[name] + newline)
+	}
+	b.WriteString(End + newline)
+	return b.String()
+}
+
+// assignment returns the variable a line assigns, allowing a leading
+// export as most dotenv loaders do.
+func assignment(line string) (string, bool) {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "export ")
+	name, _, ok := strings.Cut(line, "=")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" || strings.HasPrefix(name, "#") {
+		return "", false
+	}
+	return name, true
+}
@@ -0,0 +1,85 @@
+package dotenv
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+const block = "# BEGIN portpls (managed by `portpls dotenv`, do not edit)\nPORT=20000\nWEB_PORT=20001\n# END portpls\n"
+
+func TestUpdate(t *testing.T) {
+	vars := map[string]string{"WEB_PORT": "20001", "PORT": "20000"}
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"empty file", "", block},
+		{"appends after a blank line", "# secrets\nAPI_KEY=abc\n", "# secrets\nAPI_KEY=abc\n\n" + block},
+		{"no trailing newline", "API_KEY=abc", "API_KEY=abc\n\n" + block},
+		{"already separated", "API_KEY=abc\n\n", "API_KEY=abc\n\n" + block},
+		{
+			"replaces the block in place",
+			"A=1\n# BEGIN portpls\nPORT=1\nOLD_PORT=2\n# END portpls\nB=2\n",
+			"A=1\n" + block + "B=2\n",
+		},
+		{"up to date", "A=1\n\n" + block, "A=1\n\n" + block},
+		{
+			"keeps CRLF line endings",
+			"A=1\r\n",
+			"A=1\r\n\r\n# BEGIN portpls (managed by `portpls dotenv`, do not edit)\r\nPORT=20000\r\nWEB_PORT=20001\r\n# END portpls\r\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Update(tt.content, vars)
+			if err != nil {
+				t.Fatalf("Update: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Update =\n%q, want\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRemove(t *testing.T) {
+	for _, original := range []string{"", "API_KEY=abc\n", "# settings\nA=1\nB=2\n"} {
+		written, err := Update(original, map[string]string{"PORT": "20000"})
+		if err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+		got, err := Remove(written)
+		if err != nil || got != original {
+			t.Errorf("Remove(Update(%q)) = %q, %v", original, got, err)
+		}
+	}
+	got, err := Remove("A=1\n" + block + "B=2\n")
+	if err != nil || got != "A=1\nB=2\n" {
+		t.Errorf("Remove = %q, %v", got, err)
+	}
+}
+
+func TestMalformed(t *testing.T) {
+	for _, content := range []string{
+		"# BEGIN portpls\nPORT=1\n",
+		"PORT=1\n# END portpls\n",
+		block + block,
+	} {
+		if _, err := Update(content, nil); !errors.Is(err, ErrMalformed) {
+			t.Errorf("Update(%q) error = %v, want ErrMalformed", content, err)
+		}
+		if _, err := Remove(content); !errors.Is(err, ErrMalformed) {
+			t.Errorf("Remove(%q) error = %v, want ErrMalformed", content, err)
+		}
+	}
+}
+
+func TestShadowed(t *testing.T) {
+	content := "export PORT=3000\n# WEB_PORT=1\nDB_PORT=5432\n" + block
+	got, err := Shadowed(content, map[string]string{"PORT": "20000", "WEB_PORT": "20001"})
+	if err != nil || !reflect.DeepEqual(got, []string{"PORT"}) {
+		t.Errorf("Shadowed = %v, %v; want [PORT]", got, err)
+	}
+}
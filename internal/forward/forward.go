@@ -0,0 +1,104 @@
+// Package forward implements portpls forward, which relays TCP connections
+// from a well-known alias port to whichever allocation is active for it.
+package forward
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// DialTimeout bounds how long a connection waits for the active allocation
+// to accept it.
+const DialTimeout = 5 * time.Second
+
+// Target is where connections are forwarded to.
+type Target struct {
+	Addr        string // host:port to dial
+	Description string // shown when the target changes, e.g. "web in ~/app"
+}
+
+// Forwarder relays the connections accepted on a listener.
+type Forwarder struct {
+	// Resolve returns the current target. It is called for every
+	// connection, so switches apply to the next connection without a
+	// restart.
+	Resolve func() (Target, error)
+	// Logf reports target changes and failed connections.
+	Logf func(format string, args ...any)
+
+	mu   sync.Mutex
+	last string
+}
+
+// Serve accepts connections on l until it is closed, forwarding each to the
+// target Resolve returns at the time. Connections without a target are
+// closed right away.
+func (f *Forwarder) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go f.handle(conn)
+	}
+}
+
+func (f *Forwarder) handle(conn net.Conn) {
+	defer conn.Close()
+	target, err := f.Resolve()
+	if err != nil {
+		f.logf("%s: no target: %v", conn.LocalAddr(), err)
+		f.changed("")
+		return
+	}
+	f.changed(target.Description)
+	upstream, err := net.DialTimeout("tcp", target.Addr, DialTimeout)
+	if err != nil {
+		f.logf("%s: %v", target.Description, err)
+		return
+	}
+	defer upstream.Close()
+	Pipe(conn, upstream)
+}
+
+// changed logs the target when it differs from the previous connection's.
+func (f *Forwarder) changed(description string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if description != f.last && description != "" {
+		f.logf("forwarding to %s", description)
+	}
+	f.last = description
+}
+
+func (f *Forwarder) logf(format string, args ...any) {
+	if f.Logf != nil {
+		f.Logf(format, args...)
+	}
+}
+
+// Pipe copies between a and b in both directions until both sides are done,
+// passing on half-closes so protocols that shut down their write side
+// first still work.
+func Pipe(a, b net.Conn) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	copyHalf := func(dst, src net.Conn) {
+		defer wg.Done()
+		_, _ = io.Copy(dst, src)
+		if c, ok := dst.(interface{ CloseWrite() error }); ok {
+			_ = c.CloseWrite()
+		} else {
+			_ = dst.Close()
+		}
+	}
+	go copyHalf(a, b)
+	go copyHalf(b, a)
+	wg.Wait()
+}
@@ -0,0 +1,105 @@
+package forward
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// echoServer answers each line with its name and the line.
+func echoServer(t *testing.T, name string) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					fmt.Fprintf(conn, "%s: %s\n", name, scanner.Text())
+				}
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestForwarder(t *testing.T) {
+	blue, green := echoServer(t, "blue"), echoServer(t, "green")
+	var mu sync.Mutex
+	target := Target{Addr: blue, Description: "blue"}
+	var logs []string
+	f := &Forwarder{
+		Resolve: func() (Target, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if target.Addr == "" {
+				return Target{}, errors.New("nothing active")
+			}
+			return target, nil
+		},
+		Logf: func(format string, args ...any) {
+			mu.Lock()
+			defer mu.Unlock()
+			logs = append(logs, fmt.Sprintf(format, args...))
+		},
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	done := make(chan error)
+	go func() { done <- f.Serve(l) }()
+
+	roundTrip := func(line string) string {
+		t.Helper()
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		defer conn.Close()
+		fmt.Fprintln(conn, line)
+		conn.(*net.TCPConn).CloseWrite()
+		reply, _ := io.ReadAll(conn)
+		return string(reply)
+	}
+
+	if got := roundTrip("hi"); got != "blue: hi\n" {
+		t.Errorf("reply = %q", got)
+	}
+	mu.Lock()
+	target = Target{Addr: green, Description: "green"}
+	mu.Unlock()
+	if got := roundTrip("hi"); got != "green: hi\n" {
+		t.Errorf("reply after switching = %q", got)
+	}
+	mu.Lock()
+	target = Target{}
+	mu.Unlock()
+	if got := roundTrip("hi"); got != "" {
+		t.Errorf("reply without a target = %q", got)
+	}
+
+	l.Close()
+	if err := <-done; err != nil {
+		t.Errorf("Serve = %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(logs) != 3 || logs[0] != "forwarding to blue" || logs[1] != "forwarding to green" || !strings.Contains(logs[2], "nothing active") {
+		t.Errorf("logs = %q", logs)
+	}
+}
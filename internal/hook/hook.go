@@ -0,0 +1,151 @@
+// Package hook generates the shell code that keeps a project's port
+// variables exported as the user moves between directories.
+package hook
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Command is the hidden command the hook scripts run before each prompt.
+// It prints shell code that updates the exported variables.
+const Command = "__env"
+
+// EnvExported lists, space separated, the variables the hook exported last,
+// so they can be unset when they no longer apply.
+const EnvExported = "PORTPLS_EXPORTED"
+
+// ErrUnknownShell is returned for shells without a hook.
+var ErrUnknownShell = errors.New("unknown shell")
+
+// Shells lists the shells Script supports.
+var Shells = []string{"bash", "zsh", "fish"}
+
+// Script returns the hook script for shell. bash runs it from
+// PROMPT_COMMAND, zsh from its chpwd and precmd hooks and fish on prompts
+// and directory changes, so variables also follow allocation changes.
+func Script(shell string) (string, error) {
+	switch shell {
+	case "bash":
+		return bashScript, nil
+	case "zsh":
+		return zshScript, nil
+	case "fish":
+		return fishScript, nil
+	}
+	return "", fmt.Errorf("%w: %s (want bash, zsh or fish)", ErrUnknownShell, shell)
+}
+
+// Export returns shell code that unsets the variables in exported that are
+// not in vars, exports vars and records their names in EnvExported.
+func Export(shell string, vars map[string]string, exported string) (string, error) {
+	if _, err := Script(shell); err != nil {
+		return "", err
+	}
+	fish := shell == "fish"
+	var b strings.Builder
+	for _, name := range strings.Fields(exported) {
+		if _, ok := vars[name]; !ok {
+			writeUnset(&b, fish, name)
+		}
+	}
+	names := sortedNames(vars)
+	for _, name := range names {
+		writeExport(&b, fish, name, vars[name])
+	}
+	switch {
+	case len(names) > 0:
+		writeExport(&b, fish, EnvExported, strings.Join(names, " "))
+	case exported != "":
+		writeUnset(&b, fish, EnvExported)
+	}
+	return b.String(), nil
+}
+
+// Direnv returns code for an .envrc that exports vars and has direnv watch
+// the given files, so the environment is reloaded when they change.
+func Direnv(watch []string, vars map[string]string) string {
+	var b strings.Builder
+	if len(watch) > 0 {
+		quoted := make([]string, len(watch))
+		for i, path := range watch {
+			quoted[i] = quote(path)
+		}
+		fmt.Fprintf(&b, "watch_file %s\n", strings.Join(quoted, " "))
+	}
+	for _, name := range sortedNames(vars) {
+		writeExport(&b, false, name, vars[name])
+	}
+	return b.String()
+}
+
+func writeExport(b *strings.Builder, fish bool, name, value string) {
+	if fish {
+		fmt.Fprintf(b, "set -gx %s %s;\n", name, quoteFish(value))
+		return
+	}
+	fmt.Fprintf(b, "export %s=%s;\n", name, quote(value))
+}
+
+func writeUnset(b *strings.Builder, fish bool, name string) {
+	if fish {
+		fmt.Fprintf(b, "set -e %s;\n", name)
+		return
+	}
+	fmt.Fprintf(b, "unset %s;\n", name)
+}
+
+func sortedNames(vars map[string]string) []string {
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// quote quotes s for bash and zsh.
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// quoteFish quotes s for fish, where backslashes and single quotes are
+// escaped inside single quotes.
+func quoteFish(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+const bashScript = `# portpls hook for bash. Add to ~/.bashrc:
+#   eval "$(portpls hook bash)"
+_portpls_hook() {
+    local previous_exit_status=$?
+    eval "$(portpls __env bash 2>/dev/null)"
+    return $previous_exit_status
+}
+if [[ ";${PROMPT_COMMAND[*]:-};" != *";_portpls_hook;"* ]]; then
+    PROMPT_COMMAND="_portpls_hook${PROMPT_COMMAND:+;$PROMPT_COMMAND}"
+fi
+`
+
+const zshScript = `# portpls hook for zsh. Add to ~/.zshrc:
+#   eval "$(portpls hook zsh)"
+_portpls_hook() {
+    eval "$(portpls __env zsh 2>/dev/null)"
+}
+typeset -ag precmd_functions chpwd_functions
+if (( ! ${precmd_functions[(I)_portpls_hook]} )); then
+    precmd_functions=(_portpls_hook $precmd_functions)
+fi
+if (( ! ${chpwd_functions[(I)_portpls_hook]} )); then
+    chpwd_functions=(_portpls_hook $chpwd_functions)
+fi
+`
+
+const fishScript = `# portpls hook for fish. Add to ~/.config/fish/config.fish:
+#   portpls hook fish | source
+function __portpls_hook --on-event fish_prompt --on-variable PWD
+    portpls __env fish 2>/dev/null | source
+end
+`
@@ -0,0 +1,98 @@
+package hook
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestExport(t *testing.T) {
+	vars := map[string]string{"PORT": "20000", "API_PORT": "20001"}
+	tests := []struct {
+		name     string
+		shell    string
+		vars     map[string]string
+		exported string
+		want     string
+	}{
+		{
+			name:  "entering a project",
+			shell: "bash",
+			vars:  vars,
+			want: "export API_PORT='20001';\n" +
+				"export PORT='20000';\n" +
+				"export PORTPLS_EXPORTED='API_PORT PORT';\n",
+		},
+		{
+			name:     "switching projects unsets stale variables",
+			shell:    "zsh",
+			vars:     map[string]string{"PORT": "20005"},
+			exported: "API_PORT PORT",
+			want: "unset API_PORT;\n" +
+				"export PORT='20005';\n" +
+				"export PORTPLS_EXPORTED='PORT';\n",
+		},
+		{
+			name:     "leaving a project",
+			shell:    "fish",
+			exported: "API_PORT PORT",
+			want:     "set -e API_PORT;\nset -e PORT;\nset -e PORTPLS_EXPORTED;\n",
+		},
+		{
+			name:  "fish",
+			shell: "fish",
+			vars:  map[string]string{"PORT": "20000"},
+			want:  "set -gx PORT '20000';\nset -gx PORTPLS_EXPORTED 'PORT';\n",
+		},
+		{
+			name:  "outside projects",
+			shell: "bash",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Export(tt.shell, tt.vars, tt.exported)
+			if err != nil {
+				t.Fatalf("Export: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+	if _, err := Export("tcsh", vars, ""); !errors.Is(err, ErrUnknownShell) {
+		t.Errorf("Export(tcsh) error = %v, want ErrUnknownShell", err)
+	}
+}
+
+func TestDirenv(t *testing.T) {
+	got := Direnv([]string{"/data/allocations.db", "/data/allocations.db-wal"}, map[string]string{"PORT": "20000"})
+	want := "watch_file '/data/allocations.db' '/data/allocations.db-wal'\nexport PORT='20000';\n"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestScript(t *testing.T) {
+	for _, shell := range Shells {
+		script, err := Script(shell)
+		if err != nil {
+			t.Fatalf("Script(%s): %v", shell, err)
+		}
+		if !strings.Contains(script, "portpls "+Command+" "+shell) {
+			t.Errorf("%s hook does not call %s:\n%s", shell, Command, script)
+		}
+	}
+	if _, err := Script("tcsh"); !errors.Is(err, ErrUnknownShell) {
+		t.Errorf("Script(tcsh) error = %v, want ErrUnknownShell", err)
+	}
+}
+
+func TestQuote(t *testing.T) {
+	if got := quote(`it's`); got != `'it'\''s'` {
+		t.Errorf("quote = %s", got)
+	}
+	if got := quoteFish(`it's \o/`); got != `'it\'s \\o/'` {
+		t.Errorf("quoteFish = %s", got)
+	}
+}
@@ -0,0 +1,74 @@
+package labels
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	keyPattern   = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._/-]*[A-Za-z0-9])?$`)
+	valuePattern = regexp.MustCompile(`^([A-Za-z0-9]([A-Za-z0-9._-]*[A-Za-z0-9])?)?$`)
+)
+
+// ValidateKey checks that key is a non-empty label key made of letters,
+// digits, '.', '_', '-' and '/', starting and ending with a letter or digit.
+func ValidateKey(key string) error {
+	if !keyPattern.MatchString(key) {
+		return fmt.Errorf("invalid label key %q", key)
+	}
+	return nil
+}
+
+// ValidateValue checks that value is empty or made of letters, digits, '.',
+// '_' and '-', starting and ending with a letter or digit.
+func ValidateValue(value string) error {
+	if !valuePattern.MatchString(value) {
+		return fmt.Errorf("invalid label value %q", value)
+	}
+	return nil
+}
+
+// ParseAssignments parses "key=value" arguments into labels to set and
+// "key-" arguments into labels to remove.
+func ParseAssignments(args []string) (map[string]string, []string, error) {
+	set := map[string]string{}
+	var remove []string
+	for _, arg := range args {
+		arg = strings.TrimSpace(arg)
+		if key, ok := strings.CutSuffix(arg, "-"); ok && !strings.Contains(arg, "=") {
+			if err := ValidateKey(key); err != nil {
+				return nil, nil, err
+			}
+			remove = append(remove, key)
+			continue
+		}
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			return nil, nil, fmt.Errorf("%q is not a key=value label or a key- removal", arg)
+		}
+		if err := ValidateKey(key); err != nil {
+			return nil, nil, err
+		}
+		if err := ValidateValue(value); err != nil {
+			return nil, nil, err
+		}
+		set[key] = value
+	}
+	return set, remove, nil
+}
+
+// Format renders labels as "k1=v1,k2=v2" with keys in sorted order.
+func Format(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k + "=" + labels[k]
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,71 @@
+package labels
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseAssignments(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		wantSet    map[string]string
+		wantRemove []string
+		wantErr    bool
+	}{
+		{
+			name:    "sets labels",
+			args:    []string{"owner=alice", "ticket=PLAT-123", "team/area=infra"},
+			wantSet: map[string]string{"owner": "alice", "ticket": "PLAT-123", "team/area": "infra"},
+		},
+		{
+			name:    "allows empty values",
+			args:    []string{"scratch="},
+			wantSet: map[string]string{"scratch": ""},
+		},
+		{
+			name:       "removes labels",
+			args:       []string{"env-", "owner=bob"},
+			wantSet:    map[string]string{"owner": "bob"},
+			wantRemove: []string{"env"},
+		},
+		{
+			name:    "value ending in dash is not a removal",
+			args:    []string{"ref=a-"},
+			wantErr: true,
+		},
+		{name: "missing value", args: []string{"owner"}, wantErr: true},
+		{name: "empty key", args: []string{"=x"}, wantErr: true},
+		{name: "space in value", args: []string{"owner=alice smith"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set, remove, err := ParseAssignments(tt.args)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected error, got set=%v remove=%v", set, remove)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(set, tt.wantSet) {
+				t.Errorf("set = %v, want %v", set, tt.wantSet)
+			}
+			if !reflect.DeepEqual(remove, tt.wantRemove) {
+				t.Errorf("remove = %v, want %v", remove, tt.wantRemove)
+			}
+		})
+	}
+}
+
+func TestFormat(t *testing.T) {
+	got := Format(map[string]string{"owner": "alice", "env": "e2e"})
+	if got != "env=e2e,owner=alice" {
+		t.Errorf("Format = %q", got)
+	}
+	if got := Format(nil); got != "" {
+		t.Errorf("Format(nil) = %q, want empty", got)
+	}
+}
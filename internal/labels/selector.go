@@ -0,0 +1,196 @@
+package labels
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Operator is the comparison a Requirement makes.
+type Operator string
+
+const (
+	Equals       Operator = "="
+	NotEquals    Operator = "!="
+	In           Operator = "in"
+	NotIn        Operator = "notin"
+	Exists       Operator = "exists"
+	DoesNotExist Operator = "!"
+)
+
+// Requirement is one comma-separated term of a selector.
+type Requirement struct {
+	Key      string
+	Operator Operator
+	Values   []string
+}
+
+// Selector matches label sets using Kubernetes-style syntax. A selector is
+// a comma-separated list of requirements that must all hold:
+//
+//	env=e2e, env==e2e   label equals the value
+//	env!=e2e            label is missing or has another value
+//	env in (e2e,ci)     label is one of the values
+//	env notin (e2e,ci)  label is missing or none of the values
+//	env                 label is present
+//	!env                label is missing
+//
+// The zero Selector matches everything.
+type Selector struct {
+	Requirements []Requirement
+}
+
+var setPattern = regexp.MustCompile(`^(\S+)\s+(in|notin)\s*\((.*)\)$`)
+
+// ParseSelector parses a selector expression.
+func ParseSelector(s string) (Selector, error) {
+	var sel Selector
+	terms, err := splitTerms(s)
+	if err != nil {
+		return Selector{}, err
+	}
+	for _, term := range terms {
+		req, err := parseRequirement(term)
+		if err != nil {
+			return Selector{}, fmt.Errorf("invalid selector %q: %w", s, err)
+		}
+		sel.Requirements = append(sel.Requirements, req)
+	}
+	return sel, nil
+}
+
+// Empty reports whether the selector has no requirements.
+func (s Selector) Empty() bool {
+	return len(s.Requirements) == 0
+}
+
+// Matches reports whether labels satisfy every requirement.
+func (s Selector) Matches(labels map[string]string) bool {
+	for _, req := range s.Requirements {
+		if !req.Matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// String renders the selector in canonical form.
+func (s Selector) String() string {
+	parts := make([]string, len(s.Requirements))
+	for i, req := range s.Requirements {
+		parts[i] = req.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+// Matches reports whether labels satisfy the requirement.
+func (r Requirement) Matches(labels map[string]string) bool {
+	value, ok := labels[r.Key]
+	switch r.Operator {
+	case Equals:
+		return ok && value == r.Values[0]
+	case NotEquals:
+		return !ok || value != r.Values[0]
+	case In:
+		return ok && contains(r.Values, value)
+	case NotIn:
+		return !ok || !contains(r.Values, value)
+	case Exists:
+		return ok
+	case DoesNotExist:
+		return !ok
+	}
+	return false
+}
+
+func (r Requirement) String() string {
+	switch r.Operator {
+	case Equals, NotEquals:
+		return r.Key + string(r.Operator) + r.Values[0]
+	case In, NotIn:
+		return fmt.Sprintf("%s %s (%s)", r.Key, r.Operator, strings.Join(r.Values, ","))
+	case DoesNotExist:
+		return "!" + r.Key
+	}
+	return r.Key
+}
+
+// splitTerms splits s on commas that are not inside parentheses.
+func splitTerms(s string) ([]string, error) {
+	var terms []string
+	depth, start := 0, 0
+	for i, c := range s {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth < 0 {
+				return nil, fmt.Errorf("invalid selector %q: unbalanced parentheses", s)
+			}
+		case ',':
+			if depth == 0 {
+				terms = appendTerm(terms, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("invalid selector %q: unbalanced parentheses", s)
+	}
+	return appendTerm(terms, s[start:]), nil
+}
+
+func appendTerm(terms []string, term string) []string {
+	if term = strings.TrimSpace(term); term != "" {
+		terms = append(terms, term)
+	}
+	return terms
+}
+
+func parseRequirement(term string) (Requirement, error) {
+	if m := setPattern.FindStringSubmatch(term); m != nil {
+		var values []string
+		for _, v := range strings.Split(m[3], ",") {
+			v = strings.TrimSpace(v)
+			if err := ValidateValue(v); err != nil {
+				return Requirement{}, err
+			}
+			values = append(values, v)
+		}
+		return newRequirement(m[1], Operator(m[2]), values...)
+	}
+	for _, op := range []string{"!=", "==", "="} {
+		if key, value, ok := strings.Cut(term, op); ok {
+			value = strings.TrimSpace(value)
+			if err := ValidateValue(value); err != nil {
+				return Requirement{}, err
+			}
+			operator := Equals
+			if op == "!=" {
+				operator = NotEquals
+			}
+			return newRequirement(strings.TrimSpace(key), operator, value)
+		}
+	}
+	if key, ok := strings.CutPrefix(term, "!"); ok {
+		return newRequirement(strings.TrimSpace(key), DoesNotExist)
+	}
+	return newRequirement(term, Exists)
+}
+
+func newRequirement(key string, op Operator, values ...string) (Requirement, error) {
+	if err := ValidateKey(key); err != nil {
+		return Requirement{}, err
+	}
+	return Requirement{Key: key, Operator: op, Values: values}, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
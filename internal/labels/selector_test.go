@@ -0,0 +1,66 @@
+package labels
+
+import "testing"
+
+func TestSelector(t *testing.T) {
+	labels := map[string]string{"env": "e2e", "owner": "alice"}
+	tests := []struct {
+		selector string
+		want     bool
+	}{
+		{"", true},
+		{"env=e2e", true},
+		{"env==e2e", true},
+		{"env=ci", false},
+		{"env!=ci", true},
+		{"ticket!=PLAT-1", true},
+		{"env in (ci, e2e)", true},
+		{"env in (ci)", false},
+		{"env notin (ci,dev)", true},
+		{"ticket notin (x)", true},
+		{"owner", true},
+		{"ticket", false},
+		{"!ticket", true},
+		{"!owner", false},
+		{"env=e2e,owner=alice", true},
+		{"env in (e2e,ci), owner=bob", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			sel, err := ParseSelector(tt.selector)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := sel.Matches(labels); got != tt.want {
+				t.Errorf("Matches = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSelectorErrors(t *testing.T) {
+	for _, s := range []string{
+		"env in (e2e",
+		"env)",
+		"=e2e",
+		"env=e 2e",
+		"!",
+		"env in (a b)",
+	} {
+		t.Run(s, func(t *testing.T) {
+			if _, err := ParseSelector(s); err == nil {
+				t.Errorf("expected error for %q", s)
+			}
+		})
+	}
+}
+
+func TestSelectorString(t *testing.T) {
+	sel, err := ParseSelector("env==e2e, tier in (a,b),!ticket,owner")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := sel.String(); got != "env=e2e,tier in (a,b),!ticket,owner" {
+		t.Errorf("String = %q", got)
+	}
+}
@@ -0,0 +1,175 @@
+package output
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bamorim/portpls/internal/app"
+	"github.com/bamorim/portpls/internal/labels"
+)
+
+// Column is one field of an allocation entry. Its Name is the key used in
+// --columns, the CSV/TSV header and the JSON/YAML output.
+type Column struct {
+	Name   string
+	Header string                          // table header
+	value  func(e app.AllocationEntry) any // typed value for JSON and YAML
+	text   func(e app.AllocationEntry) string
+	human  func(e app.AllocationEntry) string // table cell; defaults to text
+}
+
+var columns = []Column{
+	{
+		Name:   "port",
+		Header: "PORT",
+		value:  func(e app.AllocationEntry) any { return e.Port },
+		text:   func(e app.AllocationEntry) string { return strconv.Itoa(e.Port) },
+	},
+	{
+		Name:   "directory",
+		Header: "DIRECTORY",
+		value:  func(e app.AllocationEntry) any { return e.Directory },
+		text:   func(e app.AllocationEntry) string { return e.Directory },
+		human:  func(e app.AllocationEntry) string { return ShortenHome(e.Directory) },
+	},
+	{
+		Name:   "name",
+		Header: "NAME",
+		value:  func(e app.AllocationEntry) any { return e.Name },
+		text:   func(e app.AllocationEntry) string { return e.Name },
+	},
+	{
+		Name:   "status",
+		Header: "STATUS",
+		value:  func(e app.AllocationEntry) any { return e.Status },
+		text:   func(e app.AllocationEntry) string { return e.Status },
+	},
+	{
+		Name:   "locked",
+		Header: "LOCKED",
+		value:  func(e app.AllocationEntry) any { return e.Locked },
+		text:   func(e app.AllocationEntry) string { return strconv.FormatBool(e.Locked) },
+		human:  func(e app.AllocationEntry) string { return YesNo(e.Locked) },
+	},
+	{
+		Name:   "assigned_at",
+		Header: "ASSIGNED",
+		value:  func(e app.AllocationEntry) any { return e.AssignedAt },
+		text:   func(e app.AllocationEntry) string { return e.AssignedAt.UTC().Format(time.RFC3339) },
+		human:  func(e app.AllocationEntry) string { return FormatTimestamp(e.AssignedAt) },
+	},
+	{
+		Name:   "last_used_at",
+		Header: "LAST_USED",
+		value:  func(e app.AllocationEntry) any { return e.LastUsedAt },
+		text:   func(e app.AllocationEntry) string { return e.LastUsedAt.UTC().Format(time.RFC3339) },
+		human:  func(e app.AllocationEntry) string { return FormatTimestamp(e.LastUsedAt) },
+	},
+	{
+		Name:   "labels",
+		Header: "LABELS",
+		value:  func(e app.AllocationEntry) any { return e.Labels },
+		text:   func(e app.AllocationEntry) string { return labels.Format(e.Labels) },
+	},
+	{
+		Name:   "note",
+		Header: "NOTE",
+		value:  func(e app.AllocationEntry) any { return e.Note },
+		text:   func(e app.AllocationEntry) string { return e.Note },
+	},
+}
+
+// DefaultColumns are shown when --columns is not given.
+var DefaultColumns = []string{"port", "directory", "name", "status", "locked", "assigned_at", "last_used_at"}
+
+// ColumnNames returns every column name in output order.
+func ColumnNames() []string {
+	names := make([]string, len(columns))
+	for i, c := range columns {
+		names[i] = c.Name
+	}
+	return names
+}
+
+// ParseColumns parses a comma-separated list of column names.
+func ParseColumns(s string) ([]string, error) {
+	var names []string
+	for _, part := range strings.Split(s, ",") {
+		name := strings.TrimSpace(part)
+		if name == "" {
+			continue
+		}
+		if _, err := lookupColumn(name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return nil, app.NewCodeError(2, fmt.Errorf("no columns given (available: %s)", strings.Join(ColumnNames(), ", ")))
+	}
+	return names, nil
+}
+
+func lookupColumn(name string) (Column, error) {
+	for _, c := range columns {
+		if c.Name == name {
+			return c, nil
+		}
+	}
+	return Column{}, app.NewCodeError(2, fmt.Errorf("unknown column %q (available: %s)", name, strings.Join(ColumnNames(), ", ")))
+}
+
+func selectColumns(names []string) ([]Column, error) {
+	if len(names) == 0 {
+		names = DefaultColumns
+	}
+	out := make([]Column, 0, len(names))
+	for _, name := range names {
+		c, err := lookupColumn(name)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+func (c Column) humanText(e app.AllocationEntry) string {
+	if c.human != nil {
+		return c.human(e)
+	}
+	return c.text(e)
+}
+
+// FormatTimestamp renders t in local time for tables.
+func FormatTimestamp(t time.Time) string {
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+// ShortenHome replaces the home directory prefix of path with "~".
+func ShortenHome(path string) string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	if strings.HasPrefix(path, home) {
+		remainder := strings.TrimPrefix(path, home)
+		if remainder == "" {
+			return "~"
+		}
+		return filepath.Join("~", remainder)
+	}
+	return path
+}
+
+// YesNo formats a flag the way the table shows it.
+func YesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
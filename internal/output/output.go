@@ -0,0 +1,262 @@
+// Package output renders allocation entries for the list command.
+package output
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+
+	"github.com/bamorim/portpls/internal/app"
+	"github.com/bamorim/portpls/internal/labels"
+)
+
+// Formats accepted by Write, besides "template=<go template>".
+const (
+	FormatTable  = "table"
+	FormatJSON   = "json"
+	FormatNDJSON = "ndjson"
+	FormatCSV    = "csv"
+	FormatTSV    = "tsv"
+	FormatYAML   = "yaml"
+
+	templatePrefix = "template="
+)
+
+// Options controls which columns are written and whether tabular formats
+// start with a header row.
+type Options struct {
+	Columns  []string // column names; empty means DefaultColumns
+	NoHeader bool
+}
+
+// IsTable reports whether format is the human-readable table.
+func IsTable(format string) bool {
+	return strings.ToLower(format) == FormatTable
+}
+
+// Write renders entries to w in the given format. JSON, NDJSON and YAML
+// write every field of the JSON contract unless columns are selected.
+func Write(w io.Writer, format string, entries []app.AllocationEntry, opts Options) error {
+	if tmpl, ok := strings.CutPrefix(format, templatePrefix); ok {
+		return writeTemplate(w, tmpl, entries)
+	}
+	var cols []Column
+	var err error
+	if len(opts.Columns) > 0 {
+		if cols, err = selectColumns(opts.Columns); err != nil {
+			return err
+		}
+	}
+	switch strings.ToLower(format) {
+	case FormatTable:
+		if cols == nil {
+			cols, _ = selectColumns(nil)
+		}
+		return writeTable(w, cols, entries, opts.NoHeader)
+	case FormatJSON:
+		return writeJSON(w, cols, entries)
+	case FormatNDJSON:
+		return writeNDJSON(w, cols, entries)
+	case FormatCSV, FormatTSV:
+		if cols == nil {
+			cols, _ = selectColumns(nil)
+		}
+		return writeCSV(w, cols, entries, opts.NoHeader, strings.ToLower(format) == FormatTSV)
+	case FormatYAML:
+		if cols == nil {
+			cols = columns
+		}
+		return writeYAML(w, cols, entries)
+	default:
+		return app.NewCodeError(1, fmt.Errorf("%w: %s (want table, json, ndjson, csv, tsv, yaml or template=...)", app.ErrUnknownFormat, format))
+	}
+}
+
+// WriteTree renders groups as a directory tree for list --group-by.
+func WriteTree(w io.Writer, groups []app.EntryGroup, showLabels bool) error {
+	for _, group := range groups {
+		fmt.Fprintln(w, ShortenHome(group.Key))
+		writer := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		for i, entry := range group.Entries {
+			branch := "├──"
+			if i == len(group.Entries)-1 {
+				branch = "└──"
+			}
+			locked := "unlocked"
+			if entry.Locked {
+				locked = "locked"
+			}
+			fmt.Fprintf(writer, "%s %d\t%s\t%s\t%s\tlast used %s",
+				branch, entry.Port, entry.Name, entry.Status, locked, FormatTimestamp(entry.LastUsedAt))
+			if showLabels {
+				fmt.Fprintf(writer, "\t%s\t%s", labels.Format(entry.Labels), entry.Note)
+			}
+			fmt.Fprintln(writer)
+		}
+		if err := writer.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeTable(w io.Writer, cols []Column, entries []app.AllocationEntry, noHeader bool) error {
+	writer := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if !noHeader {
+		headers := make([]string, len(cols))
+		for i, c := range cols {
+			headers[i] = c.Header
+		}
+		fmt.Fprintln(writer, strings.Join(headers, "\t"))
+	}
+	for _, entry := range entries {
+		cells := make([]string, len(cols))
+		for i, c := range cols {
+			cells[i] = c.humanText(entry)
+		}
+		fmt.Fprintln(writer, strings.Join(cells, "\t"))
+	}
+	return writer.Flush()
+}
+
+func writeCSV(w io.Writer, cols []Column, entries []app.AllocationEntry, noHeader, tabs bool) error {
+	writer := csv.NewWriter(w)
+	if tabs {
+		writer.Comma = '\t'
+	}
+	if !noHeader {
+		headers := make([]string, len(cols))
+		for i, c := range cols {
+			headers[i] = c.Name
+		}
+		if err := writer.Write(headers); err != nil {
+			return err
+		}
+	}
+	for _, entry := range entries {
+		record := make([]string, len(cols))
+		for i, c := range cols {
+			record[i] = c.text(entry)
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func writeJSON(w io.Writer, cols []Column, entries []app.AllocationEntry) error {
+	items := make([]json.RawMessage, 0, len(entries))
+	for _, entry := range entries {
+		item, err := encodeEntry(cols, entry)
+		if err != nil {
+			return err
+		}
+		items = append(items, item)
+	}
+	payload, err := json.MarshalIndent(items, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(payload))
+	return err
+}
+
+func writeNDJSON(w io.Writer, cols []Column, entries []app.AllocationEntry) error {
+	for _, entry := range entries {
+		item, err := encodeEntry(cols, entry)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintln(w, string(item)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeEntry encodes entry as a JSON object: the full AllocationEntry
+// contract when cols is nil, otherwise only the selected columns in order.
+func encodeEntry(cols []Column, entry app.AllocationEntry) (json.RawMessage, error) {
+	if cols == nil {
+		return json.Marshal(entry)
+	}
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, c := range cols {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(c.Name)
+		value, err := json.Marshal(c.value(entry))
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// WritePrompt renders each entry with the Go template text and writes them
+// on one line, joined by separator. Nothing is written without entries.
+func WritePrompt(w io.Writer, text, separator string, entries []app.AllocationEntry) error {
+	tmpl, err := parseTemplate(text)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	segments := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		var b strings.Builder
+		if err := tmpl.Execute(&b, entry); err != nil {
+			return err
+		}
+		segments = append(segments, b.String())
+	}
+	_, err = fmt.Fprintln(w, strings.Join(segments, separator))
+	return err
+}
+
+func parseTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("list").Funcs(template.FuncMap{
+		"labels": labels.Format,
+		"home":   ShortenHome,
+		"json": func(v any) (string, error) {
+			data, err := json.Marshal(v)
+			return string(data), err
+		},
+	}).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, app.NewCodeError(2, fmt.Errorf("invalid template: %w", err))
+	}
+	return tmpl, nil
+}
+
+func writeTemplate(w io.Writer, text string, entries []app.AllocationEntry) error {
+	tmpl, err := parseTemplate(text)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := tmpl.Execute(w, entry); err != nil {
+			return err
+		}
+		if !strings.HasSuffix(text, "\n") {
+			if _, err := fmt.Fprintln(w); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/bamorim/portpls/internal/app"
+)
+
+func testEntries() []app.AllocationEntry {
+	at := time.Date(2026, 1, 21, 10, 0, 0, 0, time.UTC)
+	return []app.AllocationEntry{
+		{
+			Port: 20000, Directory: "/work/a", Name: "web", Status: app.StatusBusy,
+			AssignedAt: at, LastUsedAt: at.Add(time.Hour),
+			Labels: map[string]string{"env": "e2e", "owner": "alice"}, Note: `say "hi"`,
+		},
+		{
+			Port: 20001, Directory: "/work/b,c", Name: "main", Status: app.StatusFree, Locked: true,
+			AssignedAt: at, LastUsedAt: at, Labels: map[string]string{},
+		},
+	}
+}
+
+func render(t *testing.T, format string, opts Options) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := Write(&buf, format, testEntries(), opts); err != nil {
+		t.Fatalf("Write(%q): %v", format, err)
+	}
+	return buf.String()
+}
+
+func TestWriteJSONContract(t *testing.T) {
+	var got []map[string]any
+	if err := json.Unmarshal([]byte(render(t, FormatJSON, Options{})), &got); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	want := map[string]any{
+		"port":         float64(20000),
+		"directory":    "/work/a",
+		"name":         "web",
+		"status":       "busy",
+		"locked":       false,
+		"assigned_at":  "2026-01-21T10:00:00Z",
+		"last_used_at": "2026-01-21T11:00:00Z",
+		"labels":       map[string]any{"env": "e2e", "owner": "alice"},
+		"note":         `say "hi"`,
+	}
+	if len(got) != 2 || !reflect.DeepEqual(got[0], want) {
+		t.Errorf("first entry = %v, want %v", got[0], want)
+	}
+}
+
+func TestWriteNDJSON(t *testing.T) {
+	lines := strings.Split(strings.TrimSpace(render(t, FormatNDJSON, Options{Columns: []string{"port", "locked"}})), "\n")
+	want := []string{`{"port":20000,"locked":false}`, `{"port":20001,"locked":true}`}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("lines = %q, want %q", lines, want)
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		opts   Options
+		want   string
+	}{
+		{
+			name:   "csv quotes fields",
+			format: FormatCSV,
+			opts:   Options{Columns: []string{"port", "directory", "labels"}},
+			want:   "port,directory,labels\n20000,/work/a,\"env=e2e,owner=alice\"\n20001,\"/work/b,c\",\n",
+		},
+		{
+			name:   "tsv without header",
+			format: FormatTSV,
+			opts:   Options{Columns: []string{"port", "name", "last_used_at"}, NoHeader: true},
+			want:   "20000\tweb\t2026-01-21T11:00:00Z\n20001\tmain\t2026-01-21T10:00:00Z\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := render(t, tt.format, tt.opts); got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteTable(t *testing.T) {
+	got := render(t, FormatTable, Options{Columns: []string{"port", "name", "locked"}})
+	want := "PORT   NAME  LOCKED\n20000  web   no\n20001  main  yes\n"
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if got := render(t, FormatTable, Options{Columns: []string{"port"}, NoHeader: true}); got != "20000\n20001\n" {
+		t.Errorf("no-header table = %q", got)
+	}
+}
+
+func TestWriteYAML(t *testing.T) {
+	got := render(t, FormatYAML, Options{Columns: []string{"port", "labels", "note"}})
+	want := `- port: 20000
+  labels:
+    env: e2e
+    owner: alice
+  note: say "hi"
+- port: 20001
+  labels: {}
+  note: ""
+`
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	var decoded []map[string]any
+	if err := yaml.Unmarshal([]byte(render(t, FormatYAML, Options{})), &decoded); err != nil {
+		t.Fatalf("output is not valid YAML: %v", err)
+	}
+	if len(decoded) != 2 || decoded[0]["port"] != 20000 || decoded[0]["note"] != `say "hi"` {
+		t.Errorf("decoded = %v", decoded)
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, FormatYAML, nil, Options{}); err != nil || buf.String() != "[]\n" {
+		t.Errorf("empty YAML = %q, %v", buf.String(), err)
+	}
+}
+
+func TestWriteTemplate(t *testing.T) {
+	got := render(t, "template={{.Port}} {{.Name}} {{.Labels.env}}", Options{})
+	if want := "20000 web e2e\n20001 main \n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	got = render(t, `template={{.Port}}:{{labels .Labels}};`, Options{})
+	if want := "20000:env=e2e,owner=alice;\n20001:;\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, "template={{.Port", testEntries(), Options{}); err == nil {
+		t.Error("expected error for invalid template")
+	}
+}
+
+func TestWritePrompt(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WritePrompt(&buf, "{{.Name}}:{{.Port}}", " | ", testEntries()); err != nil {
+		t.Fatalf("WritePrompt: %v", err)
+	}
+	if want := "web:20000 | main:20001\n"; buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+	buf.Reset()
+	if err := WritePrompt(&buf, "{{.Port}}", " ", nil); err != nil || buf.Len() != 0 {
+		t.Errorf("WritePrompt without entries = %q, %v; want nothing", buf.String(), err)
+	}
+	if err := WritePrompt(&buf, "{{.Port", " ", nil); err == nil {
+		t.Error("expected error for invalid template")
+	}
+}
+
+func TestWriteErrors(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, "xml", testEntries(), Options{}); !errors.Is(err, app.ErrUnknownFormat) {
+		t.Errorf("error = %v, want ErrUnknownFormat", err)
+	}
+	if _, err := ParseColumns("port,size"); err == nil {
+		t.Error("expected error for unknown column")
+	}
+	if cols, err := ParseColumns(" port , name "); err != nil || !reflect.DeepEqual(cols, []string{"port", "name"}) {
+		t.Errorf("ParseColumns = %v, %v", cols, err)
+	}
+}
+
+func TestWriteFrame(t *testing.T) {
+	previous := testEntries()
+	current := testEntries()
+	current[0].Status = app.StatusFree
+	current = current[:1]
+	current = append(current, app.AllocationEntry{Port: 20002, Directory: "/work/c", Name: "api", Status: app.StatusBusy, Labels: map[string]string{}})
+	unchanged := testEntries()[:1]
+
+	var buf bytes.Buffer
+	opts := Options{Columns: []string{"port", "name", "status"}}
+	if err := WriteFrame(&buf, current, previous, opts, time.Now()); err != nil {
+		t.Fatalf("WriteFrame: %v", err)
+	}
+	lines := strings.Split(buf.String(), "\n")
+	want := []string{
+		"PORT   NAME  STATUS",
+		highlight + "20000  web   free" + reset,
+		highlight + "20002  api   busy" + reset,
+		dim + "- 20001  /work/b,c  main (removed)" + reset,
+	}
+	if !reflect.DeepEqual(lines[2:6], want) {
+		t.Errorf("lines = %q, want %q", lines[2:6], want)
+	}
+
+	buf.Reset()
+	if err := WriteFrame(&buf, unchanged, unchanged, opts, time.Now()); err != nil {
+		t.Fatalf("WriteFrame: %v", err)
+	}
+	if strings.Contains(buf.String(), highlight) {
+		t.Errorf("unchanged frame has highlights: %q", buf.String())
+	}
+}
@@ -0,0 +1,63 @@
+package output
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/bamorim/portpls/internal/app"
+)
+
+// ANSI sequences used by WriteFrame.
+const (
+	clearScreen = "\033[H\033[2J"
+	highlight   = "\033[7m" // reverse video
+	dim         = "\033[2m"
+	reset       = "\033[0m"
+)
+
+// WriteFrame clears the terminal and renders entries as a table for list
+// --watch. Rows that are new or differ from previous are highlighted and
+// allocations that disappeared are listed below the table. previous is nil
+// for the first frame, which highlights nothing.
+func WriteFrame(w io.Writer, entries, previous []app.AllocationEntry, opts Options, at time.Time) error {
+	var table bytes.Buffer
+	if err := Write(&table, FormatTable, entries, opts); err != nil {
+		return err
+	}
+	lines := strings.SplitAfter(table.String(), "\n")
+	offset := 1
+	if opts.NoHeader {
+		offset = 0
+	}
+
+	before := map[int]app.AllocationEntry{}
+	for _, e := range previous {
+		before[e.Port] = e
+	}
+	var out strings.Builder
+	out.WriteString(clearScreen)
+	fmt.Fprintf(&out, "Allocations at %s (Ctrl-C to quit)\n\n", at.Local().Format("15:04:05"))
+	for i, line := range lines {
+		if i >= offset && i-offset < len(entries) && previous != nil {
+			entry := entries[i-offset]
+			if old, ok := before[entry.Port]; !ok || !reflect.DeepEqual(old, entry) {
+				line = highlight + strings.TrimSuffix(line, "\n") + reset + "\n"
+			}
+			delete(before, entry.Port)
+		}
+		out.WriteString(line)
+	}
+	if previous != nil {
+		for _, e := range previous {
+			if _, removed := before[e.Port]; removed {
+				fmt.Fprintf(&out, "%s- %d  %s  %s (removed)%s\n", dim, e.Port, ShortenHome(e.Directory), e.Name, reset)
+			}
+		}
+	}
+	_, err := io.WriteString(w, out.String())
+	return err
+}
@@ -0,0 +1,37 @@
+package output
+
+import (
+	"io"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/bamorim/portpls/internal/app"
+)
+
+// writeYAML writes entries as a YAML sequence of mappings, with the keys in
+// column order. Timestamps are written as RFC 3339 strings like in JSON.
+func writeYAML(w io.Writer, cols []Column, entries []app.AllocationEntry) error {
+	doc := &yaml.Node{Kind: yaml.SequenceNode}
+	for _, entry := range entries {
+		item := &yaml.Node{Kind: yaml.MappingNode}
+		for _, c := range cols {
+			value := c.value(entry)
+			if t, ok := value.(time.Time); ok {
+				value = t.UTC().Format(time.RFC3339Nano)
+			}
+			var node yaml.Node
+			if err := node.Encode(value); err != nil {
+				return err
+			}
+			item.Content = append(item.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: c.Name}, &node)
+		}
+		doc.Content = append(doc.Content, item)
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	return enc.Close()
+}
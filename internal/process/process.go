@@ -10,37 +10,51 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
 )
 
 type Info struct {
-	PID     int
-	Command string
-	Cwd     string
+	PID     int    `json:"pid"`
+	Command string `json:"command"`
+	Cwd     string `json:"cwd"`
+	User    string `json:"user"`
+	UID     int    `json:"uid"`
 }
 
 func FindByPort(port int) (*Info, error) {
-	cmd := exec.Command("lsof", "-nP", fmt.Sprintf("-iTCP:%d", port), "-sTCP:LISTEN", "-Fpnc")
+	cmd := exec.Command("lsof", "-nP", fmt.Sprintf("-iTCP:%d", port), "-sTCP:LISTEN", "-FpncLu")
 	out, err := cmd.Output()
 	if err != nil {
 		return nil, err
 	}
 	lines := bytes.Split(out, []byte{'\n'})
-	info := &Info{}
+	info := &Info{UID: -1}
+fields:
 	for _, line := range lines {
 		if len(line) < 2 {
 			continue
 		}
 		switch line[0] {
 		case 'p':
+			if info.PID != 0 {
+				// Only report the first listening process
+				break fields
+			}
 			pid, err := strconv.Atoi(string(line[1:]))
 			if err == nil {
 				info.PID = pid
 			}
 		case 'c':
 			info.Command = string(line[1:])
-		}
-		if info.PID != 0 && info.Command != "" {
-			break
+		case 'L':
+			info.User = string(line[1:])
+		case 'u':
+			uid, err := strconv.Atoi(string(line[1:]))
+			if err == nil {
+				info.UID = uid
+			}
 		}
 	}
 	if info.PID == 0 {
@@ -51,6 +65,33 @@ func FindByPort(port int) (*Info, error) {
 	return info, nil
 }
 
+// Terminate sends SIGTERM to pid and, if it is still running after timeout,
+// SIGKILL. It reports whether SIGKILL was needed. A negative pid signals
+// the process group -pid.
+func Terminate(pid int, timeout time.Duration) (bool, error) {
+	if err := unix.Kill(pid, unix.SIGTERM); err != nil {
+		if errors.Is(err, unix.ESRCH) {
+			return false, nil
+		}
+		return false, err
+	}
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if !running(pid) {
+			return false, nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if err := unix.Kill(pid, unix.SIGKILL); err != nil && !errors.Is(err, unix.ESRCH) {
+		return true, err
+	}
+	return true, nil
+}
+
+func running(pid int) bool {
+	return unix.Kill(pid, 0) == nil
+}
+
 func findCwd(pid int) (string, error) {
 	switch runtime.GOOS {
 	case "linux":
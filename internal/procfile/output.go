@@ -0,0 +1,80 @@
+package procfile
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// colors cycle through the processes, skipping red so errors stand out.
+var colors = []string{"36", "33", "32", "35", "34", "96", "93", "92", "95", "94"}
+
+// mux writes the output of several processes to one writer, a whole line
+// at a time, each line prefixed with the time and the process name.
+type mux struct {
+	mu     sync.Mutex
+	out    io.Writer
+	width  int
+	color  bool
+	colors map[string]string
+	now    func() time.Time
+}
+
+func newMux(out io.Writer, names []string, color bool) *mux {
+	m := &mux{out: out, color: color, colors: map[string]string{}, now: time.Now}
+	for i, name := range names {
+		m.width = max(m.width, len(name))
+		m.colors[name] = colors[i%len(colors)]
+	}
+	return m
+}
+
+// writer returns the writer for the process called name.
+func (m *mux) writer(name string) *lineWriter {
+	return &lineWriter{mux: m, name: name}
+}
+
+func (m *mux) writeLine(name string, line []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	prefix := fmt.Sprintf("%s %-*s |", m.now().Format("15:04:05"), m.width, name)
+	if m.color {
+		prefix = "\x1b[" + m.colors[name] + "m" + prefix + "\x1b[0m"
+	}
+	fmt.Fprintf(m.out, "%s %s\n", prefix, line)
+}
+
+// lineWriter buffers a process's output until it has a whole line.
+type lineWriter struct {
+	mux     *mux
+	name    string
+	mu      sync.Mutex
+	partial []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		w.mux.writeLine(w.name, bytes.TrimSuffix(w.partial[:i], []byte("\r")))
+		w.partial = w.partial[i+1:]
+	}
+	return len(p), nil
+}
+
+// flush writes what is left of an unterminated last line.
+func (w *lineWriter) flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.partial) > 0 {
+		w.mux.writeLine(w.name, w.partial)
+		w.partial = nil
+	}
+}
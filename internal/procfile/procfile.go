@@ -0,0 +1,111 @@
+// Package procfile implements portpls run, which starts the processes of a
+// Procfile on allocated ports and supervises them together.
+package procfile
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Entry is a process type in a Procfile.
+type Entry struct {
+	Name    string
+	Command string
+}
+
+// Parse reads a Procfile: one "name: command" per line. Blank lines and
+// lines starting with # are skipped. Names are letters, digits, dashes and
+// underscores, and must be unique.
+func Parse(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	seen := map[string]bool{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		name, command, ok := strings.Cut(text, ":")
+		name, command = strings.TrimSpace(name), strings.TrimSpace(command)
+		if !ok || !validName(name) || command == "" {
+			return nil, fmt.Errorf("line %d: want \"name: command\", got %q", line, text)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("line %d: duplicate process %q", line, name)
+		}
+		seen[name] = true
+		entries = append(entries, Entry{Name: name, Command: command})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("no processes defined")
+	}
+	return entries, nil
+}
+
+// ParseError is returned by Load for a Procfile it can't parse.
+type ParseError struct {
+	Path string
+	Err  error
+}
+
+func (e *ParseError) Error() string { return e.Path + ": " + e.Err.Error() }
+func (e *ParseError) Unwrap() error { return e.Err }
+
+// Load reads and parses the Procfile at path.
+func Load(path string) ([]Entry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	entries, err := Parse(file)
+	if err != nil {
+		return nil, &ParseError{Path: path, Err: err}
+	}
+	return entries, nil
+}
+
+func validName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Select returns the entries with the given names, in Procfile order, or
+// all of them when names is empty.
+func Select(entries []Entry, names []string) ([]Entry, error) {
+	if len(names) == 0 {
+		return entries, nil
+	}
+	wanted := map[string]bool{}
+	for _, name := range names {
+		wanted[name] = true
+	}
+	var out []Entry
+	for _, e := range entries {
+		if wanted[e.Name] {
+			out = append(out, e)
+			delete(wanted, e.Name)
+		}
+	}
+	for _, name := range names {
+		if wanted[name] {
+			return nil, fmt.Errorf("no process %q in the Procfile", name)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,74 @@
+package procfile
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	entries, err := Parse(strings.NewReader(`
+# processes
+web: bundle exec rails server -p $PORT
+worker:   sidekiq -c 5
+
+css_watch: npm run css -- --watch
+`))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	want := []Entry{
+		{Name: "web", Command: "bundle exec rails server -p $PORT"},
+		{Name: "worker", Command: "sidekiq -c 5"},
+		{Name: "css_watch", Command: "npm run css -- --watch"},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("Parse = %+v, want %+v", entries, want)
+	}
+
+	for _, input := range []string{
+		"web rails server\n",
+		"web:\n",
+		"my web: rails server\n",
+		"web: a\nweb: b\n",
+		"# nothing\n",
+	} {
+		if _, err := Parse(strings.NewReader(input)); err == nil {
+			t.Errorf("Parse(%q) succeeded, want error", input)
+		}
+	}
+}
+
+func TestSelect(t *testing.T) {
+	entries := []Entry{{Name: "web"}, {Name: "worker"}, {Name: "clock"}}
+	got, err := Select(entries, []string{"clock", "web"})
+	if err != nil || !reflect.DeepEqual(got, []Entry{{Name: "web"}, {Name: "clock"}}) {
+		t.Errorf("Select = %+v, %v; want web and clock in Procfile order", got, err)
+	}
+	if _, err := Select(entries, []string{"mail"}); err == nil {
+		t.Error("expected error for unknown process")
+	}
+}
+
+func TestMux(t *testing.T) {
+	var out bytes.Buffer
+	m := newMux(&out, []string{"system", "web"}, false)
+	m.now = func() time.Time { return time.Date(2024, 1, 1, 9, 30, 0, 0, time.UTC) }
+	w := m.writer("web")
+	w.Write([]byte("listening"))
+	w.Write([]byte(" on 20000\r\nready\npart"))
+	w.flush()
+	want := "09:30:00 web    | listening on 20000\n09:30:00 web    | ready\n09:30:00 web    | part\n"
+	if out.String() != want {
+		t.Errorf("output =\n%q, want\n%q", out.String(), want)
+	}
+
+	out.Reset()
+	m.color = true
+	m.writer("system").Write([]byte("hi\n"))
+	if got := out.String(); !strings.HasPrefix(got, "\x1b[36m09:30:00 system |\x1b[0m hi") {
+		t.Errorf("colored output = %q", got)
+	}
+}
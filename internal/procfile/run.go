@@ -0,0 +1,156 @@
+package procfile
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/bamorim/portpls/internal/app"
+	"github.com/bamorim/portpls/internal/process"
+)
+
+// Options configures Run.
+type Options struct {
+	App      app.Options
+	Procfile string        // empty uses the Procfile in the selected directory
+	Names    []string      // processes to start; empty starts all of them
+	Timeout  time.Duration // SIGTERM to SIGKILL delay at shutdown
+	Output   io.Writer
+	Color    bool
+}
+
+type exit struct {
+	name string
+	err  error
+}
+
+// Run allocates a port named after each process in the Procfile, all of
+// them in one go so a full range leaves none allocated. It starts them all
+// with PORT set to their port and writes their output line by line with a
+// prefix. Processes run with the Procfile's directory as working directory,
+// each in its own process group. When one of them exits, or Run gets
+// SIGINT, SIGTERM or SIGHUP, every process group is sent SIGTERM and, after
+// Timeout, SIGKILL.
+//
+// Run returns nil after a signal or when the first process to exit
+// succeeded, and otherwise a CodeError with that process's exit code.
+func Run(opts Options) error {
+	path := opts.Procfile
+	if path == "" {
+		directory, err := opts.App.Directory.ResolveDirectory()
+		if err != nil {
+			return err
+		}
+		path = filepath.Join(directory, "Procfile")
+	}
+	entries, err := Load(path)
+	if err != nil {
+		var parseErr *ParseError
+		if errors.As(err, &parseErr) {
+			return app.NewCodeError(2, err)
+		}
+		if errors.Is(err, os.ErrNotExist) {
+			return app.NewCodeError(1, err)
+		}
+		return err
+	}
+	if entries, err = Select(entries, opts.Names); err != nil {
+		return app.NewCodeError(2, err)
+	}
+
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = e.Name
+	}
+	ports, err := app.GetPorts(opts.App, names, app.Metadata{})
+	if err != nil {
+		return err
+	}
+
+	out := newMux(opts.Output, append([]string{"system"}, names...), opts.Color)
+	system := out.writer("system")
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	exits := make(chan exit, len(entries))
+	var pids []int
+	var startErr error
+	for _, e := range entries {
+		w := out.writer(e.Name)
+		cmd := exec.Command("/bin/sh", "-c", e.Command)
+		cmd.Dir = filepath.Dir(path)
+		cmd.Env = append(os.Environ(), "PORT="+strconv.Itoa(ports[e.Name]))
+		cmd.Stdout, cmd.Stderr = w, w
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+		// Output copying stops this long after the process exits, in
+		// case something it started still holds the pipe.
+		cmd.WaitDelay = opts.Timeout
+		if startErr = cmd.Start(); startErr != nil {
+			startErr = fmt.Errorf("starting %s: %w", e.Name, startErr)
+			break
+		}
+		fmt.Fprintf(system, "%s started with pid %d on port %d\n", e.Name, cmd.Process.Pid, ports[e.Name])
+		pids = append(pids, cmd.Process.Pid)
+		go func(name string) {
+			err := cmd.Wait()
+			w.flush()
+			exits <- exit{name: name, err: err}
+		}(e.Name)
+	}
+
+	result, waiting := startErr, len(pids)
+	if startErr == nil {
+		select {
+		case sig := <-signals:
+			fmt.Fprintf(system, "received %s, stopping all processes\n", sig)
+		case first := <-exits:
+			waiting--
+			if result = exitError(first); result != nil {
+				fmt.Fprintf(system, "%v, stopping all processes\n", result)
+			} else {
+				fmt.Fprintf(system, "%s exited, stopping all processes\n", first.name)
+			}
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, pid := range pids {
+		wg.Add(1)
+		go func(pid int) {
+			defer wg.Done()
+			// The negative pid signals the whole process group, so
+			// whatever the shell started stops too.
+			_, _ = process.Terminate(-pid, opts.Timeout)
+		}(pid)
+	}
+	wg.Wait()
+	for ; waiting > 0; waiting-- {
+		<-exits
+	}
+	return result
+}
+
+// exitError describes how a process exited, or returns nil if it succeeded.
+func exitError(e exit) error {
+	var exitErr *exec.ExitError
+	if errors.As(e.err, &exitErr) {
+		if code := exitErr.ExitCode(); code > 0 {
+			return app.NewCodeError(code, fmt.Errorf("%s exited with code %d", e.name, code))
+		}
+		return app.NewCodeError(1, fmt.Errorf("%s was killed: %v", e.name, exitErr))
+	}
+	if e.err != nil {
+		return app.NewCodeError(1, fmt.Errorf("%s: %w", e.name, e.err))
+	}
+	return nil
+}
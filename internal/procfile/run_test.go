@@ -0,0 +1,102 @@
+package procfile
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bamorim/portpls/internal/app"
+)
+
+func setupRun(t *testing.T, procfile string) Options {
+	t.Helper()
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.json")
+	config := `{"port_start": 41000, "port_end": 41100, "freeze_period": "0", "allocation_ttl": "0"}`
+	if err := os.WriteFile(configPath, []byte(config), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "Procfile"), []byte(procfile), 0o644); err != nil {
+		t.Fatalf("write Procfile: %v", err)
+	}
+	return Options{
+		App: app.Options{
+			ConfigPath:      configPath,
+			AllocationsPath: filepath.Join(tmpDir, "allocations.json"),
+			Directory:       app.SpecificDirectory{Path: tmpDir},
+		},
+		Timeout: time.Second,
+		Output:  &bytes.Buffer{},
+	}
+}
+
+func TestRun(t *testing.T) {
+	t.Run("stops the others when one exits", func(t *testing.T) {
+		opts := setupRun(t, "web: echo port=$PORT\nworker: sleep 30\n")
+		start := time.Now()
+		if err := Run(opts); err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 10*time.Second {
+			t.Errorf("Run took %v, want the sleeping worker stopped", elapsed)
+		}
+		port, err := app.GetPort(opts.App, "web", app.Metadata{})
+		if err != nil {
+			t.Fatalf("GetPort: %v", err)
+		}
+		out := opts.Output.(*bytes.Buffer).String()
+		if !strings.Contains(out, "web    | port="+strconv.Itoa(port)) || !strings.Contains(out, "web exited, stopping all processes") {
+			t.Errorf("output =\n%s", out)
+		}
+	})
+
+	t.Run("returns the exit code of a failed process", func(t *testing.T) {
+		opts := setupRun(t, "web: sleep 30\nmigrate: exit 3\n")
+		err := Run(opts)
+		var codeErr app.CodeError
+		if !errors.As(err, &codeErr) || codeErr.Code != 3 {
+			t.Errorf("Run error = %v, want code 3", err)
+		}
+	})
+
+	t.Run("starts only the named processes", func(t *testing.T) {
+		opts := setupRun(t, "web: echo web\nworker: echo worker\n")
+		opts.Names = []string{"worker"}
+		if err := Run(opts); err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+		if out := opts.Output.(*bytes.Buffer).String(); strings.Contains(out, "web") {
+			t.Errorf("output =\n%s", out)
+		}
+	})
+
+	t.Run("allocates no ports unless all fit", func(t *testing.T) {
+		opts := setupRun(t, "web: true\napi: true\nworker: true\n")
+		config := `{"port_start": 41000, "port_end": 41001, "freeze_period": "0", "allocation_ttl": "0"}`
+		if err := os.WriteFile(opts.App.ConfigPath, []byte(config), 0o644); err != nil {
+			t.Fatalf("write config: %v", err)
+		}
+		var codeErr app.CodeError
+		if err := Run(opts); !errors.As(err, &codeErr) || codeErr.Code != 1 || !errors.Is(err, app.ErrNoFreePorts) {
+			t.Fatalf("Run error = %v, want code 1 ErrNoFreePorts", err)
+		}
+		names, err := app.AllocationNames(opts.App)
+		if err != nil || len(names) != 0 {
+			t.Errorf("allocations after failed Run = %v, %v; want none", names, err)
+		}
+	})
+
+	t.Run("missing Procfile", func(t *testing.T) {
+		opts := setupRun(t, "web: true\n")
+		opts.Procfile = filepath.Join(t.TempDir(), "Procfile")
+		var codeErr app.CodeError
+		if err := Run(opts); !errors.As(err, &codeErr) || codeErr.Code != 1 {
+			t.Errorf("Run error = %v, want code 1", err)
+		}
+	})
+}
@@ -0,0 +1,170 @@
+// Package proxy maps host names such as web.feature-x.localhost to
+// allocated ports and renders them as reverse proxy configuration.
+package proxy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Sources of project names.
+const (
+	ProjectFromDirectory = "directory" // the directory's base name
+	ProjectFromBranch    = "branch"    // the checked-out git branch, or the base name outside git
+)
+
+// ProjectSources lists the accepted project name sources.
+var ProjectSources = []string{ProjectFromDirectory, ProjectFromBranch}
+
+// DefaultDomain is the domain under which project hosts are created.
+// Browsers resolve *.localhost to the loopback address without DNS.
+const DefaultDomain = "localhost"
+
+// Target is an allocation to route to.
+type Target struct {
+	Directory string
+	Name      string
+	Port      int
+}
+
+// Route sends requests for any of Hosts to Port.
+type Route struct {
+	Hosts     []string
+	Port      int
+	Directory string
+	Name      string
+}
+
+// Routes returns a route per target, for the host <name>.<project>.<domain>.
+// main allocations are also reachable as <project>.<domain>. Hosts already
+// taken by a target in another directory, or that can't be made into a valid
+// host name, are skipped with a warning. Routes are ordered by host.
+func Routes(targets []Target, source, domain string) ([]Route, []string, error) {
+	if source != ProjectFromDirectory && source != ProjectFromBranch {
+		return nil, nil, fmt.Errorf("unknown project name source %q (want %s)", source, strings.Join(ProjectSources, " or "))
+	}
+	if domain == "" {
+		domain = DefaultDomain
+	}
+	sorted := append([]Target(nil), targets...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Directory != sorted[j].Directory {
+			return sorted[i].Directory < sorted[j].Directory
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+
+	var routes []Route
+	var warnings []string
+	owners := map[string]Target{}
+	projects := map[string]string{}
+	for _, t := range sorted {
+		project, ok := projects[t.Directory]
+		if !ok {
+			project = Label(Project(t.Directory, source))
+			projects[t.Directory] = project
+		}
+		name := Label(t.Name)
+		if project == "" || name == "" {
+			warnings = append(warnings, fmt.Sprintf("skipping %s in %s: no valid host name", t.Name, t.Directory))
+			continue
+		}
+		candidates := []string{name + "." + project + "." + domain}
+		if t.Name == "main" {
+			candidates = append(candidates, project+"."+domain)
+		}
+		route := Route{Port: t.Port, Directory: t.Directory, Name: t.Name}
+		for _, host := range candidates {
+			if owner, taken := owners[host]; taken {
+				warnings = append(warnings, fmt.Sprintf("skipping %s for %s in %s: already used by %s in %s", host, t.Name, t.Directory, owner.Name, owner.Directory))
+				continue
+			}
+			owners[host] = t
+			route.Hosts = append(route.Hosts, host)
+		}
+		if len(route.Hosts) > 0 {
+			routes = append(routes, route)
+		}
+	}
+	sort.Slice(routes, func(i, j int) bool { return routes[i].Hosts[0] < routes[j].Hosts[0] })
+	return routes, warnings, nil
+}
+
+// Project returns the project name for dir: its base name, or with
+// ProjectFromBranch the git branch checked out there if there is one.
+func Project(dir, source string) string {
+	if source == ProjectFromBranch {
+		if branch, ok := GitBranch(dir); ok {
+			return branch
+		}
+	}
+	return filepath.Base(dir)
+}
+
+// GitBranch returns the branch checked out in the git work tree containing
+// dir. It reads .git directly, so it also works in linked worktrees
+// without running git. It reports false outside git and for a detached HEAD.
+func GitBranch(dir string) (string, bool) {
+	for {
+		dotGit := filepath.Join(dir, ".git")
+		info, err := os.Stat(dotGit)
+		if err == nil {
+			gitDir := dotGit
+			if !info.IsDir() {
+				// A linked worktree or submodule: .git names the real directory.
+				data, err := os.ReadFile(dotGit)
+				if err != nil {
+					return "", false
+				}
+				link, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir:")
+				if !ok {
+					return "", false
+				}
+				gitDir = strings.TrimSpace(link)
+				if !filepath.IsAbs(gitDir) {
+					gitDir = filepath.Join(dir, gitDir)
+				}
+			}
+			head, err := os.ReadFile(filepath.Join(gitDir, "HEAD"))
+			if err != nil {
+				return "", false
+			}
+			branch, ok := strings.CutPrefix(strings.TrimSpace(string(head)), "ref: refs/heads/")
+			if !ok || branch == "" {
+				return "", false
+			}
+			return branch, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// Label turns s into a DNS label: lower case letters, digits and single
+// dashes, at most 63 characters. It returns "" if nothing is left.
+func Label(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(s) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	label := b.String()
+	if len(label) > 63 {
+		label = strings.TrimRight(label[:63], "-")
+	}
+	return label
+}
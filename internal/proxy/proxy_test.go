@@ -0,0 +1,159 @@
+package proxy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLabel(t *testing.T) {
+	tests := map[string]string{
+		"web":                   "web",
+		"Feature/New_Login!":    "feature-new-login",
+		"--a..b--":              "a-b",
+		"___":                   "",
+		strings.Repeat("a", 70): strings.Repeat("a", 63),
+	}
+	for input, want := range tests {
+		if got := Label(input); got != want {
+			t.Errorf("Label(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	targets := []Target{
+		{Directory: "/work/shop", Name: "main", Port: 20000},
+		{Directory: "/work/shop", Name: "api", Port: 20001},
+		{Directory: "/other/shop", Name: "api", Port: 20002},
+		{Directory: "/work/blog", Name: "__", Port: 20003},
+	}
+	routes, warnings, err := Routes(targets, ProjectFromDirectory, "")
+	if err != nil {
+		t.Fatalf("Routes: %v", err)
+	}
+	want := []Route{
+		{Hosts: []string{"api.shop.localhost"}, Port: 20002, Directory: "/other/shop", Name: "api"},
+		{Hosts: []string{"main.shop.localhost", "shop.localhost"}, Port: 20000, Directory: "/work/shop", Name: "main"},
+	}
+	if !reflect.DeepEqual(routes, want) {
+		t.Errorf("Routes = %+v, want %+v", routes, want)
+	}
+	if len(warnings) != 2 || !strings.Contains(warnings[0], "no valid host name") || !strings.Contains(warnings[1], "already used by api in /other/shop") {
+		t.Errorf("warnings = %q", warnings)
+	}
+
+	if _, _, err := Routes(targets, "hostname", ""); err == nil {
+		t.Error("expected error for unknown project name source")
+	}
+}
+
+func TestGitBranch(t *testing.T) {
+	root := t.TempDir()
+	write := func(path, content string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	repo := filepath.Join(root, "repo")
+	write(filepath.Join(repo, ".git", "HEAD"), "ref: refs/heads/feature/x\n")
+	write(filepath.Join(repo, ".git", "worktrees", "wt", "HEAD"), "ref: refs/heads/fix-y\n")
+	worktree := filepath.Join(root, "wt")
+	write(filepath.Join(worktree, ".git"), "gitdir: "+filepath.Join(repo, ".git", "worktrees", "wt")+"\n")
+	detached := filepath.Join(root, "detached")
+	write(filepath.Join(detached, ".git", "HEAD"), "0123456789abcdef\n")
+	sub := filepath.Join(repo, "services", "api")
+	if err := os.MkdirAll(sub, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+
+	tests := []struct {
+		dir    string
+		branch string
+		ok     bool
+	}{
+		{repo, "feature/x", true},
+		{sub, "feature/x", true},
+		{worktree, "fix-y", true},
+		{detached, "", false},
+	}
+	for _, tt := range tests {
+		branch, ok := GitBranch(tt.dir)
+		if branch != tt.branch || ok != tt.ok {
+			t.Errorf("GitBranch(%s) = %q, %v; want %q, %v", tt.dir, branch, ok, tt.branch, tt.ok)
+		}
+	}
+	if got := Project(repo, ProjectFromBranch); got != "feature/x" {
+		t.Errorf("Project(branch) = %q", got)
+	}
+	if got := Project(detached, ProjectFromBranch); got != "detached" {
+		t.Errorf("Project(detached) = %q, want the base name", got)
+	}
+}
+
+func TestRender(t *testing.T) {
+	routes := []Route{{Hosts: []string{"main.shop.localhost", "shop.localhost"}, Port: 20000, Directory: "/work/shop", Name: "main"}}
+	tests := []struct {
+		format string
+		opts   RenderOptions
+		want   []string
+	}{
+		{FormatCaddy, RenderOptions{}, []string{"http://main.shop.localhost, http://shop.localhost {\n\treverse_proxy 127.0.0.1:20000\n}"}},
+		{FormatCaddy, RenderOptions{Listen: 8080, Upstream: "::1"}, []string{"http://shop.localhost:8080 {", "reverse_proxy [::1]:20000"}},
+		{FormatNginx, RenderOptions{}, []string{"listen 80;", "server_name main.shop.localhost shop.localhost;", "proxy_pass http://127.0.0.1:20000;"}},
+		{FormatTraefik, RenderOptions{Upstream: "host.docker.internal"}, []string{
+			"    portpls-main-shop-localhost:\n      rule: \"Host(`main.shop.localhost`) || Host(`shop.localhost`)\"\n      service: portpls-main-shop-localhost\n",
+			"- url: \"http://host.docker.internal:20000\"",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			data, err := Render(tt.format, routes, tt.opts)
+			if err != nil {
+				t.Fatalf("Render: %v", err)
+			}
+			if !strings.HasPrefix(string(data), Header) {
+				t.Errorf("missing header:\n%s", data)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(string(data), want) {
+					t.Errorf("Render =\n%s\nwant it to contain %q", data, want)
+				}
+			}
+		})
+	}
+	if data, err := Render(FormatTraefik, nil, RenderOptions{}); err != nil || !strings.HasSuffix(string(data), "http: {}\n") {
+		t.Errorf("Render(traefik, no routes) = %q, %v", data, err)
+	}
+	if _, err := Render("apache", routes, RenderOptions{}); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("Render error = %v, want ErrUnknownFormat", err)
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "Caddyfile")
+	if err := os.WriteFile(path, []byte("old"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(path, []byte("new")); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "new" {
+		t.Errorf("content = %q, %v; want new", data, err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o644 {
+		t.Errorf("mode = %v, %v; want 0644", info.Mode().Perm(), err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("temporary files left behind: %v", entries)
+	}
+}
@@ -0,0 +1,154 @@
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Configuration formats.
+const (
+	FormatCaddy   = "caddy"
+	FormatNginx   = "nginx"
+	FormatTraefik = "traefik"
+)
+
+// Formats lists the formats Render supports.
+var Formats = []string{FormatCaddy, FormatNginx, FormatTraefik}
+
+// ErrUnknownFormat is returned for formats Render doesn't support.
+var ErrUnknownFormat = errors.New("unknown proxy config format")
+
+// Header starts every configuration file Render writes.
+const Header = "# Generated by portpls proxy-config. Do not edit; changes are overwritten."
+
+// DefaultUpstream is the host the proxy forwards to.
+const DefaultUpstream = "127.0.0.1"
+
+// RenderOptions configures Render.
+type RenderOptions struct {
+	Listen   int    // port the proxy listens on (caddy and nginx); 0 means 80
+	Upstream string // host the allocated ports are reached on; empty means DefaultUpstream
+}
+
+// Render returns the routes as configuration for the given proxy: a Caddyfile,
+// nginx server blocks to include in the http block, or a Traefik dynamic
+// configuration file for its file provider.
+func Render(format string, routes []Route, opts RenderOptions) ([]byte, error) {
+	if opts.Listen == 0 {
+		opts.Listen = 80
+	}
+	if opts.Upstream == "" {
+		opts.Upstream = DefaultUpstream
+	}
+	var b bytes.Buffer
+	b.WriteString(Header + "\n")
+	switch format {
+	case FormatCaddy:
+		renderCaddy(&b, routes, opts)
+	case FormatNginx:
+		renderNginx(&b, routes, opts)
+	case FormatTraefik:
+		renderTraefik(&b, routes, opts)
+	default:
+		return nil, fmt.Errorf("%w: %s (want %s)", ErrUnknownFormat, format, strings.Join(Formats, ", "))
+	}
+	return b.Bytes(), nil
+}
+
+func upstream(r Route, opts RenderOptions) string {
+	host := opts.Upstream
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	return host + ":" + strconv.Itoa(r.Port)
+}
+
+func renderCaddy(b *bytes.Buffer, routes []Route, opts RenderOptions) {
+	for _, r := range routes {
+		addresses := make([]string, len(r.Hosts))
+		for i, host := range r.Hosts {
+			// Plain HTTP, so browsers don't have to trust Caddy's local CA.
+			addresses[i] = "http://" + host
+			if opts.Listen != 80 {
+				addresses[i] += ":" + strconv.Itoa(opts.Listen)
+			}
+		}
+		fmt.Fprintf(b, "\n# %s in %s\n%s {\n\treverse_proxy %s\n}\n", r.Name, r.Directory, strings.Join(addresses, ", "), upstream(r, opts))
+	}
+}
+
+func renderNginx(b *bytes.Buffer, routes []Route, opts RenderOptions) {
+	for _, r := range routes {
+		fmt.Fprintf(b, "\n# %s in %s\nserver {\n", r.Name, r.Directory)
+		fmt.Fprintf(b, "    listen %d;\n", opts.Listen)
+		fmt.Fprintf(b, "    server_name %s;\n", strings.Join(r.Hosts, " "))
+		b.WriteString("    location / {\n")
+		fmt.Fprintf(b, "        proxy_pass http://%s;\n", upstream(r, opts))
+		b.WriteString("        proxy_http_version 1.1;\n")
+		b.WriteString("        proxy_set_header Host $host;\n")
+		b.WriteString("        proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;\n")
+		b.WriteString("        proxy_set_header X-Forwarded-Proto $scheme;\n")
+		b.WriteString("        proxy_set_header Upgrade $http_upgrade;\n")
+		b.WriteString("        proxy_set_header Connection $http_connection;\n")
+		b.WriteString("    }\n}\n")
+	}
+}
+
+func renderTraefik(b *bytes.Buffer, routes []Route, opts RenderOptions) {
+	if len(routes) == 0 {
+		b.WriteString("http: {}\n")
+		return
+	}
+	b.WriteString("http:\n  routers:\n")
+	for _, r := range routes {
+		rules := make([]string, len(r.Hosts))
+		for i, host := range r.Hosts {
+			rules[i] = "Host(`" + host + "`)"
+		}
+		name := routerName(r)
+		fmt.Fprintf(b, "    %s:\n", name)
+		fmt.Fprintf(b, "      rule: %q\n", strings.Join(rules, " || "))
+		fmt.Fprintf(b, "      service: %s\n", name)
+	}
+	b.WriteString("  services:\n")
+	for _, r := range routes {
+		fmt.Fprintf(b, "    %s:\n      loadBalancer:\n        servers:\n", routerName(r))
+		fmt.Fprintf(b, "          - url: \"http://%s\"\n", upstream(r, opts))
+	}
+}
+
+// routerName names a route's Traefik router and service after its first
+// host, which is unique.
+func routerName(r Route) string {
+	return "portpls-" + strings.ReplaceAll(r.Hosts[0], ".", "-")
+}
+
+// WriteFile replaces the file at path with data through a temporary file and
+// a rename, so a proxy reloading at the same time never reads half a config.
+func WriteFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	// Proxies often run as another user.
+	if err := tmp.Chmod(0o644); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,187 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+type routeKey struct{}
+
+// Server is a reverse proxy that sends each request to the route matching
+// its Host header, and serves an index of the routes for other hosts.
+type Server struct {
+	upstream string
+
+	mu     sync.RWMutex
+	routes []Route
+	hosts  map[string]Route
+
+	http1 *httputil.ReverseProxy
+	http2 *httputil.ReverseProxy
+}
+
+// NewServer returns a Server without routes that reaches the allocated
+// ports on upstream, or DefaultUpstream if it is empty.
+func NewServer(upstream string) *Server {
+	if upstream == "" {
+		upstream = DefaultUpstream
+	}
+	s := &Server{upstream: upstream, hosts: map[string]Route{}}
+	s.http1 = &httputil.ReverseProxy{Rewrite: s.rewrite, ErrorHandler: s.proxyError}
+	s.http2 = &httputil.ReverseProxy{
+		Rewrite:      s.rewrite,
+		ErrorHandler: s.proxyError,
+		Transport: &http2.Transport{
+			// Cleartext HTTP/2 to the upstream, for gRPC.
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, addr)
+			},
+		},
+	}
+	return s
+}
+
+// SetRoutes replaces the routes. Requests already being proxied finish on
+// the route they started with.
+func (s *Server) SetRoutes(routes []Route) {
+	hosts := map[string]Route{}
+	for _, r := range routes {
+		for _, host := range r.Hosts {
+			hosts[host] = r
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.routes, s.hosts = routes, hosts
+}
+
+// Routes returns the current routes.
+func (s *Server) Routes() []Route {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.routes
+}
+
+// Handler returns s as a handler that also accepts HTTP/2 without TLS
+// (h2c), next to HTTP/1.1.
+func (s *Server) Handler() http.Handler {
+	return h2c.NewHandler(s, &http2.Server{})
+}
+
+// ServeHTTP proxies r to the route for its host. Websocket upgrades are
+// passed through. HTTP/2 gRPC requests are forwarded over cleartext HTTP/2,
+// everything else over HTTP/1.1 since that is what dev servers speak.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	host := RequestHost(r.Host)
+	s.mu.RLock()
+	route, ok := s.hosts[host]
+	s.mu.RUnlock()
+	if !ok {
+		s.index(w, r, host)
+		return
+	}
+	r = r.WithContext(context.WithValue(r.Context(), routeKey{}, route))
+	if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		s.http2.ServeHTTP(w, r)
+		return
+	}
+	s.http1.ServeHTTP(w, r)
+}
+
+// RequestHost returns the host name of a Host header, without the port,
+// in lower case and without a trailing dot.
+func RequestHost(hostport string) string {
+	host := hostport
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// rewrite points the outgoing request at the route's port. The Host header
+// is kept, so apps see the name they were reached by.
+func (s *Server) rewrite(pr *httputil.ProxyRequest) {
+	route := pr.In.Context().Value(routeKey{}).(Route)
+	pr.SetURL(&url.URL{Scheme: "http", Host: net.JoinHostPort(s.upstream, strconv.Itoa(route.Port))})
+	pr.Out.Host = pr.In.Host
+	pr.SetXForwarded()
+}
+
+func (s *Server) proxyError(w http.ResponseWriter, r *http.Request, err error) {
+	route := r.Context().Value(routeKey{}).(Route)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusBadGateway)
+	fmt.Fprintf(w, "portpls proxy: %s is allocated port %d (%s in %s), but the request failed:\n%v\n\nIs the server running?\n",
+		RequestHost(r.Host), route.Port, route.Name, route.Directory, err)
+}
+
+type indexRow struct {
+	URL       string
+	Host      string
+	Port      int
+	Name      string
+	Directory string
+}
+
+// index lists the routes, linking to them on the port the request came in
+// on. It answers with 404 so scripts don't mistake it for the app.
+func (s *Server) index(w http.ResponseWriter, r *http.Request, host string) {
+	port := ""
+	if _, p, err := net.SplitHostPort(r.Host); err == nil && p != "80" {
+		port = ":" + p
+	}
+	var rows []indexRow
+	for _, route := range s.Routes() {
+		for _, h := range route.Hosts {
+			rows = append(rows, indexRow{URL: "http://" + h + port + "/", Host: h, Port: route.Port, Name: route.Name, Directory: route.Directory})
+		}
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusNotFound)
+	_ = indexTemplate.Execute(w, struct {
+		Host string
+		Rows []indexRow
+	}{host, rows})
+}
+
+var indexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>portpls proxy</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 2rem; color: #222; }
+table { border-collapse: collapse; }
+th, td { text-align: left; padding: 0.3rem 1rem 0.3rem 0; }
+th { border-bottom: 1px solid #ccc; }
+code { background: #f3f3f3; padding: 0.1rem 0.3rem; }
+</style>
+</head>
+<body>
+<h1>portpls proxy</h1>
+{{if .Host}}<p>No allocation matches <code>{{.Host}}</code>.</p>{{end}}
+{{if .Rows}}
+<table>
+<tr><th>Host</th><th>Port</th><th>Name</th><th>Directory</th></tr>
+{{range .Rows}}<tr><td><a href="{{.URL}}">{{.Host}}</a></td><td>{{.Port}}</td><td>{{.Name}}</td><td>{{.Directory}}</td></tr>
+{{end}}</table>
+{{else}}
+<p>There are no allocations yet. Run <code>portpls get --name web</code> in a project to add one.</p>
+{{end}}
+</body>
+</html>
+`))
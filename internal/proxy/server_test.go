@@ -0,0 +1,137 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/http2"
+)
+
+// backendPort starts an HTTP server on the loopback address and returns its
+// port.
+func backendPort(t *testing.T, handler http.Handler) int {
+	t.Helper()
+	backend := httptest.NewServer(handler)
+	t.Cleanup(backend.Close)
+	_, port, _ := net.SplitHostPort(backend.Listener.Addr().String())
+	n, _ := strconv.Atoi(port)
+	return n
+}
+
+func newTestProxy(t *testing.T, routes []Route) *httptest.Server {
+	t.Helper()
+	server := NewServer("")
+	server.SetRoutes(routes)
+	front := httptest.NewServer(server.Handler())
+	t.Cleanup(front.Close)
+	return front
+}
+
+func get(t *testing.T, front *httptest.Server, host string) (int, string) {
+	t.Helper()
+	req, _ := http.NewRequest("GET", front.URL+"/path?q=1", nil)
+	req.Host = host
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func TestServerRoutesByHost(t *testing.T) {
+	port := backendPort(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s %s %s", r.Host, r.URL, r.Header.Get("X-Forwarded-Host"))
+	}))
+	front := newTestProxy(t, []Route{
+		{Hosts: []string{"web.shop.localhost"}, Port: port, Directory: "/work/shop", Name: "web"},
+		{Hosts: []string{"api.shop.localhost"}, Port: 1, Directory: "/work/shop", Name: "api"},
+	})
+
+	status, body := get(t, front, "Web.Shop.localhost.:8080")
+	if status != http.StatusOK || body != "Web.Shop.localhost.:8080 /path?q=1 Web.Shop.localhost.:8080" {
+		t.Errorf("routed request = %d %q", status, body)
+	}
+
+	status, body = get(t, front, "other.localhost:8080")
+	if status != http.StatusNotFound || !strings.Contains(body, "No allocation matches <code>other.localhost</code>") ||
+		!strings.Contains(body, `<a href="http://web.shop.localhost:8080/">web.shop.localhost</a>`) {
+		t.Errorf("index = %d\n%s", status, body)
+	}
+
+	status, body = get(t, front, "api.shop.localhost")
+	if status != http.StatusBadGateway || !strings.Contains(body, "allocated port 1 (api in /work/shop)") {
+		t.Errorf("unreachable upstream = %d %q", status, body)
+	}
+}
+
+func TestServerWebsocket(t *testing.T) {
+	port := backendPort(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "websocket" {
+			http.Error(w, "want upgrade", http.StatusBadRequest)
+			return
+		}
+		conn, buf, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+		buf.Flush()
+		line, _ := buf.ReadString('\n')
+		buf.WriteString("echo " + line)
+		buf.Flush()
+	}))
+	front := newTestProxy(t, []Route{{Hosts: []string{"ws.app.localhost"}, Port: port}})
+
+	conn, err := net.Dial("tcp", front.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	fmt.Fprint(conn, "GET /socket HTTP/1.1\r\nHost: ws.app.localhost\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil || resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("upgrade response = %v, %v", resp, err)
+	}
+	fmt.Fprint(conn, "hello\n")
+	if line, _ := reader.ReadString('\n'); line != "echo hello\n" {
+		t.Errorf("after upgrade got %q", line)
+	}
+}
+
+func TestServerH2C(t *testing.T) {
+	port := backendPort(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	}))
+	front := newTestProxy(t, []Route{{Hosts: []string{"web.app.localhost"}, Port: port}})
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}}
+	req, _ := http.NewRequest("GET", front.URL, nil)
+	req.Host = "web.app.localhost"
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("h2c GET: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.ProtoMajor != 2 || string(body) != "ok" {
+		t.Errorf("h2c response = %s %q", resp.Proto, body)
+	}
+}
@@ -0,0 +1,90 @@
+package tui
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os/exec"
+	"time"
+
+	"github.com/bamorim/portpls/internal/app"
+)
+
+// AppBackend runs the UI actions with the app package, acting on each
+// allocation in its own directory.
+type AppBackend struct {
+	Options     app.Options
+	KillTimeout time.Duration
+	// Terminal receives the OSC 52 sequence when no clipboard command is
+	// available.
+	Terminal io.Writer
+
+	loaded bool
+}
+
+// List returns every allocation. The first call expires allocations like
+// list does; later ones only read, so refreshing never writes to the store.
+func (b *AppBackend) List() ([]app.AllocationEntry, error) {
+	if !b.loaded {
+		b.loaded = true
+		return app.ListAllocations(b.Options, nil)
+	}
+	return app.ViewAllocations(b.Options, nil)
+}
+
+func (b *AppBackend) Whois(port int) (app.WhoisResult, error) {
+	return app.Whois(b.Options, port)
+}
+
+func (b *AppBackend) SetLocked(entry app.AllocationEntry, locked bool) error {
+	var err error
+	if locked {
+		_, err = app.LockPort(b.in(entry), entry.Name, app.Metadata{})
+	} else {
+		_, err = app.UnlockPort(b.in(entry), entry.Name)
+	}
+	return err
+}
+
+func (b *AppBackend) Forget(entry app.AllocationEntry) error {
+	filter, err := app.FilterByDirectory(entry.Directory)
+	if err != nil {
+		return err
+	}
+	_, err = app.Forget(b.in(entry), filter, nil, entry.Name, true, false, nil)
+	return err
+}
+
+func (b *AppBackend) Kill(entry app.AllocationEntry) (string, error) {
+	result, err := app.Kill(b.in(entry), entry.Name, b.KillTimeout, false, nil)
+	return result.Message, err
+}
+
+// Copy puts text on the clipboard with the first available clipboard
+// command, falling back to the OSC 52 escape sequence that many terminals
+// support.
+func (b *AppBackend) Copy(text string) error {
+	for _, cmd := range [][]string{{"pbcopy"}, {"wl-copy"}, {"xclip", "-selection", "clipboard"}, {"xsel", "--clipboard", "--input"}} {
+		if _, err := exec.LookPath(cmd[0]); err != nil {
+			continue
+		}
+		c := exec.Command(cmd[0], cmd[1:]...)
+		c.Stdin = bytes.NewBufferString(text)
+		if err := c.Run(); err == nil {
+			return nil
+		}
+	}
+	if b.Terminal == nil {
+		return fmt.Errorf("no clipboard available")
+	}
+	_, err := fmt.Fprintf(b.Terminal, "\033]52;c;%s\a", base64.StdEncoding.EncodeToString([]byte(text)))
+	return err
+}
+
+// in returns the options for acting on entry in its own directory.
+func (b *AppBackend) in(entry app.AllocationEntry) app.Options {
+	opts := b.Options
+	opts.Directory = app.SpecificDirectory{Path: entry.Directory}
+	return opts
+}
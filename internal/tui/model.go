@@ -0,0 +1,423 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bamorim/portpls/internal/app"
+	"github.com/bamorim/portpls/internal/labels"
+	"github.com/bamorim/portpls/internal/output"
+)
+
+// Backend performs the actions the UI offers. AppBackend implements it
+// with the app package.
+type Backend interface {
+	List() ([]app.AllocationEntry, error)
+	Whois(port int) (app.WhoisResult, error)
+	SetLocked(entry app.AllocationEntry, locked bool) error
+	Forget(entry app.AllocationEntry) error
+	Kill(entry app.AllocationEntry) (string, error)
+	Copy(text string) error
+}
+
+type mode int
+
+const (
+	modeNormal mode = iota
+	modeFilter
+	modeConfirm
+)
+
+var sortKeys = []string{app.SortByPort, app.SortByDir, app.SortByLastUsed}
+
+// panelWidth is the width of the whois side panel; it is hidden on
+// terminals narrower than minPanelScreen.
+const (
+	panelWidth     = 40
+	minPanelScreen = 100
+)
+
+// Model is the state of the UI: the allocations, the selection, the sort
+// and filter, and any pending confirmation.
+type Model struct {
+	backend Backend
+	width   int
+	height  int
+
+	entries []app.AllocationEntry // all allocations, sorted
+	visible []app.AllocationEntry // entries matching filter
+	sortKey int                   // index into sortKeys
+	filter  string
+	cursor  int
+	offset  int // first visible row
+
+	mode    mode
+	prompt  string
+	confirm func() (string, error)
+	status  string
+
+	whois map[int]app.WhoisResult
+}
+
+func NewModel(backend Backend) *Model {
+	return &Model{backend: backend, width: 80, height: 24, whois: map[int]app.WhoisResult{}}
+}
+
+// Resize sets the screen size.
+func (m *Model) Resize(width, height int) {
+	m.width, m.height = width, height
+	m.clamp()
+}
+
+// Refresh reloads the allocations, keeping the selected port selected.
+// Cached whois details are dropped so the selection is looked up again.
+func (m *Model) Refresh() {
+	entries, err := m.backend.List()
+	if err != nil {
+		m.status = "Error: " + err.Error()
+		return
+	}
+	m.entries = entries
+	m.whois = map[int]app.WhoisResult{}
+	m.apply()
+}
+
+// apply sorts entries and recomputes the visible rows.
+func (m *Model) apply() {
+	selected, hadSelection := m.Selected()
+	_ = app.SortEntries(m.entries, sortKeys[m.sortKey])
+	m.visible = m.visible[:0]
+	needle := strings.ToLower(m.filter)
+	for _, e := range m.entries {
+		if needle == "" || strings.Contains(strings.ToLower(searchText(e)), needle) {
+			m.visible = append(m.visible, e)
+		}
+	}
+	if hadSelection {
+		for i, e := range m.visible {
+			if e.Port == selected.Port {
+				m.cursor = i
+			}
+		}
+	}
+	m.clamp()
+}
+
+func searchText(e app.AllocationEntry) string {
+	return strings.Join([]string{fmt.Sprint(e.Port), e.Directory, e.Name, e.Status, labels.Format(e.Labels), e.Note}, " ")
+}
+
+// Selected returns the allocation under the cursor.
+func (m *Model) Selected() (app.AllocationEntry, bool) {
+	if m.cursor < 0 || m.cursor >= len(m.visible) {
+		return app.AllocationEntry{}, false
+	}
+	return m.visible[m.cursor], true
+}
+
+// PendingWhois returns the selected port if its whois details are not known.
+func (m *Model) PendingWhois() (int, bool) {
+	e, ok := m.Selected()
+	if !ok {
+		return 0, false
+	}
+	_, known := m.whois[e.Port]
+	return e.Port, !known
+}
+
+// SetWhois stores the whois details for port.
+func (m *Model) SetWhois(port int, result app.WhoisResult) {
+	m.whois[port] = result
+}
+
+func (m *Model) tableHeight() int {
+	// Title, blank line and header above the rows; status and help below.
+	return max(m.height-5, 1)
+}
+
+func (m *Model) clamp() {
+	m.cursor = min(m.cursor, len(m.visible)-1)
+	m.cursor = max(m.cursor, 0)
+	rows := m.tableHeight()
+	if m.cursor < m.offset {
+		m.offset = m.cursor
+	}
+	if m.cursor >= m.offset+rows {
+		m.offset = m.cursor - rows + 1
+	}
+	m.offset = max(min(m.offset, len(m.visible)-rows), 0)
+}
+
+// HandleKey updates the model for a key press and reports whether the UI
+// should quit.
+func (m *Model) HandleKey(key string) bool {
+	if key == KeyCtrlC {
+		return true
+	}
+	switch m.mode {
+	case modeFilter:
+		m.handleFilterKey(key)
+		return false
+	case modeConfirm:
+		m.mode = modeNormal
+		if key == "y" || key == "Y" {
+			message, err := m.confirm()
+			m.report(message, err)
+			m.Refresh()
+		} else {
+			m.status = "Cancelled"
+		}
+		m.confirm = nil
+		return false
+	}
+
+	m.status = ""
+	switch key {
+	case "q":
+		return true
+	case KeyUp, "k":
+		m.cursor--
+	case KeyDown, "j":
+		m.cursor++
+	case KeyPageUp:
+		m.cursor -= m.tableHeight()
+	case KeyPageDown:
+		m.cursor += m.tableHeight()
+	case KeyHome, "g":
+		m.cursor = 0
+	case KeyEnd, "G":
+		m.cursor = len(m.visible) - 1
+	case "s":
+		m.sortKey = (m.sortKey + 1) % len(sortKeys)
+		m.apply()
+		m.status = "Sorted by " + sortKeys[m.sortKey]
+	case "/":
+		m.mode = modeFilter
+	case KeyEscape:
+		m.filter = ""
+		m.apply()
+	case "r":
+		m.Refresh()
+	default:
+		m.handleAction(key)
+	}
+	m.clamp()
+	return false
+}
+
+func (m *Model) handleFilterKey(key string) {
+	switch key {
+	case KeyEnter:
+		m.mode = modeNormal
+	case KeyEscape:
+		m.mode = modeNormal
+		m.filter = ""
+	case KeyBackspace:
+		if m.filter != "" {
+			_, size := utf8.DecodeLastRuneInString(m.filter)
+			m.filter = m.filter[:len(m.filter)-size]
+		}
+	default:
+		if len(key) == 1 {
+			m.filter += key
+		}
+	}
+	m.apply()
+}
+
+// handleAction runs the actions on the selected allocation.
+func (m *Model) handleAction(key string) {
+	e, ok := m.Selected()
+	if !ok {
+		return
+	}
+	switch key {
+	case "l":
+		err := m.backend.SetLocked(e, !e.Locked)
+		verb := "Locked"
+		if e.Locked {
+			verb = "Unlocked"
+		}
+		m.report(fmt.Sprintf("%s port %d", verb, e.Port), err)
+		m.Refresh()
+	case "c":
+		url := fmt.Sprintf("http://localhost:%d", e.Port)
+		m.report("Copied "+url, m.backend.Copy(url))
+	case "d":
+		m.ask(fmt.Sprintf("Forget port %d (%s in %s)?", e.Port, e.Name, output.ShortenHome(e.Directory)), func() (string, error) {
+			return fmt.Sprintf("Forgot port %d", e.Port), m.backend.Forget(e)
+		})
+	case "x":
+		if e.Status != app.StatusBusy {
+			m.status = fmt.Sprintf("Port %d is not in use", e.Port)
+			return
+		}
+		holder := "the process"
+		if w, ok := m.whois[e.Port]; ok && w.Container != nil {
+			holder = "container " + w.Container.Name
+		} else if ok && w.Process != nil {
+			holder = fmt.Sprintf("%s (pid %d)", w.Process.Command, w.Process.PID)
+		}
+		m.ask(fmt.Sprintf("Stop %s holding port %d?", holder, e.Port), func() (string, error) {
+			return m.backend.Kill(e)
+		})
+	}
+}
+
+func (m *Model) ask(prompt string, action func() (string, error)) {
+	m.mode = modeConfirm
+	m.prompt = prompt
+	m.confirm = action
+}
+
+func (m *Model) report(message string, err error) {
+	if err != nil {
+		m.status = "Error: " + err.Error()
+		return
+	}
+	m.status = message
+}
+
+// View renders the whole screen.
+func (m *Model) View() string {
+	var left []string
+	title := fmt.Sprintf("%sportpls%s  %d allocation(s)  sort: %s", bold, reset, len(m.entries), sortKeys[m.sortKey])
+	if m.filter != "" || m.mode == modeFilter {
+		title += fmt.Sprintf("  filter: %s", m.filter)
+		if m.mode == modeFilter {
+			title += "_"
+		}
+	}
+
+	tableWidth := m.width
+	showPanel := m.width >= minPanelScreen
+	if showPanel {
+		tableWidth = m.width - panelWidth - 1
+	}
+	left = append(left, "", fmt.Sprintf("%s%s%s", bold, fit(m.row("PORT", "DIRECTORY", "NAME", "STATUS", "LOCK", "LAST USED", tableWidth), tableWidth), reset))
+	rows := m.tableHeight()
+	for i := m.offset; i < len(m.visible) && i < m.offset+rows; i++ {
+		e := m.visible[i]
+		lock := ""
+		if e.Locked {
+			lock = "yes"
+		}
+		line := fit(m.row(fmt.Sprint(e.Port), output.ShortenHome(e.Directory), e.Name, e.Status, lock, output.FormatTimestamp(e.LastUsedAt), tableWidth), tableWidth)
+		if i == m.cursor {
+			line = reverse + line + reset
+		}
+		left = append(left, line)
+	}
+	if len(m.visible) == 0 {
+		left = append(left, faint+fit("No allocations", tableWidth)+reset)
+	}
+
+	var right []string
+	if showPanel {
+		right = append([]string{"", ""}, m.panel()...)
+	}
+
+	var b strings.Builder
+	b.WriteString(home)
+	b.WriteString(title + clearLine + "\r\n")
+	for i := 0; i < m.height-3; i++ {
+		line := ""
+		if i < len(left) {
+			line = left[i]
+		}
+		line = fit(line, tableWidth)
+		if showPanel {
+			panel := ""
+			if i < len(right) {
+				panel = right[i]
+			}
+			line += " " + faint + "│" + reset + " " + fit(panel, panelWidth-2)
+		}
+		b.WriteString(line + clearLine + "\r\n")
+	}
+	b.WriteString(m.statusLine() + clearLine + "\r\n")
+	b.WriteString(faint + fit("↑/↓ move  / filter  s sort  l lock  d forget  x kill  c copy URL  r refresh  q quit", m.width) + reset + clearLine)
+	return b.String()
+}
+
+func (m *Model) statusLine() string {
+	switch m.mode {
+	case modeConfirm:
+		return bold + fit(m.prompt+" [y/N]", m.width) + reset
+	case modeFilter:
+		return fit("Type to filter, Enter to keep, Esc to clear", m.width)
+	}
+	return fit(m.status, m.width)
+}
+
+// row lays out table columns, giving the directory whatever space is left.
+func (m *Model) row(port, dir, name, status, lock, lastUsed string, width int) string {
+	fixed := 7 + 1 + 16 + 7 + 5 + 16
+	dirWidth := max(width-fixed, 10)
+	return fmt.Sprintf("%-7s%s %-16s%-7s%-5s%-16s", port, fit(dir, dirWidth-1), fit(name, 15), status, lock, lastUsed)
+}
+
+// panel renders the whois details for the selected port.
+func (m *Model) panel() []string {
+	e, ok := m.Selected()
+	if !ok {
+		return nil
+	}
+	lines := []string{bold + fmt.Sprintf("Port %d", e.Port) + reset, ""}
+	lines = append(lines,
+		"Directory: "+output.ShortenHome(e.Directory),
+		"Name:      "+e.Name,
+		"Assigned:  "+output.FormatTimestamp(e.AssignedAt),
+	)
+	if len(e.Labels) > 0 {
+		lines = append(lines, "Labels:    "+labels.Format(e.Labels))
+	}
+	if e.Note != "" {
+		lines = append(lines, "Note:      "+e.Note)
+	}
+	w, known := m.whois[e.Port]
+	switch {
+	case !known:
+		lines = append(lines, "", faint+"Looking up holder..."+reset)
+	case w.Container != nil:
+		lines = append(lines, "", bold+"Container"+reset,
+			"Name:      "+w.Container.Name,
+			"Image:     "+w.Container.Image)
+		if w.Container.ComposeProject != "" {
+			lines = append(lines, "Compose:   "+w.Container.ComposeProject+"/"+w.Container.ComposeService)
+		}
+	case w.Process != nil:
+		lines = append(lines, "", bold+"Process"+reset,
+			fmt.Sprintf("PID:       %d", w.Process.PID),
+			"Command:   "+w.Process.Command,
+			"User:      "+w.Process.User)
+		if w.Process.Cwd != "" {
+			lines = append(lines, "Cwd:       "+output.ShortenHome(w.Process.Cwd))
+		}
+	case w.State == "":
+		lines = append(lines, "", "Could not look up the holder")
+	case w.State == app.WhoisAllocatedBusy:
+		lines = append(lines, "", "In use by an unknown process")
+	default:
+		lines = append(lines, "", "Not in use")
+	}
+	return lines
+}
+
+// fit pads or truncates s to exactly width runes. Strings containing ANSI
+// sequences are returned unchanged.
+func fit(s string, width int) string {
+	if strings.Contains(s, "\033") || width <= 0 {
+		return s
+	}
+	n := utf8.RuneCountInString(s)
+	if n > width {
+		runes := []rune(s)
+		if width == 1 {
+			return string(runes[:1])
+		}
+		return string(runes[:width-1]) + "…"
+	}
+	return s + strings.Repeat(" ", width-n)
+}
@@ -0,0 +1,223 @@
+package tui
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bamorim/portpls/internal/app"
+)
+
+type fakeBackend struct {
+	entries []app.AllocationEntry
+	calls   []string
+	copied  string
+	err     error
+}
+
+func (f *fakeBackend) List() ([]app.AllocationEntry, error) {
+	return append([]app.AllocationEntry(nil), f.entries...), nil
+}
+
+func (f *fakeBackend) Whois(port int) (app.WhoisResult, error) {
+	return app.WhoisResult{Port: port}, nil
+}
+
+func (f *fakeBackend) SetLocked(e app.AllocationEntry, locked bool) error {
+	f.calls = append(f.calls, "lock "+e.Name)
+	for i := range f.entries {
+		if f.entries[i].Port == e.Port {
+			f.entries[i].Locked = locked
+		}
+	}
+	return f.err
+}
+
+func (f *fakeBackend) Forget(e app.AllocationEntry) error {
+	f.calls = append(f.calls, "forget "+e.Name)
+	return f.err
+}
+
+func (f *fakeBackend) Kill(e app.AllocationEntry) (string, error) {
+	f.calls = append(f.calls, "kill "+e.Name)
+	return "Stopped", f.err
+}
+
+func (f *fakeBackend) Copy(text string) error {
+	f.copied = text
+	return f.err
+}
+
+func newTestModel() (*Model, *fakeBackend) {
+	now := time.Now()
+	backend := &fakeBackend{entries: []app.AllocationEntry{
+		{Port: 20002, Directory: "/work/b", Name: "web", Status: app.StatusBusy, LastUsedAt: now},
+		{Port: 20000, Directory: "/work/c", Name: "main", Status: app.StatusFree, LastUsedAt: now.Add(-time.Hour)},
+		{Port: 20001, Directory: "/work/a", Name: "api", Status: app.StatusFree, LastUsedAt: now.Add(-2 * time.Hour), Labels: map[string]string{"env": "e2e"}},
+	}}
+	m := NewModel(backend)
+	m.Resize(120, 20)
+	m.Refresh()
+	return m, backend
+}
+
+func visiblePorts(m *Model) []int {
+	var ports []int
+	for _, e := range m.visible {
+		ports = append(ports, e.Port)
+	}
+	return ports
+}
+
+func press(m *Model, keys ...string) {
+	for _, k := range keys {
+		m.HandleKey(k)
+	}
+}
+
+func TestModelNavigation(t *testing.T) {
+	m, _ := newTestModel()
+	if got := visiblePorts(m); !reflect.DeepEqual(got, []int{20000, 20001, 20002}) {
+		t.Fatalf("ports = %v", got)
+	}
+	press(m, "j", KeyDown, KeyDown)
+	if e, _ := m.Selected(); e.Port != 20002 {
+		t.Errorf("selected %d, want 20002 (cursor stops at the end)", e.Port)
+	}
+	press(m, "g")
+	if e, _ := m.Selected(); e.Port != 20000 {
+		t.Errorf("selected %d after g, want 20000", e.Port)
+	}
+
+	t.Run("sort keeps the selection", func(t *testing.T) {
+		press(m, "s")
+		if got := visiblePorts(m); !reflect.DeepEqual(got, []int{20001, 20002, 20000}) {
+			t.Errorf("ports by dir = %v", got)
+		}
+		if e, _ := m.Selected(); e.Port != 20000 {
+			t.Errorf("selected %d, want 20000", e.Port)
+		}
+		press(m, "s")
+		if got := visiblePorts(m); !reflect.DeepEqual(got, []int{20001, 20000, 20002}) {
+			t.Errorf("ports by last used = %v", got)
+		}
+		press(m, "s")
+	})
+
+	t.Run("filter", func(t *testing.T) {
+		press(m, "/", "e", "2", "e", KeyEnter)
+		if got := visiblePorts(m); !reflect.DeepEqual(got, []int{20001}) {
+			t.Errorf("filtered ports = %v", got)
+		}
+		press(m, "/", KeyBackspace, KeyBackspace, KeyBackspace, "w", "e", "b", KeyEnter)
+		if got := visiblePorts(m); !reflect.DeepEqual(got, []int{20002}) {
+			t.Errorf("filtered ports = %v", got)
+		}
+		press(m, KeyEscape)
+		if len(m.visible) != 3 {
+			t.Errorf("Esc should clear the filter, got %v", visiblePorts(m))
+		}
+	})
+
+	if !m.HandleKey("q") || !m.HandleKey(KeyCtrlC) {
+		t.Error("q and Ctrl-C should quit")
+	}
+}
+
+func TestModelActions(t *testing.T) {
+	t.Run("lock toggles", func(t *testing.T) {
+		m, backend := newTestModel()
+		press(m, "l")
+		if e, _ := m.Selected(); !e.Locked || !reflect.DeepEqual(backend.calls, []string{"lock main"}) {
+			t.Errorf("selected %+v, calls %v", e, backend.calls)
+		}
+	})
+
+	t.Run("forget asks first", func(t *testing.T) {
+		m, backend := newTestModel()
+		press(m, "d", "n")
+		if len(backend.calls) != 0 || m.status != "Cancelled" {
+			t.Errorf("calls %v, status %q", backend.calls, m.status)
+		}
+		press(m, "d", "y")
+		if !reflect.DeepEqual(backend.calls, []string{"forget main"}) {
+			t.Errorf("calls = %v", backend.calls)
+		}
+	})
+
+	t.Run("kill only busy ports", func(t *testing.T) {
+		m, backend := newTestModel()
+		press(m, "x")
+		if m.mode != modeNormal || len(backend.calls) != 0 {
+			t.Errorf("kill on a free port should not ask, mode %v", m.mode)
+		}
+		press(m, "G", "x", "y")
+		if !reflect.DeepEqual(backend.calls, []string{"kill web"}) || m.status != "Stopped" {
+			t.Errorf("calls %v, status %q", backend.calls, m.status)
+		}
+	})
+
+	t.Run("copy URL", func(t *testing.T) {
+		m, backend := newTestModel()
+		press(m, "c")
+		if backend.copied != "http://localhost:20000" {
+			t.Errorf("copied %q", backend.copied)
+		}
+	})
+
+	t.Run("errors are shown", func(t *testing.T) {
+		m, backend := newTestModel()
+		backend.err = errors.New("boom")
+		press(m, "l")
+		if m.status != "Error: boom" {
+			t.Errorf("status = %q", m.status)
+		}
+	})
+}
+
+func TestModelView(t *testing.T) {
+	m, _ := newTestModel()
+	if port, ok := m.PendingWhois(); !ok || port != 20000 {
+		t.Fatalf("PendingWhois = %d, %v", port, ok)
+	}
+	m.SetWhois(20000, app.WhoisResult{Port: 20000, State: app.WhoisAllocatedFree})
+	if _, ok := m.PendingWhois(); ok {
+		t.Error("whois still pending after SetWhois")
+	}
+	view := m.View()
+	for _, want := range []string{"3 allocation(s)", reverse + "20000  /work/c", "Port 20000", "Not in use", "q quit"} {
+		if !strings.Contains(view, want) {
+			t.Errorf("view is missing %q", want)
+		}
+	}
+	if lines := strings.Count(view, "\r\n") + 1; lines != 20 {
+		t.Errorf("view has %d lines, want 20", lines)
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	got := parseKeys([]byte("j\x1b[A\x1b[B\x1b[6~\r\x7f\x03q\x1b"))
+	want := []string{"j", KeyUp, KeyDown, KeyPageDown, KeyEnter, KeyBackspace, KeyCtrlC, "q", KeyEscape}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseKeys = %q, want %q", got, want)
+	}
+}
+
+func TestFit(t *testing.T) {
+	tests := []struct {
+		in    string
+		width int
+		want  string
+	}{
+		{"abc", 5, "abc  "},
+		{"abcdef", 4, "abc…"},
+		{"~/código", 8, "~/código"},
+	}
+	for _, tt := range tests {
+		if got := fit(tt.in, tt.width); got != tt.want {
+			t.Errorf("fit(%q, %d) = %q, want %q", tt.in, tt.width, got, tt.want)
+		}
+	}
+}
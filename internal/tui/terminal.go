@@ -0,0 +1,139 @@
+package tui
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// Keys reported by parseKeys besides single printable characters.
+const (
+	KeyUp        = "up"
+	KeyDown      = "down"
+	KeyPageUp    = "pgup"
+	KeyPageDown  = "pgdown"
+	KeyHome      = "home"
+	KeyEnd       = "end"
+	KeyEnter     = "enter"
+	KeyEscape    = "esc"
+	KeyBackspace = "backspace"
+	KeyTab       = "tab"
+	KeyCtrlC     = "ctrl-c"
+)
+
+// ErrNotTerminal is returned when the UI is started without a terminal.
+var ErrNotTerminal = errors.New("portpls ui needs an interactive terminal")
+
+// ANSI sequences for taking over and restoring the screen.
+const (
+	enterScreen = "\033[?1049h\033[?25l"
+	leaveScreen = "\033[?25h\033[?1049l"
+	home        = "\033[H"
+	clearLine   = "\033[K"
+	reverse     = "\033[7m"
+	bold        = "\033[1m"
+	faint       = "\033[2m"
+	reset       = "\033[0m"
+)
+
+// terminal puts a tty into raw mode for the lifetime of the UI.
+type terminal struct {
+	in    *os.File
+	out   io.Writer
+	saved unix.Termios
+}
+
+func openTerminal(in *os.File, out io.Writer) (*terminal, error) {
+	fd := int(in.Fd())
+	saved, err := unix.IoctlGetTermios(fd, ioctlGetTermios)
+	if err != nil {
+		return nil, ErrNotTerminal
+	}
+	raw := *saved
+	raw.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+	raw.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	raw.Cflag &^= unix.CSIZE | unix.PARENB
+	raw.Cflag |= unix.CS8
+	raw.Cc[unix.VMIN] = 1
+	raw.Cc[unix.VTIME] = 0
+	if err := unix.IoctlSetTermios(fd, ioctlSetTermios, &raw); err != nil {
+		return nil, err
+	}
+	t := &terminal{in: in, out: out, saved: *saved}
+	_, err = io.WriteString(out, enterScreen)
+	return t, err
+}
+
+// size returns the terminal width and height, defaulting to 80x24.
+func (t *terminal) size() (int, int) {
+	ws, err := unix.IoctlGetWinsize(int(t.in.Fd()), unix.TIOCGWINSZ)
+	if err != nil || ws.Col == 0 || ws.Row == 0 {
+		return 80, 24
+	}
+	return int(ws.Col), int(ws.Row)
+}
+
+func (t *terminal) restore() {
+	_, _ = io.WriteString(t.out, leaveScreen)
+	_ = unix.IoctlSetTermios(int(t.in.Fd()), ioctlSetTermios, &t.saved)
+}
+
+// readKeys sends the keys typed on the terminal until reading fails.
+func (t *terminal) readKeys(keys chan<- string) {
+	buf := make([]byte, 64)
+	for {
+		n, err := t.in.Read(buf)
+		if err != nil {
+			close(keys)
+			return
+		}
+		for _, key := range parseKeys(buf[:n]) {
+			keys <- key
+		}
+	}
+}
+
+var escapeSequences = map[string]string{
+	"[A": KeyUp, "OA": KeyUp,
+	"[B": KeyDown, "OB": KeyDown,
+	"[5~": KeyPageUp, "[6~": KeyPageDown,
+	"[H": KeyHome, "OH": KeyHome, "[1~": KeyHome,
+	"[F": KeyEnd, "OF": KeyEnd, "[4~": KeyEnd,
+}
+
+// parseKeys splits one read from the terminal into keys. Unknown escape
+// sequences are dropped.
+func parseKeys(data []byte) []string {
+	var keys []string
+	for i := 0; i < len(data); i++ {
+		switch b := data[i]; {
+		case b == 0x1b:
+			if i+1 == len(data) {
+				keys = append(keys, KeyEscape)
+				continue
+			}
+			end := i + 1
+			for end < len(data) && end-i <= 3 {
+				if key, ok := escapeSequences[string(data[i+1:end+1])]; ok {
+					keys = append(keys, key)
+					break
+				}
+				end++
+			}
+			i = end
+		case b == '\r' || b == '\n':
+			keys = append(keys, KeyEnter)
+		case b == 0x7f || b == 0x08:
+			keys = append(keys, KeyBackspace)
+		case b == '\t':
+			keys = append(keys, KeyTab)
+		case b == 0x03:
+			keys = append(keys, KeyCtrlC)
+		case b >= 0x20 && b < 0x7f:
+			keys = append(keys, string(rune(b)))
+		}
+	}
+	return keys
+}
@@ -0,0 +1,91 @@
+// Package tui implements portpls ui, a full-screen terminal interface for
+// managing allocations.
+package tui
+
+import (
+	"io"
+	"os"
+	"os/signal"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/bamorim/portpls/internal/app"
+	"github.com/bamorim/portpls/internal/watch"
+)
+
+// Options configures Run.
+type Options struct {
+	App         app.Options
+	Refresh     time.Duration // how often busy/free status is refreshed
+	KillTimeout time.Duration // SIGTERM to SIGKILL delay for the kill action
+}
+
+type whoisReply struct {
+	port   int
+	result app.WhoisResult
+	err    error
+}
+
+// Run shows the UI on the controlling terminal until the user quits.
+func Run(opts Options) error {
+	term, err := openTerminal(os.Stdin, os.Stdout)
+	if err != nil {
+		return err
+	}
+	defer term.restore()
+
+	path, err := app.ResolveStorePath(opts.App)
+	if err != nil {
+		return err
+	}
+	backend := &AppBackend{Options: opts.App, KillTimeout: opts.KillTimeout, Terminal: os.Stdout}
+	model := NewModel(backend)
+	model.Resize(term.size())
+	model.Refresh()
+
+	stop := make(chan struct{})
+	defer close(stop)
+	changes := watch.File(path, stop)
+	keys := make(chan string)
+	go term.readKeys(keys)
+	resize := make(chan os.Signal, 1)
+	signal.Notify(resize, unix.SIGWINCH)
+	defer signal.Stop(resize)
+	ticker := time.NewTicker(opts.Refresh)
+	defer ticker.Stop()
+
+	whois := make(chan whoisReply, 1)
+	looking := 0 // port being looked up, 0 if none
+	for {
+		if port, ok := model.PendingWhois(); ok && looking == 0 {
+			looking = port
+			go func() {
+				result, err := backend.Whois(port)
+				whois <- whoisReply{port: port, result: result, err: err}
+			}()
+		}
+		if _, err := io.WriteString(os.Stdout, model.View()); err != nil {
+			return err
+		}
+		select {
+		case key, ok := <-keys:
+			if !ok || model.HandleKey(key) {
+				return nil
+			}
+		case reply := <-whois:
+			looking = 0
+			if reply.err != nil {
+				// Cache the failure so it is not retried until the next refresh
+				reply.result = app.WhoisResult{Port: reply.port}
+			}
+			model.SetWhois(reply.port, reply.result)
+		case <-changes:
+			model.Refresh()
+		case <-ticker.C:
+			model.Refresh()
+		case <-resize:
+			model.Resize(term.size())
+		}
+	}
+}
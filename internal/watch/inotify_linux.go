@@ -0,0 +1,56 @@
+package watch
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// notify watches the directory containing path with inotify, so that files
+// replaced by a rename, as the allocations file is on every write, keep
+// being watched. IN_CLOSE_WRITE is left out: readers open the allocations
+// file read-write to lock it, and closing it must not count as a change.
+func notify(path string, stop <-chan struct{}, changes chan<- struct{}) error {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return err
+	}
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	mask := uint32(unix.IN_MODIFY | unix.IN_CREATE | unix.IN_MOVED_TO | unix.IN_DELETE | unix.IN_MOVED_FROM)
+	if _, err := unix.InotifyAddWatch(fd, dir, mask); err != nil {
+		unix.Close(fd)
+		return err
+	}
+	// A non-blocking descriptor goes through the runtime poller, so Close
+	// interrupts a pending Read.
+	file := os.NewFile(uintptr(fd), "inotify")
+	go func() {
+		<-stop
+		file.Close()
+	}()
+	go func() {
+		buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+		for {
+			n, err := file.Read(buf)
+			if err != nil {
+				return
+			}
+			for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+				event := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+				start := offset + unix.SizeofInotifyEvent
+				name := string(bytes.TrimRight(buf[start:start+int(event.Len)], "\x00"))
+				if matches(name, base, event.Mask&unix.IN_MODIFY != 0) {
+					signal(changes)
+				}
+				offset = start + int(event.Len)
+			}
+		}
+	}()
+	return nil
+}
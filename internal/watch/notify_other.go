@@ -0,0 +1,10 @@
+//go:build !linux
+
+package watch
+
+import "errors"
+
+// notify is only implemented on Linux; elsewhere File polls.
+func notify(path string, stop <-chan struct{}, changes chan<- struct{}) error {
+	return errors.New("file notifications are not supported on this platform")
+}
@@ -0,0 +1,97 @@
+// Package watch reports changes to a file, such as the allocations store.
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// PollInterval is how often the polling fallback checks the file.
+const PollInterval = 500 * time.Millisecond
+
+// File returns a channel that receives a value whenever the file at path is
+// written, replaced by a rename, created or removed. Bursts of changes are
+// coalesced into one value. Writes to the SQLite companion files next to
+// path (-wal and -journal) count as changes to path, but creating or
+// removing them doesn't: SQLite does that whenever the database is opened
+// and closed, even just to read it. It uses inotify where available and
+// polls otherwise. Watching stops when stop is closed.
+func File(path string, stop <-chan struct{}) <-chan struct{} {
+	changes := make(chan struct{}, 1)
+	if err := notify(path, stop, changes); err != nil {
+		go poll(path, PollInterval, stop, changes)
+	}
+	return changes
+}
+
+// signal records a change without blocking; a pending value already covers it.
+func signal(changes chan<- struct{}) {
+	select {
+	case changes <- struct{}{}:
+	default:
+	}
+}
+
+// matches reports whether an event on name, a file in the watched directory,
+// is a change to the watched file base. written tells whether the event
+// was a write to the file's contents.
+func matches(name, base string, written bool) bool {
+	return name == base || written && isCompanion(name, base)
+}
+
+func isCompanion(name, base string) bool {
+	return name == base+"-wal" || name == base+"-journal"
+}
+
+// snapshot stats path and its -wal and -journal companion files, in that
+// order; missing files are nil.
+func snapshot(path string) []os.FileInfo {
+	dir, base := filepath.Split(path)
+	var infos []os.FileInfo
+	for _, name := range []string{base, base + "-wal", base + "-journal"} {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			info = nil
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+func changed(a, b os.FileInfo) bool {
+	if a == nil || b == nil {
+		return (a == nil) != (b == nil)
+	}
+	return !os.SameFile(a, b) || !a.ModTime().Equal(b.ModTime()) || a.Size() != b.Size()
+}
+
+// companionChanged is changed for a companion file, which only counts when
+// written: when it grew or was modified, or appeared with contents.
+func companionChanged(current, last os.FileInfo) bool {
+	switch {
+	case current == nil:
+		return false
+	case last == nil:
+		return current.Size() > 0
+	}
+	return current.Size() > last.Size() || !current.ModTime().Equal(last.ModTime())
+}
+
+func poll(path string, interval time.Duration, stop <-chan struct{}, changes chan<- struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	last := snapshot(path)
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		current := snapshot(path)
+		if changed(current[0], last[0]) || companionChanged(current[1], last[1]) || companionChanged(current[2], last[2]) {
+			signal(changes)
+		}
+		last = current
+	}
+}
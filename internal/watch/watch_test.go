@@ -0,0 +1,141 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bamorim/portpls/internal/allocations"
+)
+
+func expectChange(t *testing.T, changes <-chan struct{}, what string) {
+	t.Helper()
+	select {
+	case <-changes:
+	case <-time.After(3 * time.Second):
+		t.Fatalf("no change reported after %s", what)
+	}
+}
+
+func drain(changes <-chan struct{}) {
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case <-changes:
+	default:
+	}
+}
+
+func TestWatch(t *testing.T) {
+	watchers := map[string]func(path string, stop <-chan struct{}) <-chan struct{}{
+		"file": File,
+		"poll": func(path string, stop <-chan struct{}) <-chan struct{} {
+			changes := make(chan struct{}, 1)
+			go poll(path, 20*time.Millisecond, stop, changes)
+			return changes
+		},
+	}
+	for name, watch := range watchers {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "allocations.json")
+			if err := os.WriteFile(path, []byte("{}"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			stop := make(chan struct{})
+			defer close(stop)
+			changes := watch(path, stop)
+			time.Sleep(50 * time.Millisecond)
+
+			// Written in place
+			if err := os.WriteFile(path, []byte(`{"version":1}`), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			expectChange(t, changes, "write")
+			drain(changes)
+
+			// Replaced by a rename, then written again through the new file
+			for _, content := range []string{`{"version":2}`, `{"version":3}`} {
+				tmp := filepath.Join(dir, "allocations.json.tmp")
+				if err := os.WriteFile(tmp, []byte(content), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Rename(tmp, path); err != nil {
+					t.Fatal(err)
+				}
+				expectChange(t, changes, "rename")
+				drain(changes)
+			}
+
+			// Unrelated files are ignored
+			if err := os.WriteFile(filepath.Join(dir, "config.json"), []byte("{}"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case <-changes:
+				t.Error("change reported for an unrelated file")
+			case <-time.After(200 * time.Millisecond):
+			}
+		})
+	}
+}
+
+func TestSQLite(t *testing.T) {
+	watchers := map[string]func(path string, stop <-chan struct{}) <-chan struct{}{
+		"file": File,
+		"poll": func(path string, stop <-chan struct{}) <-chan struct{} {
+			changes := make(chan struct{}, 1)
+			go poll(path, 10*time.Millisecond, stop, changes)
+			return changes
+		},
+	}
+	for name, watch := range watchers {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "allocations.db")
+			open := func() *allocations.SQLiteStore {
+				t.Helper()
+				s, err := allocations.OpenSQLite(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return s
+			}
+			open().Close()
+			stop := make(chan struct{})
+			defer close(stop)
+			changes := watch(path, stop)
+			time.Sleep(50 * time.Millisecond)
+
+			// Every read opens and closes the database, which creates and
+			// removes the -wal file
+			for i := 0; i < 5; i++ {
+				s := open()
+				if err := s.View(func(tx allocations.Tx) error {
+					_, err := tx.Query(allocations.Query{})
+					return err
+				}); err != nil {
+					t.Fatal(err)
+				}
+				s.Close()
+				time.Sleep(20 * time.Millisecond)
+			}
+			select {
+			case <-changes:
+				t.Error("change reported for reads")
+			case <-time.After(200 * time.Millisecond):
+			}
+
+			s := open()
+			defer s.Close()
+			if err := s.Update(func(tx allocations.Tx) error {
+				return tx.Set(20000, &allocations.Allocation{Directory: "/a", Name: "main"})
+			}); err != nil {
+				t.Fatal(err)
+			}
+			expectChange(t, changes, "write with the database open")
+			drain(changes)
+			s.Close()
+			expectChange(t, changes, "checkpoint on close")
+		})
+	}
+}
@@ -2,18 +2,40 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
+	"net/http"
 	"os"
+	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"text/tabwriter"
 	"time"
 
 	"github.com/urfave/cli/v2"
 
+	"github.com/bamorim/portpls/internal/allocations"
 	"github.com/bamorim/portpls/internal/app"
+	"github.com/bamorim/portpls/internal/completion"
+	"github.com/bamorim/portpls/internal/config"
+	"github.com/bamorim/portpls/internal/forward"
+	"github.com/bamorim/portpls/internal/hook"
+	"github.com/bamorim/portpls/internal/labels"
+	"github.com/bamorim/portpls/internal/output"
+	"github.com/bamorim/portpls/internal/procfile"
+	"github.com/bamorim/portpls/internal/proxy"
+	"github.com/bamorim/portpls/internal/tui"
+	"github.com/bamorim/portpls/internal/watch"
 )
 
 var (
@@ -37,20 +59,40 @@ func main() {
 		Name:    "portpls",
 		Usage:   "Port allocation CLI",
 		Version: getVersion(),
-		Flags: []cli.Flag{
-			&cli.StringFlag{Name: "config", Usage: "Path to config file"},
-			&cli.StringFlag{Name: "allocations", Usage: "Path to allocations file"},
-			&cli.StringFlag{Name: "directory", Usage: "Override current directory"},
+		Flags: append([]cli.Flag{
+			&cli.StringFlag{Name: "config", Usage: "Path to config file (env: PORTPLS_CONFIG)"},
+			&cli.StringFlag{Name: "allocations", Usage: "Path to allocations file (env: PORTPLS_ALLOCATIONS)"},
+			&cli.StringFlag{Name: "directory", Usage: "Override current directory", EnvVars: []string{"PORTPLS_DIRECTORY"}},
+			&cli.BoolFlag{Name: "no-create", Usage: "Don't create a missing config file", EnvVars: []string{"PORTPLS_NO_CREATE"}},
 			&cli.BoolFlag{Name: "verbose", Usage: "Enable debug output"},
-		},
+		}, configOverrideFlags()...),
 		Commands: []*cli.Command{
 			getCommand(),
 			listCommand(),
 			lockCommand(),
 			unlockCommand(),
+			labelCommand(),
 			forgetCommand(),
 			scanCommand(),
+			whoisCommand(),
+			killCommand(),
+			waitCommand(),
+			uiCommand(),
+			promptCommand(),
+			hookCommand(),
+			envCommand(),
+			direnvCommand(),
+			composeCommand(),
+			dotenvCommand(),
+			proxyConfigCommand(),
+			proxyCommand(),
+			switchCommand(),
+			forwardCommand(),
+			runCommand(),
+			completionCommand(),
+			completeCommand(),
 			configCommand(),
+			migrateCommand(),
 		},
 	}
 
@@ -72,9 +114,15 @@ func getCommand() *cli.Command {
 		Usage: "Get a free port for the current directory",
 		Flags: []cli.Flag{
 			&cli.StringFlag{Name: "name", Aliases: []string{"n"}, Value: "main", Usage: "Named allocation"},
+			labelFlag(),
+			noteFlag(),
 		},
 		Action: func(c *cli.Context) error {
-			portNum, err := app.GetPort(optionsFromContext(c), c.String("name"))
+			meta, err := metadataFromFlags(c, nil)
+			if err != nil {
+				return exitForError(err)
+			}
+			portNum, err := app.GetPort(optionsFromContext(c), c.String("name"), meta)
 			if err != nil {
 				return exitForError(err)
 			}
@@ -88,41 +136,136 @@ func listCommand() *cli.Command {
 	return &cli.Command{
 		Name:  "list",
 		Usage: "List all port allocations",
-		Flags: []cli.Flag{
-			&cli.StringFlag{Name: "format", Aliases: []string{"f"}, Value: "table", Usage: "Output format: table, json"},
+		Flags: append([]cli.Flag{
+			&cli.StringFlag{Name: "format", Aliases: []string{"f"}, Value: "table", Usage: "Output format: table, json, ndjson, csv, tsv, yaml or template='{{.Port}} {{.Name}}'"},
+			&cli.StringFlag{Name: "columns", Usage: "Comma-separated columns to show: " + strings.Join(output.ColumnNames(), ",")},
+			&cli.BoolFlag{Name: "no-header", Usage: "Omit the header row of table, csv and tsv output"},
 			&cli.StringFlag{Name: "directory", Usage: "Filter by directory"},
-		},
+			&cli.StringFlag{Name: "name", Aliases: []string{"n"}, Usage: "Filter by allocation name"},
+			&cli.StringFlag{Name: "sort", Value: app.SortByPort, Usage: "Sort by port, dir or last-used"},
+			&cli.StringFlag{Name: "group-by", Usage: "Group the table by directory as a tree"},
+			&cli.BoolFlag{Name: "show-labels", Usage: "Add LABELS and NOTE columns to the table"},
+			&cli.BoolFlag{Name: "watch", Aliases: []string{"w"}, Usage: "Keep the table on screen, redrawing it when allocations change"},
+			&cli.DurationFlag{Name: "interval", Value: 2 * time.Second, Usage: "How often --watch refreshes busy/free status"},
+		}, filterFlags()...),
 		Action: func(c *cli.Context) error {
 			filter, err := listFilter(c)
 			if err != nil {
 				return exitForError(err)
 			}
-			entries, err := app.ListAllocations(optionsFromContext(c), filter)
+			match, err := filterPredicate(c)
 			if err != nil {
 				return exitForError(err)
 			}
-			format := strings.ToLower(c.String("format"))
-			switch format {
-			case "json":
-				return outputJSON(entries)
-			case "table":
-				return outputTable(entries)
-			default:
-				return cli.Exit("unknown format", 1)
+			if c.IsSet("name") {
+				match = app.MatchAll(match, app.WithName(c.String("name")))
+			}
+			match = app.MatchAll(app.InDirectories(filter), match)
+			load := func(readOnly bool) ([]app.AllocationEntry, error) {
+				list := app.ListAllocations
+				if readOnly {
+					list = app.ViewAllocations
+				}
+				entries, err := list(optionsFromContext(c), match)
+				if err != nil {
+					return nil, err
+				}
+				return entries, app.SortEntries(entries, c.String("sort"))
+			}
+
+			format := c.String("format")
+			outOpts := output.Options{NoHeader: c.Bool("no-header")}
+			if c.IsSet("columns") {
+				if outOpts.Columns, err = output.ParseColumns(c.String("columns")); err != nil {
+					return exitForError(err)
+				}
+			} else if c.Bool("show-labels") {
+				outOpts.Columns = append(append([]string{}, output.DefaultColumns...), "labels", "note")
+			}
+			if c.Bool("watch") {
+				if !output.IsTable(format) || c.IsSet("group-by") {
+					return cli.Exit("--watch is only supported with the table format and without --group-by", 2)
+				}
+				return exitForError(watchList(c, load, outOpts))
+			}
+
+			entries, err := load(false)
+			if err != nil {
+				return exitForError(err)
+			}
+			if c.IsSet("group-by") {
+				if !output.IsTable(format) {
+					return cli.Exit("--group-by is only supported with the table format", 2)
+				}
+				groups, err := app.GroupEntries(entries, c.String("group-by"))
+				if err != nil {
+					return exitForError(err)
+				}
+				return exitForError(output.WriteTree(os.Stdout, groups, c.Bool("show-labels")))
 			}
+			return exitForError(output.Write(os.Stdout, format, entries, outOpts))
 		},
 	}
 }
 
+// watchList redraws the list whenever the allocations store changes and
+// every --interval, to pick up ports that became busy or free. The first
+// frame expires allocations like list does; later ones only read, so they
+// don't trigger further change notifications.
+func watchList(c *cli.Context, load func(readOnly bool) ([]app.AllocationEntry, error), outOpts output.Options) error {
+	path, err := app.ResolveStorePath(optionsFromContext(c))
+	if err != nil {
+		return err
+	}
+	entries, err := load(false)
+	if err != nil {
+		return err
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	changes := watch.File(path, stop)
+	ticker := time.NewTicker(c.Duration("interval"))
+	defer ticker.Stop()
+	var previous []app.AllocationEntry
+	for {
+		if err := output.WriteFrame(os.Stdout, entries, previous, outOpts, time.Now()); err != nil {
+			return err
+		}
+		previous = entries
+		// Change notifications that leave the allocations as they were
+		// don't need a new frame; the ticker still redraws.
+		for {
+			tick := false
+			select {
+			case <-changes:
+			case <-ticker.C:
+				tick = true
+			}
+			if entries, err = load(true); err != nil {
+				return err
+			}
+			if tick || !reflect.DeepEqual(entries, previous) {
+				break
+			}
+		}
+	}
+}
+
 func lockCommand() *cli.Command {
 	return &cli.Command{
 		Name:  "lock",
 		Usage: "Lock a port to prevent reallocation",
 		Flags: []cli.Flag{
 			&cli.StringFlag{Name: "name", Aliases: []string{"n"}, Value: "main", Usage: "Named allocation"},
+			labelFlag(),
+			noteFlag(),
 		},
 		Action: func(c *cli.Context) error {
-			portNum, err := app.LockPort(optionsFromContext(c), c.String("name"))
+			meta, err := metadataFromFlags(c, nil)
+			if err != nil {
+				return exitForError(err)
+			}
+			portNum, err := app.LockPort(optionsFromContext(c), c.String("name"), meta)
 			if err != nil {
 				return exitForError(err)
 			}
@@ -151,21 +294,49 @@ func unlockCommand() *cli.Command {
 	}
 }
 
+func labelCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "label",
+		Usage:     "Show or change the labels and note of an allocation",
+		ArgsUsage: "[KEY=VALUE ...] [KEY- ...]",
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "name", Aliases: []string{"n"}, Value: "main", Usage: "Named allocation"},
+			&cli.StringFlag{Name: "directory", Usage: "Override directory"},
+			noteFlag(),
+		},
+		Action: func(c *cli.Context) error {
+			meta, err := metadataFromFlags(c, c.Args().Slice())
+			if err != nil {
+				return exitForError(err)
+			}
+			result, err := app.Label(optionsFromContext(c), c.String("name"), meta)
+			if err != nil {
+				return exitForError(err)
+			}
+			fmt.Fprintf(os.Stdout, "Port %d: %s\n", result.Port, labels.Format(result.Labels))
+			if result.Note != "" {
+				fmt.Fprintf(os.Stdout, "Note: %s\n", result.Note)
+			}
+			return nil
+		},
+	}
+}
+
 func forgetCommand() *cli.Command {
 	return &cli.Command{
 		Name:  "forget",
 		Usage: "Remove port allocations",
-		Flags: []cli.Flag{
+		Flags: append([]cli.Flag{
 			&cli.StringFlag{Name: "name", Aliases: []string{"n"}, Value: "main", Usage: "Named allocation"},
 			&cli.BoolFlag{Name: "all", Usage: "Remove all allocations"},
 			&cli.BoolFlag{Name: "all-directories", Usage: "Apply to all directories instead of just one"},
 			&cli.StringFlag{Name: "directory", Usage: "Override directory"},
-		},
+		}, filterFlags()...),
 		Action: func(c *cli.Context) error {
-			// Determine the directory filter
+			// Determine the directory filter; --under replaces it
 			var filter app.DirectoryFilter
 			var err error
-			if c.Bool("all-directories") {
+			if c.Bool("all-directories") || c.IsSet("under") {
 				filter = app.NoFilter()
 			} else {
 				filter, err = app.FilterBySelector(directorySelector(c))
@@ -174,15 +345,22 @@ func forgetCommand() *cli.Command {
 				}
 			}
 
-			// Only require confirmation for global delete (--all --all-directories)
+			match, err := filterPredicate(c)
+			if err != nil {
+				return exitForError(err)
+			}
+
+			// Only require confirmation for deletes across directories
 			var confirm func() bool
-			if c.Bool("all") && c.Bool("all-directories") {
-				confirm = confirmAll
+			acrossDirectories := c.Bool("all-directories") || c.IsSet("under")
+			if app.ForgetNeedsConfirmation(acrossDirectories, c.Bool("all"), c.IsSet("name"), match != nil) {
+				confirm = func() bool { return confirmGlobalForget(match != nil) }
 			}
 
 			result, err := app.Forget(
 				optionsFromContext(c),
 				filter,
+				match,
 				c.String("name"),
 				c.IsSet("name"),
 				c.Bool("all"),
@@ -218,153 +396,1274 @@ func scanCommand() *cli.Command {
 	}
 }
 
-func configCommand() *cli.Command {
+func whoisCommand() *cli.Command {
 	return &cli.Command{
-		Name:      "config",
-		Usage:     "Show or modify configuration",
-		ArgsUsage: "[KEY] [VALUE]",
+		Name:      "whois",
+		Usage:     "Show the allocation and the process or container holding a port",
+		ArgsUsage: "PORT",
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "format", Aliases: []string{"f"}, Value: "text", Usage: "Output format: text, json"},
+		},
 		Action: func(c *cli.Context) error {
-			if c.Args().Len() == 0 {
-				lines, err := app.ConfigShow(optionsFromContext(c))
-				if err != nil {
-					return exitForError(err)
-				}
-				for _, line := range lines {
-					fmt.Fprintln(os.Stdout, line)
-				}
-				return nil
+			if c.NArg() != 1 {
+				return cli.Exit("usage: portpls whois PORT", 2)
 			}
-			key := c.Args().Get(0)
-			if c.Args().Len() == 1 {
-				value, err := app.ConfigGet(optionsFromContext(c), key)
-				if err != nil {
-					return exitForError(err)
-				}
-				fmt.Fprintln(os.Stdout, value)
-				return nil
+			portNum, err := strconv.Atoi(c.Args().First())
+			if err != nil {
+				return cli.Exit(fmt.Sprintf("invalid port: %s", c.Args().First()), 2)
+			}
+			result, err := app.Whois(optionsFromContext(c), portNum)
+			if err != nil {
+				return exitForError(err)
+			}
+			switch strings.ToLower(c.String("format")) {
+			case "json":
+				err = writeJSON(result)
+			case "text":
+				err = outputWhois(result)
+			default:
+				err = app.NewCodeError(1, fmt.Errorf("%w: %s", app.ErrUnknownFormat, c.String("format")))
 			}
-			value := c.Args().Get(1)
-			line, err := app.ConfigSet(optionsFromContext(c), key, value)
 			if err != nil {
 				return exitForError(err)
 			}
-			fmt.Fprintln(os.Stdout, line)
+			if code := result.ExitCode(); code != 0 {
+				return cli.Exit("", code)
+			}
 			return nil
 		},
 	}
 }
 
-func optionsFromContext(c *cli.Context) app.Options {
-	return app.Options{
-		ConfigPath:      c.String("config"),
-		AllocationsPath: c.String("allocations"),
-		Directory:       directorySelector(c),
-		Verbose:         c.Bool("verbose"),
+func killCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "kill",
+		Usage: "Stop the process or container holding an allocated port",
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "name", Aliases: []string{"n"}, Value: "main", Usage: "Named allocation"},
+			&cli.StringFlag{Name: "directory", Usage: "Override directory"},
+			&cli.BoolFlag{Name: "yes", Aliases: []string{"y"}, Usage: "Don't ask for confirmation"},
+			&cli.BoolFlag{Name: "force", Usage: "Also stop processes of other users or other allocations' directories"},
+			&cli.DurationFlag{Name: "timeout", Value: 5 * time.Second, Usage: "How long to wait after SIGTERM before sending SIGKILL"},
+		},
+		Action: func(c *cli.Context) error {
+			var confirm func(app.KillTarget) bool
+			if !c.Bool("yes") {
+				confirm = confirmKill
+			}
+			result, err := app.Kill(optionsFromContext(c), c.String("name"), c.Duration("timeout"), c.Bool("force"), confirm)
+			if err != nil {
+				return exitForError(err)
+			}
+			fmt.Fprintln(os.Stdout, result.Message)
+			return nil
+		},
 	}
 }
 
-// directorySelector returns a DirectorySelector from CLI flags.
-// Priority: command-specific --directory > parent/global --directory > current directory
-func directorySelector(c *cli.Context) app.DirectorySelector {
-	if c.IsSet("directory") {
-		return app.SpecificDirectory{Path: c.String("directory")}
-	}
-	if parent, ok := parentDirectory(c); ok {
-		return app.SpecificDirectory{Path: parent}
+func waitCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "wait",
+		Usage: "Wait until a service accepts connections on its allocated port",
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{Name: "name", Aliases: []string{"n"}, Value: cli.NewStringSlice("main"), Usage: "Named allocation; repeat or separate with commas to wait for several"},
+			&cli.StringFlag{Name: "directory", Usage: "Override directory"},
+			&cli.DurationFlag{Name: "timeout", Aliases: []string{"t"}, Value: 60 * time.Second, Usage: "Give up after this long (0 waits forever)"},
+			&cli.DurationFlag{Name: "interval", Value: 250 * time.Millisecond, Usage: "Time between checks"},
+			&cli.StringFlag{Name: "http", Usage: "Wait for a 2xx response to GET on this path instead"},
+			&cli.BoolFlag{Name: "free", Usage: "Wait until the ports are released instead"},
+		},
+		Action: func(c *cli.Context) error {
+			_, err := app.Wait(optionsFromContext(c), app.WaitOptions{
+				Names:    c.StringSlice("name"),
+				Timeout:  c.Duration("timeout"),
+				Interval: c.Duration("interval"),
+				HTTPPath: c.String("http"),
+				Free:     c.Bool("free"),
+			})
+			return exitForError(err)
+		},
 	}
-	return app.CurrentDirectory{}
 }
 
-// listFilter returns a DirectoryFilter for the list command.
-// Priority: command-specific --directory > parent/global --directory > no filter (show all)
-func listFilter(c *cli.Context) (app.DirectoryFilter, error) {
-	if c.IsSet("directory") {
-		return app.FilterByDirectory(c.String("directory"))
-	}
-	if parent, ok := parentDirectory(c); ok {
-		return app.FilterByDirectory(parent)
+func uiCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "ui",
+		Usage: "Manage allocations in a full-screen terminal UI",
+		Flags: []cli.Flag{
+			&cli.DurationFlag{Name: "interval", Value: 2 * time.Second, Usage: "How often busy/free status is refreshed"},
+			&cli.DurationFlag{Name: "kill-timeout", Value: 5 * time.Second, Usage: "How long the kill action waits after SIGTERM before sending SIGKILL"},
+		},
+		Action: func(c *cli.Context) error {
+			err := tui.Run(tui.Options{
+				App:         optionsFromContext(c),
+				Refresh:     c.Duration("interval"),
+				KillTimeout: c.Duration("kill-timeout"),
+			})
+			if errors.Is(err, tui.ErrNotTerminal) {
+				return cli.Exit(err.Error(), 2)
+			}
+			return exitForError(err)
+		},
 	}
-	return app.NoFilter(), nil
 }
 
-// parentDirectory returns the directory from the root/parent CLI context if set.
-func parentDirectory(c *cli.Context) (string, bool) {
-	lineage := c.Lineage()
-	if len(lineage) == 0 {
-		return "", false
-	}
-	root := lineage[len(lineage)-1]
-	if root == nil || root == c {
-		return "", false
-	}
-	if root.IsSet("directory") {
-		return root.String("directory"), true
+func promptCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "prompt",
+		Usage: "Print the current directory's ports for a shell prompt or status bar",
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "format", Aliases: []string{"f"}, Value: "{{.Name}}:{{.Port}}", Usage: "Go template for each allocation"},
+			&cli.StringFlag{Name: "separator", Value: " ", Usage: "Text between allocations"},
+			&cli.StringFlag{Name: "directory", Usage: "Override directory"},
+			&cli.BoolFlag{Name: "check", Usage: "Check whether each port is busy, filling in .Status (slower)"},
+			&cli.BoolFlag{Name: "no-cache", Usage: "Always read the allocations store"},
+		},
+		Action: func(c *cli.Context) error {
+			prompt := app.PromptOptions{Check: c.Bool("check")}
+			if !c.Bool("no-cache") {
+				prompt.CachePath = app.DefaultPromptCachePath()
+			}
+			entries, err := app.Prompt(optionsFromContext(c), prompt)
+			if err != nil {
+				return exitForError(err)
+			}
+			return exitForError(output.WritePrompt(os.Stdout, c.String("format"), c.String("separator"), entries))
+		},
 	}
-	return "", false
 }
 
-func exitForError(err error) error {
-	if err == nil {
-		return nil
-	}
-	var codeErr app.CodeError
-	if errors.As(err, &codeErr) {
-		return cli.Exit(codeErr.Error(), codeErr.Code)
+func hookCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "hook",
+		Usage:     "Print a shell hook that exports the current project's ports on cd",
+		ArgsUsage: "bash|zsh|fish",
+		Action: func(c *cli.Context) error {
+			if c.NArg() != 1 {
+				return cli.Exit("usage: portpls hook bash|zsh|fish", 2)
+			}
+			script, err := hook.Script(c.Args().First())
+			if err != nil {
+				return cli.Exit(err.Error(), 2)
+			}
+			fmt.Fprint(os.Stdout, script)
+			return nil
+		},
 	}
-	return cli.Exit(err.Error(), 2)
 }
 
-func outputJSON(entries []app.AllocationEntry) error {
-	payload, err := json.MarshalIndent(entries, "", "  ")
-	if err != nil {
-		return err
+// envCommand is run by the shell hooks before each prompt and prints the
+// code that updates the exported port variables. While the allocations are
+// being written and nothing is cached it prints nothing, keeping the
+// current variables.
+func envCommand() *cli.Command {
+	return &cli.Command{
+		Name:      hook.Command,
+		Hidden:    true,
+		ArgsUsage: "bash|zsh|fish",
+		Action: func(c *cli.Context) error {
+			env, err := app.Env(optionsFromContext(c), app.DefaultPromptCachePath())
+			if errors.Is(err, allocations.ErrBusy) {
+				return nil
+			} else if err != nil {
+				return exitForError(err)
+			}
+			code, err := hook.Export(c.Args().First(), env.Vars, os.Getenv(hook.EnvExported))
+			if err != nil {
+				return cli.Exit(err.Error(), 2)
+			}
+			fmt.Fprint(os.Stdout, code)
+			return nil
+		},
 	}
-	fmt.Fprintln(os.Stdout, string(payload))
-	return nil
 }
 
-func outputTable(entries []app.AllocationEntry) error {
-	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-	fmt.Fprintln(writer, "PORT\tDIRECTORY\tNAME\tSTATUS\tLOCKED\tASSIGNED\tLAST_USED")
-	for _, entry := range entries {
-		locked := "no"
-		if entry.Locked {
-			locked = "yes"
-		}
-		fmt.Fprintf(writer, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n",
-			entry.Port,
-			shortenHome(entry.Directory),
-			entry.Name,
-			entry.Status,
-			locked,
-			formatTimestamp(entry.AssignedAt),
-			formatTimestamp(entry.LastUsedAt),
-		)
+func direnvCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "direnv",
+		Usage: "Print the current project's ports for an .envrc: eval \"$(portpls direnv)\"",
+		Action: func(c *cli.Context) error {
+			env, err := app.Env(optionsFromContext(c), app.DefaultPromptCachePath())
+			if err != nil {
+				return exitForError(err)
+			}
+			fmt.Fprint(os.Stdout, hook.Direnv(app.StoreFiles(env.Store), env.Vars))
+			return nil
+		},
 	}
-	return writer.Flush()
 }
 
-func formatTimestamp(t time.Time) string {
-	return t.Local().Format("2006-01-02 15:04")
+func composeCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "compose",
+		Usage: "Write a Docker Compose override that publishes each service on an allocated port",
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "file", Aliases: []string{"f"}, Usage: "Compose file (default: compose.yaml, compose.yml, docker-compose.yaml or docker-compose.yml)"},
+			&cli.StringFlag{Name: "output", Aliases: []string{"o"}, Usage: "Override file (default: the compose file name with .override, e.g. compose.override.yaml)"},
+			&cli.StringFlag{Name: "directory", Usage: "Override directory"},
+			&cli.BoolFlag{Name: "check", Usage: "Report drift between the override file and the allocations without changing anything"},
+			&cli.BoolFlag{Name: "force", Usage: "Replace an override file that portpls didn't write"},
+		},
+		Action: func(c *cli.Context) error {
+			result, err := app.Compose(optionsFromContext(c), app.ComposeOptions{
+				File:   c.String("file"),
+				Output: c.String("output"),
+				Check:  c.Bool("check"),
+				Force:  c.Bool("force"),
+			})
+			if err != nil {
+				return exitForError(err)
+			}
+			if c.Bool("check") {
+				if len(result.Drift) == 0 {
+					fmt.Fprintf(os.Stdout, "%s is up to date\n", result.Output)
+					return nil
+				}
+				for _, line := range result.Drift {
+					fmt.Fprintln(os.Stdout, line)
+				}
+				return cli.Exit("", 1)
+			}
+			fmt.Fprintf(os.Stdout, "Wrote %s (project %s)\n", result.Output, result.Project)
+			writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			for _, svc := range result.Services {
+				fmt.Fprintf(writer, "  %s\t%s\n", svc.Name, strings.Join(svc.Ports, ", "))
+			}
+			return writer.Flush()
+		},
+	}
 }
 
-func shortenHome(path string) string {
-	home, err := os.UserHomeDir()
-	if err != nil {
-		return path
-	}
-	if strings.HasPrefix(path, home) {
-		remainder := strings.TrimPrefix(path, home)
-		if remainder == "" {
-			return "~"
-		}
-		return filepath.Join("~", remainder)
+func dotenvCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "dotenv",
+		Usage: "Keep the directory's port variables in a marked block of a .env file",
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "write", Aliases: []string{"w"}, Usage: "Add or update the portpls block in `FILE`"},
+			&cli.StringFlag{Name: "check", Usage: "Exit with code 1 if the portpls block in `FILE` is out of date"},
+			&cli.StringFlag{Name: "remove", Usage: "Delete the portpls block from `FILE`"},
+			&cli.StringFlag{Name: "directory", Usage: "Override directory"},
+		},
+		Action: func(c *cli.Context) error {
+			var file string
+			var d app.DotenvOptions
+			for _, mode := range []string{"write", "check", "remove"} {
+				if !c.IsSet(mode) {
+					continue
+				}
+				if file != "" {
+					return cli.Exit("use only one of --write, --check and --remove", 2)
+				}
+				file = c.String(mode)
+				d = app.DotenvOptions{File: file, Check: mode == "check", Remove: mode == "remove"}
+			}
+			opts := optionsFromContext(c)
+			if file == "" {
+				vars, err := app.DotenvVars(opts)
+				if err != nil {
+					return exitForError(err)
+				}
+				names := make([]string, 0, len(vars))
+				for name := range vars {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+				for _, name := range names {
+					fmt.Fprintf(os.Stdout, "%s=%s\n", name, vars[name])
+				}
+				return nil
+			}
+			result, err := app.Dotenv(opts, d)
+			if err != nil {
+				return exitForError(err)
+			}
+			for _, name := range result.Shadowed {
+				fmt.Fprintf(os.Stderr, "warning: %s is also set outside the portpls block in %s\n", name, result.File)
+			}
+			switch {
+			case d.Check && result.Changed:
+				return cli.Exit(fmt.Sprintf("%s is out of date; run portpls dotenv --write %s", result.File, file), 1)
+			case !result.Changed:
+				fmt.Fprintf(os.Stdout, "%s is up to date\n", result.File)
+			case d.Remove:
+				fmt.Fprintf(os.Stdout, "Removed the portpls block from %s\n", result.File)
+			default:
+				fmt.Fprintf(os.Stdout, "Wrote %d port variable(s) to %s\n", len(result.Vars), result.File)
+			}
+			return nil
+		},
 	}
-	return path
 }
 
-func confirmAll() bool {
-	fmt.Fprint(os.Stdout, "This will remove ALL port allocations. Continue? [y/N] ")
+func proxyConfigCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "proxy-config",
+		Usage: "Render reverse proxy config routing <name>.<project>.localhost to each allocated port",
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "format", Aliases: []string{"f"}, Value: proxy.FormatCaddy, Usage: "Config format: caddy, nginx or traefik"},
+			&cli.StringFlag{Name: "output", Aliases: []string{"o"}, Usage: "Write the config to `FILE` instead of stdout"},
+			&cli.StringFlag{Name: "project-name", Value: proxy.ProjectFromDirectory, Usage: "Where project names come from: directory (base name) or branch (git branch)"},
+			&cli.StringFlag{Name: "domain", Value: proxy.DefaultDomain, Usage: "Domain the project hosts are created under"},
+			&cli.IntFlag{Name: "listen", Value: 80, Usage: "Port the proxy listens on (caddy and nginx)"},
+			&cli.StringFlag{Name: "upstream", Value: proxy.DefaultUpstream, Usage: "Host the proxy reaches the allocated ports on"},
+			&cli.BoolFlag{Name: "watch", Aliases: []string{"w"}, Usage: "Keep running and rewrite --output whenever allocations change"},
+			&cli.StringFlag{Name: "reload", Usage: "Shell command to run after each write, e.g. 'caddy reload'"},
+			&cli.DurationFlag{Name: "interval", Value: 2 * time.Second, Usage: "How often --watch also re-renders, to pick up branch changes"},
+		},
+		Action: func(c *cli.Context) error {
+			if c.Bool("watch") && c.String("output") == "" {
+				return cli.Exit("--watch needs --output", 2)
+			}
+			opts := optionsFromContext(c)
+			p := app.ProxyOptions{ProjectName: c.String("project-name"), Domain: c.String("domain")}
+			render := func() ([]byte, []string, error) {
+				routes, warnings, err := app.ProxyRoutes(opts, p)
+				if err != nil {
+					return nil, nil, err
+				}
+				data, err := proxy.Render(c.String("format"), routes, proxy.RenderOptions{Listen: c.Int("listen"), Upstream: c.String("upstream")})
+				if errors.Is(err, proxy.ErrUnknownFormat) {
+					err = app.NewCodeError(2, err)
+				}
+				return data, warnings, err
+			}
+			if c.String("output") == "" {
+				data, warnings, err := render()
+				if err != nil {
+					return exitForError(err)
+				}
+				printWarnings(warnings)
+				_, err = os.Stdout.Write(data)
+				return exitForError(err)
+			}
+			if !c.Bool("watch") {
+				changed, err := writeProxyConfig(c, render)
+				if err == nil && changed {
+					err = reloadProxy(c)
+				}
+				return exitForError(err)
+			}
+			return exitForError(watchProxyConfig(c, render))
+		},
+	}
+}
+
+// writeProxyConfig renders the proxy config into --output unless it is
+// already up to date. It reports whether the file changed.
+func writeProxyConfig(c *cli.Context, render func() ([]byte, []string, error)) (bool, error) {
+	data, warnings, err := render()
+	if err != nil {
+		return false, err
+	}
+	path := c.String("output")
+	if existing, err := os.ReadFile(path); err == nil && string(existing) == string(data) {
+		return false, nil
+	}
+	if err := proxy.WriteFile(path, data); err != nil {
+		return false, err
+	}
+	printWarnings(warnings)
+	fmt.Fprintf(os.Stdout, "Wrote %s\n", path)
+	return true, nil
+}
+
+// reloadProxy runs the --reload command, if any.
+func reloadProxy(c *cli.Context) error {
+	reload := c.String("reload")
+	if reload == "" {
+		return nil
+	}
+	cmd := exec.Command("/bin/sh", "-c", reload)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s: %w", reload, err)
+	}
+	return nil
+}
+
+// watchProxyConfig rewrites the proxy config whenever the allocations store
+// changes, and every --interval since project names can also change with
+// the checked-out branch. Unchanged configs are not rewritten or reloaded,
+// and failed reloads are reported without stopping.
+func watchProxyConfig(c *cli.Context, render func() ([]byte, []string, error)) error {
+	path, err := app.ResolveStorePath(optionsFromContext(c))
+	if err != nil {
+		return err
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	changes := watch.File(path, stop)
+	ticker := time.NewTicker(c.Duration("interval"))
+	defer ticker.Stop()
+	for {
+		changed, err := writeProxyConfig(c, render)
+		if err != nil {
+			return err
+		}
+		if changed {
+			if err := reloadProxy(c); err != nil {
+				fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+			}
+		}
+		select {
+		case <-changes:
+		case <-ticker.C:
+		}
+	}
+}
+
+func proxyCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "proxy",
+		Usage: "Serve every allocation on one port, routing by host name such as web.<project>.localhost",
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "listen", Value: "127.0.0.1:8080", Usage: "Address to listen on"},
+			&cli.StringFlag{Name: "project-name", Value: proxy.ProjectFromDirectory, Usage: "Where project names come from: directory (base name) or branch (git branch)"},
+			&cli.StringFlag{Name: "domain", Value: proxy.DefaultDomain, Usage: "Domain the project hosts are created under"},
+			&cli.StringFlag{Name: "upstream", Value: proxy.DefaultUpstream, Usage: "Host the allocated ports are reached on"},
+			&cli.DurationFlag{Name: "interval", Value: 2 * time.Second, Usage: "How often routes are also re-read, to pick up branch changes"},
+		},
+		Action: func(c *cli.Context) error {
+			return exitForError(serveProxy(c))
+		},
+	}
+}
+
+// serveProxy runs the proxy until SIGINT or SIGTERM, re-reading the routes
+// whenever the allocations store changes and every --interval.
+func serveProxy(c *cli.Context) error {
+	opts := optionsFromContext(c)
+	p := app.ProxyOptions{ProjectName: c.String("project-name"), Domain: c.String("domain")}
+	server := proxy.NewServer(c.String("upstream"))
+	var lastWarnings []string
+	load := func() error {
+		routes, warnings, err := app.ProxyRoutes(opts, p)
+		if err != nil {
+			return err
+		}
+		if !slices.Equal(warnings, lastWarnings) {
+			printWarnings(warnings)
+			lastWarnings = warnings
+		}
+		if !reflect.DeepEqual(routes, server.Routes()) {
+			server.SetRoutes(routes)
+			fmt.Fprintf(os.Stdout, "%s %d route(s)\n", time.Now().Format("15:04:05"), len(routes))
+		}
+		return nil
+	}
+	if err := load(); err != nil {
+		return err
+	}
+	path, err := app.ResolveStorePath(opts)
+	if err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("tcp", c.String("listen"))
+	if err != nil {
+		return app.NewCodeError(1, err)
+	}
+	httpServer := &http.Server{Handler: server.Handler(), ReadHeaderTimeout: 10 * time.Second}
+	served := make(chan error, 1)
+	go func() { served <- httpServer.Serve(listener) }()
+	fmt.Fprintf(os.Stdout, "Proxying on http://%s (open it for the list of routes)\n", listener.Addr())
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	stop := make(chan struct{})
+	defer close(stop)
+	changes := watch.File(path, stop)
+	ticker := time.NewTicker(c.Duration("interval"))
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-served:
+			return err
+		case <-signals:
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			return httpServer.Shutdown(ctx)
+		case <-changes:
+		case <-ticker.C:
+		}
+		if err := load(); err != nil {
+			// Keep serving the last good routes; the store may be mid-migration.
+			fmt.Fprintf(os.Stderr, "warning: reading allocations: %v\n", err)
+		}
+	}
+}
+
+func switchCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "switch",
+		Usage: "Make this directory's allocation the one portpls forward sends an alias port to",
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "name", Aliases: []string{"n"}, Value: "main", Usage: "Named allocation"},
+			&cli.IntFlag{Name: "port", Aliases: []string{"p"}, Usage: "Alias port, e.g. 3000 (default: the one allocations with this name already use)"},
+			&cli.StringFlag{Name: "directory", Usage: "Override directory"},
+		},
+		Action: func(c *cli.Context) error {
+			result, err := app.Switch(optionsFromContext(c), c.String("name"), c.Int("port"))
+			if err != nil {
+				return exitForError(err)
+			}
+			fmt.Fprintf(os.Stdout, "Port %d now forwards to %d\n", result.Alias, result.Port)
+			if prev := result.Previous; prev != nil {
+				fmt.Fprintf(os.Stdout, "(was %d, %s in %s)\n", prev.Port, prev.Name, prev.Directory)
+			}
+			return nil
+		},
+	}
+}
+
+func forwardCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "forward",
+		Usage: "Forward alias ports to the allocations switched to them",
+		Flags: []cli.Flag{
+			&cli.IntSliceFlag{Name: "port", Aliases: []string{"p"}, Usage: "Alias port to listen on, repeatable (default: every alias port in use)"},
+			&cli.StringFlag{Name: "listen-host", Value: "127.0.0.1", Usage: "Address to listen on"},
+			&cli.StringFlag{Name: "upstream", Value: proxy.DefaultUpstream, Usage: "Host the allocated ports are reached on"},
+			&cli.DurationFlag{Name: "interval", Value: 2 * time.Second, Usage: "How often the active allocations are also re-read"},
+		},
+		Action: func(c *cli.Context) error {
+			return exitForError(serveForward(c))
+		},
+	}
+}
+
+// serveForward listens on every alias port until SIGINT or SIGTERM. The
+// active allocations are re-read whenever the store changes and every
+// --interval, so portpls switch takes effect on the next connection without
+// each connection reading the store.
+func serveForward(c *cli.Context) error {
+	opts := optionsFromContext(c)
+	aliases := c.IntSlice("port")
+	if len(aliases) == 0 {
+		var err error
+		if aliases, err = app.Aliases(opts); err != nil {
+			return err
+		}
+		if len(aliases) == 0 {
+			return app.NewCodeError(2, errors.New("no alias ports yet; run portpls switch --port PORT first, or pass --port"))
+		}
+	}
+	var listeners []net.Listener
+	defer func() {
+		for _, l := range listeners {
+			l.Close()
+		}
+	}()
+	for _, alias := range aliases {
+		l, err := net.Listen("tcp", net.JoinHostPort(c.String("listen-host"), strconv.Itoa(alias)))
+		if err != nil {
+			return app.NewCodeError(1, err)
+		}
+		listeners = append(listeners, l)
+	}
+
+	var mu sync.RWMutex
+	var targets map[int]app.AllocationEntry
+	load := func() error {
+		active, err := app.ActiveTargets(opts, aliases)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		targets = active
+		return nil
+	}
+	if err := load(); err != nil {
+		return err
+	}
+	path, err := app.ResolveStorePath(opts)
+	if err != nil {
+		return err
+	}
+
+	served := make(chan error, len(aliases))
+	for i, alias := range aliases {
+		f := &forward.Forwarder{
+			Resolve: func() (forward.Target, error) {
+				mu.RLock()
+				entry, ok := targets[alias]
+				mu.RUnlock()
+				if !ok {
+					return forward.Target{}, app.ErrAllocationNotFound
+				}
+				return forward.Target{
+					Addr:        net.JoinHostPort(c.String("upstream"), strconv.Itoa(entry.Port)),
+					Description: fmt.Sprintf("%d (%s in %s)", entry.Port, entry.Name, entry.Directory),
+				}, nil
+			},
+			Logf: func(format string, args ...any) {
+				fmt.Fprintf(os.Stdout, "%s %d: %s\n", time.Now().Format("15:04:05"), alias, fmt.Sprintf(format, args...))
+			},
+		}
+		fmt.Fprintf(os.Stdout, "Forwarding %s\n", listeners[i].Addr())
+		go func(l net.Listener) { served <- f.Serve(l) }(listeners[i])
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	stop := make(chan struct{})
+	defer close(stop)
+	changes := watch.File(path, stop)
+	ticker := time.NewTicker(c.Duration("interval"))
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-served:
+			return err
+		case <-signals:
+			return nil
+		case <-changes:
+		case <-ticker.C:
+		}
+		if err := load(); err != nil {
+			// Keep forwarding to the last known allocations.
+			fmt.Fprintf(os.Stderr, "warning: reading allocations: %v\n", err)
+		}
+	}
+}
+
+func printWarnings(warnings []string) {
+	for _, warning := range warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", warning)
+	}
+}
+
+func runCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "run",
+		Usage:     "Start the processes in a Procfile, each with PORT set to its own allocated port",
+		ArgsUsage: "[process...]",
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "procfile", Aliases: []string{"f"}, Usage: "Procfile to run (default: Procfile in the directory)"},
+			&cli.StringFlag{Name: "directory", Usage: "Override directory"},
+			&cli.DurationFlag{Name: "timeout", Value: 5 * time.Second, Usage: "How long to wait after SIGTERM before sending SIGKILL at shutdown"},
+		},
+		Action: func(c *cli.Context) error {
+			return exitForError(procfile.Run(procfile.Options{
+				App:      optionsFromContext(c),
+				Procfile: c.String("procfile"),
+				Names:    c.Args().Slice(),
+				Timeout:  c.Duration("timeout"),
+				Output:   os.Stdout,
+				Color:    colorOutput(os.Stdout),
+			}))
+		},
+	}
+}
+
+// colorOutput reports whether f is a terminal and NO_COLOR is unset.
+func colorOutput(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func completionCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "completion",
+		Usage:     "Print the shell completion script for bash, zsh or fish",
+		ArgsUsage: "bash|zsh|fish",
+		Action: func(c *cli.Context) error {
+			if c.NArg() != 1 {
+				return cli.Exit("usage: portpls completion bash|zsh|fish", 2)
+			}
+			script, err := completion.Script(c.Args().First())
+			if err != nil {
+				return cli.Exit(err.Error(), 2)
+			}
+			fmt.Fprint(os.Stdout, script)
+			return nil
+		},
+	}
+}
+
+// completeCommand is called by the completion scripts with the words typed
+// so far and prints one candidate per line.
+func completeCommand() *cli.Command {
+	return &cli.Command{
+		Name:            completion.Command,
+		Hidden:          true,
+		SkipFlagParsing: true,
+		Action: func(c *cli.Context) error {
+			words := c.Args().Slice()
+			if len(words) > 0 && words[0] == "--" {
+				words = words[1:]
+			}
+			for _, candidate := range completion.Complete(c.App, words, completionValues) {
+				fmt.Fprintln(os.Stdout, candidate)
+			}
+			return nil
+		},
+	}
+}
+
+// completionValues returns the candidates for flag values and positional
+// arguments. Lookups never wait for a lock and never create or migrate files.
+func completionValues(req completion.Request) []string {
+	opts := app.Options{
+		ConfigPath:      req.Flags["config"],
+		AllocationsPath: req.Flags["allocations"],
+		Directory:       app.CurrentDirectory{},
+		NoCreate:        true,
+	}
+	if dir := req.Flags["directory"]; dir != "" {
+		opts.Directory = app.SpecificDirectory{Path: dir}
+	} else if dir := os.Getenv("PORTPLS_DIRECTORY"); dir != "" {
+		opts.Directory = app.SpecificDirectory{Path: dir}
+	}
+	command := strings.Join(req.Command, " ")
+	switch req.Flag {
+	case "name":
+		names, _ := app.AllocationNames(opts)
+		return names
+	case "directory", "under":
+		dirs, _ := app.AllocatedDirectories(opts)
+		return dirs
+	case "format":
+		switch command {
+		case "whois":
+			return []string{"text", "json"}
+		case "prompt":
+			return nil
+		case "proxy-config":
+			return proxy.Formats
+		}
+		return []string{output.FormatTable, output.FormatJSON, output.FormatNDJSON, output.FormatCSV, output.FormatTSV, output.FormatYAML, "template="}
+	case "columns":
+		return output.ColumnNames()
+	case "sort":
+		return []string{app.SortByPort, app.SortByDir, app.SortByLastUsed}
+	case "group-by":
+		return []string{app.GroupByDirectory}
+	case "status":
+		return []string{app.StatusBusy, app.StatusFree}
+	case "to":
+		return []string{config.StorageJSON, config.StorageSQLite}
+	case "project-name":
+		return proxy.ProjectSources
+	case "":
+	default:
+		return nil
+	}
+
+	var keys []string
+	for _, key := range config.AllKeys() {
+		keys = append(keys, key.Name)
+	}
+	switch {
+	case command == "completion" && len(req.Args) == 0:
+		return completion.Shells
+	case command == "hook" && len(req.Args) == 0:
+		return hook.Shells
+	case command == "run":
+		path := req.Flags["procfile"]
+		if path == "" {
+			dir, err := opts.Directory.ResolveDirectory()
+			if err != nil {
+				return nil
+			}
+			path = filepath.Join(dir, "Procfile")
+		}
+		entries, _ := procfile.Load(path)
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name)
+		}
+		return names
+	case (command == "config unset" || command == "config describe") && len(req.Args) == 0:
+		return keys
+	case command == "config" && len(req.Args) == 0:
+		return keys
+	case command == "config" && len(req.Args) == 1:
+		if key, err := config.Lookup(req.Args[0]); err == nil {
+			return key.Values()
+		}
+	}
+	return nil
+}
+
+func confirmKill(target app.KillTarget) bool {
+	if ct := target.Container; ct != nil {
+		project := ""
+		if ct.ComposeProject != "" {
+			project = fmt.Sprintf(", compose project %s", ct.ComposeProject)
+		}
+		fmt.Fprintf(os.Stdout, "Port %d is published by container %s (%s%s). Run docker stop? [y/N] ", target.Port, ct.Name, ct.Image, project)
+	} else {
+		p := target.Process
+		fmt.Fprintf(os.Stdout, "Port %d is held by %s (pid %d, user %s). Kill it? [y/N] ", target.Port, p.Command, p.PID, p.User)
+	}
+	reader := bufio.NewReader(os.Stdin)
+	response, _ := reader.ReadString('\n')
+	response = strings.TrimSpace(strings.ToLower(response))
+	return response == "y" || response == "yes"
+}
+
+var whoisStates = map[string]string{
+	app.WhoisAllocatedBusy:   "allocated, in use",
+	app.WhoisAllocatedFree:   "allocated, not in use",
+	app.WhoisUnallocatedBusy: "not allocated, in use",
+	app.WhoisFree:            "not allocated, free",
+}
+
+func outputWhois(result app.WhoisResult) error {
+	fmt.Fprintf(os.Stdout, "Port %d: %s\n", result.Port, whoisStates[result.State])
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if a := result.Allocation; a != nil {
+		fmt.Fprintln(writer, "\nAllocation:")
+		fmt.Fprintf(writer, "  Directory:\t%s\n", output.ShortenHome(a.Directory))
+		fmt.Fprintf(writer, "  Name:\t%s\n", a.Name)
+		fmt.Fprintf(writer, "  Locked:\t%s\n", output.YesNo(a.Locked))
+		fmt.Fprintf(writer, "  Assigned:\t%s\n", output.FormatTimestamp(a.AssignedAt))
+		fmt.Fprintf(writer, "  Last used:\t%s\n", output.FormatTimestamp(a.LastUsedAt))
+		if len(a.Labels) > 0 {
+			fmt.Fprintf(writer, "  Labels:\t%s\n", labels.Format(a.Labels))
+		}
+		if a.Note != "" {
+			fmt.Fprintf(writer, "  Note:\t%s\n", a.Note)
+		}
+	}
+	if p := result.Process; p != nil {
+		fmt.Fprintln(writer, "\nProcess:")
+		fmt.Fprintf(writer, "  PID:\t%d\n", p.PID)
+		fmt.Fprintf(writer, "  Command:\t%s\n", p.Command)
+		if p.User != "" {
+			fmt.Fprintf(writer, "  User:\t%s\n", p.User)
+		}
+		if p.Cwd != "" {
+			fmt.Fprintf(writer, "  Cwd:\t%s\n", output.ShortenHome(p.Cwd))
+		}
+	}
+	if ct := result.Container; ct != nil {
+		fmt.Fprintln(writer, "\nContainer:")
+		fmt.Fprintf(writer, "  Name:\t%s\n", ct.Name)
+		fmt.Fprintf(writer, "  ID:\t%.12s\n", ct.ID)
+		fmt.Fprintf(writer, "  Image:\t%s\n", ct.Image)
+		if ct.ComposeProject != "" {
+			fmt.Fprintf(writer, "  Compose project:\t%s (service %s)\n", ct.ComposeProject, ct.ComposeService)
+		}
+		if ct.WorkingDir != "" {
+			fmt.Fprintf(writer, "  Directory:\t%s\n", output.ShortenHome(ct.WorkingDir))
+		}
+	}
+	if result.State == app.WhoisUnallocatedBusy && result.Process == nil && result.Container == nil {
+		fmt.Fprintln(writer, "\nThe process holding the port could not be identified.")
+	}
+	return writer.Flush()
+}
+
+func configCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "config",
+		Usage:     "Show or modify configuration",
+		ArgsUsage: "[KEY] [VALUE]",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{Name: "show-origin", Usage: "Show which file each value comes from"},
+			&cli.BoolFlag{Name: "json", Usage: "Output as JSON"},
+		},
+		Subcommands: []*cli.Command{
+			{
+				Name:      "unset",
+				Usage:     "Remove a key from the config file so it uses its default",
+				ArgsUsage: "KEY",
+				Action: func(c *cli.Context) error {
+					if c.Args().Len() != 1 {
+						return cli.Exit("usage: portpls config unset KEY", 2)
+					}
+					return printLine(app.ConfigUnset(optionsFromContext(c), c.Args().First()))
+				},
+			},
+			{
+				Name:  "reset",
+				Usage: "Reset the config file to the defaults, keeping storage",
+				Action: func(c *cli.Context) error {
+					return printLine(app.ConfigReset(optionsFromContext(c)))
+				},
+			},
+			{
+				Name:      "describe",
+				Usage:     "Describe a configuration key",
+				ArgsUsage: "KEY",
+				Action: func(c *cli.Context) error {
+					if c.Args().Len() != 1 {
+						return cli.Exit("usage: portpls config describe KEY", 2)
+					}
+					lines, err := app.ConfigDescribe(c.Args().First())
+					if err != nil {
+						return exitForError(err)
+					}
+					for _, line := range lines {
+						fmt.Fprintln(os.Stdout, line)
+					}
+					return nil
+				},
+			},
+			{
+				Name:  "edit",
+				Usage: "Edit the config file in $EDITOR",
+				Action: func(c *cli.Context) error {
+					return printLine(app.ConfigEdit(optionsFromContext(c), runEditor, confirmReedit))
+				},
+			},
+		},
+		Action: func(c *cli.Context) error {
+			if c.Args().Len() == 0 {
+				if c.Bool("json") {
+					entries, err := app.ConfigEntries(optionsFromContext(c))
+					if err != nil {
+						return exitForError(err)
+					}
+					return outputConfigJSON(entries, c.Bool("show-origin"))
+				}
+				lines, err := app.ConfigShow(optionsFromContext(c), c.Bool("show-origin"))
+				if err != nil {
+					return exitForError(err)
+				}
+				writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				for _, line := range lines {
+					fmt.Fprintln(writer, line)
+				}
+				return writer.Flush()
+			}
+			key := c.Args().Get(0)
+			if c.Args().Len() == 1 {
+				if c.Bool("json") {
+					entries, err := app.ConfigEntries(optionsFromContext(c))
+					if err != nil {
+						return exitForError(err)
+					}
+					for _, entry := range entries {
+						if entry.Key == key {
+							return writeJSON(entry.Value)
+						}
+					}
+				}
+				value, err := app.ConfigGet(optionsFromContext(c), key)
+				if err != nil {
+					return exitForError(err)
+				}
+				fmt.Fprintln(os.Stdout, value)
+				return nil
+			}
+			value := c.Args().Get(1)
+			return printLine(app.ConfigSet(optionsFromContext(c), key, value))
+		},
+	}
+}
+
+func printLine(line string, err error) error {
+	if err != nil {
+		return exitForError(err)
+	}
+	fmt.Fprintln(os.Stdout, line)
+	return nil
+}
+
+func outputConfigJSON(entries []app.ConfigEntry, showOrigin bool) error {
+	payload := map[string]any{}
+	for _, entry := range entries {
+		if showOrigin {
+			payload[entry.Key] = map[string]any{"value": entry.Value, "origin": entry.Origin}
+		} else {
+			payload[entry.Key] = entry.Value
+		}
+	}
+	return writeJSON(payload)
+}
+
+func writeJSON(v any) error {
+	payload, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stdout, string(payload))
+	return nil
+}
+
+// runEditor opens path in $VISUAL or $EDITOR, falling back to vi. The editor
+// command runs through the shell so values such as "code --wait" work.
+func runEditor(path string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	cmd := exec.Command("sh", "-c", editor+` "$1"`, "sh", path)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func confirmReedit(err error) bool {
+	fmt.Fprintf(os.Stderr, "Invalid configuration: %v\n", err)
+	fmt.Fprint(os.Stderr, "Edit again? [Y/n] ")
+	reader := bufio.NewReader(os.Stdin)
+	response, _ := reader.ReadString('\n')
+	response = strings.TrimSpace(strings.ToLower(response))
+	return response == "" || response == "y" || response == "yes"
+}
+
+func migrateCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "migrate",
+		Usage: "Upgrade the allocations file to the current format, or convert it to another backend",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{Name: "dry-run", Usage: "Show what would change without writing"},
+			&cli.StringFlag{Name: "to", Usage: "Copy allocations to another storage backend (json or sqlite)"},
+		},
+		Action: func(c *cli.Context) error {
+			if c.IsSet("to") {
+				if c.Bool("dry-run") {
+					return cli.Exit("--dry-run cannot be combined with --to", 2)
+				}
+				result, err := app.MigrateStore(optionsFromContext(c), c.String("to"))
+				if err != nil {
+					return exitForError(err)
+				}
+				fmt.Fprintf(os.Stdout, "Copied %d allocation(s) from %s to %s\n", result.Count, result.From, result.To)
+				if result.ConfigUpdated {
+					fmt.Fprintf(os.Stdout, "Set storage to %s; %s is kept as a backup\n", c.String("to"), result.From)
+				} else {
+					fmt.Fprintf(os.Stdout, "Point --allocations or %s at %s to use it\n", app.EnvAllocationsPath, result.To)
+				}
+				return nil
+			}
+			dryRun := c.Bool("dry-run")
+			result, err := app.Migrate(optionsFromContext(c), dryRun)
+			if err != nil {
+				return exitForError(err)
+			}
+			if !result.Needed() {
+				fmt.Fprintf(os.Stdout, "%s is up to date (version %d)\n", result.Path, result.To)
+				return nil
+			}
+			verb := "Migrated"
+			if dryRun {
+				verb = "Would migrate"
+			}
+			fmt.Fprintf(os.Stdout, "%s %s from version %d to %d\n", verb, result.Path, result.From, result.To)
+			for _, step := range result.Steps {
+				fmt.Fprintf(os.Stdout, "  v%d -> v%d: %s\n", step.From, step.To, step.Description)
+				for _, change := range step.Changes {
+					fmt.Fprintf(os.Stdout, "    - %s\n", change)
+				}
+			}
+			if result.Backup != "" {
+				fmt.Fprintf(os.Stdout, "Backup saved to %s\n", result.Backup)
+			}
+			return nil
+		},
+	}
+}
+
+func optionsFromContext(c *cli.Context) app.Options {
+	return app.Options{
+		ConfigPath:      c.String("config"),
+		AllocationsPath: c.String("allocations"),
+		Directory:       directorySelector(c),
+		Verbose:         c.Bool("verbose"),
+		ConfigOverrides: configOverrides(c),
+		NoCreate:        c.Bool("no-create"),
+	}
+}
+
+// configOverrideFlags returns one global flag per configuration key, e.g.
+// --port-start. Their PORTPLS_<KEY> environment variables are read by the
+// config package so that flags and env can be told apart in origins.
+func configOverrideFlags() []cli.Flag {
+	keys := config.AllKeys()
+	flags := make([]cli.Flag, 0, len(keys))
+	for _, key := range keys {
+		flags = append(flags, &cli.StringFlag{
+			Name:     config.FlagName(key.Name),
+			Usage:    fmt.Sprintf("Override %s (env: %s)", key.Name, config.EnvName(key.Name)),
+			Category: "Configuration overrides",
+		})
+	}
+	return flags
+}
+
+func configOverrides(c *cli.Context) config.Overrides {
+	overrides := config.Overrides{}
+	for _, key := range config.AllKeys() {
+		if name := config.FlagName(key.Name); c.IsSet(name) {
+			overrides[key.Name] = c.String(name)
+		}
+	}
+	return overrides
+}
+
+func labelFlag() cli.Flag {
+	return &cli.StringSliceFlag{Name: "label", Usage: "Set a label, e.g. --label env=e2e (repeatable)"}
+}
+
+func noteFlag() cli.Flag {
+	return &cli.StringFlag{Name: "note", Usage: "Set a free-text note; empty clears it"}
+}
+
+func selectorFlag() cli.Flag {
+	return &cli.StringFlag{Name: "selector", Aliases: []string{"l"}, Usage: "Filter by labels, e.g. env=e2e,owner in (alice,bob)"}
+}
+
+// metadataFromFlags builds label and note changes from --label, --note and
+// any extra KEY=VALUE or KEY- arguments.
+func metadataFromFlags(c *cli.Context, args []string) (app.Metadata, error) {
+	var meta app.Metadata
+	if c.IsSet("label") {
+		args = append(c.StringSlice("label"), args...)
+	}
+	set, remove, err := labels.ParseAssignments(args)
+	if err != nil {
+		return meta, app.NewCodeError(2, err)
+	}
+	meta.Labels, meta.RemoveLabels = set, remove
+	if c.IsSet("note") {
+		note := c.String("note")
+		meta.Note = &note
+	}
+	return meta, nil
+}
+
+// filterFlags are the allocation filters shared by list and forget.
+func filterFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{Name: "status", Usage: "Filter by port status: busy or free"},
+		&cli.BoolFlag{Name: "locked", Usage: "Only locked allocations"},
+		&cli.BoolFlag{Name: "unlocked", Usage: "Only unlocked allocations"},
+		&cli.StringFlag{Name: "older-than", Usage: "Only allocations assigned longer ago than this, e.g. 7d"},
+		&cli.StringFlag{Name: "unused-for", Usage: "Only allocations not requested for this long, e.g. 3d"},
+		&cli.StringFlag{Name: "under", Usage: "Only allocations in this directory or below it"},
+		selectorFlag(),
+	}
+}
+
+// filterPredicate combines the filters from filterFlags. It returns nil
+// when none are set.
+func filterPredicate(c *cli.Context) (app.Predicate, error) {
+	var preds []app.Predicate
+	if c.IsSet("status") {
+		p, err := app.WithStatus(strings.ToLower(c.String("status")))
+		if err != nil {
+			return nil, err
+		}
+		preds = append(preds, p)
+	}
+	if c.Bool("locked") && c.Bool("unlocked") {
+		return nil, app.NewCodeError(2, fmt.Errorf("%w: --locked and --unlocked are mutually exclusive", app.ErrInvalidFilter))
+	}
+	if c.Bool("locked") {
+		preds = append(preds, app.WithLocked(true))
+	}
+	if c.Bool("unlocked") {
+		preds = append(preds, app.WithLocked(false))
+	}
+	now := time.Now()
+	for _, f := range []struct {
+		flag string
+		pred func(time.Duration, time.Time) app.Predicate
+	}{
+		{"older-than", app.OlderThan},
+		{"unused-for", app.UnusedFor},
+	} {
+		if !c.IsSet(f.flag) {
+			continue
+		}
+		d, err := config.ParseDuration(c.String(f.flag))
+		if err != nil {
+			return nil, app.NewCodeError(2, fmt.Errorf("%w: --%s: %v", app.ErrInvalidFilter, f.flag, err))
+		}
+		preds = append(preds, f.pred(d, now))
+	}
+	if c.IsSet("under") {
+		p, err := app.UnderDirectory(c.String("under"))
+		if err != nil {
+			return nil, err
+		}
+		preds = append(preds, p)
+	}
+	if c.IsSet("selector") {
+		selector, err := labels.ParseSelector(c.String("selector"))
+		if err != nil {
+			return nil, app.NewCodeError(2, err)
+		}
+		preds = append(preds, app.WithLabels(selector))
+	}
+	if len(preds) == 0 {
+		return nil, nil
+	}
+	return app.MatchAll(preds...), nil
+}
+
+// directorySelector returns a DirectorySelector from CLI flags.
+// Priority: command-specific --directory > parent/global --directory > current directory
+func directorySelector(c *cli.Context) app.DirectorySelector {
+	if c.IsSet("directory") {
+		return app.SpecificDirectory{Path: c.String("directory")}
+	}
+	if parent, ok := parentDirectory(c); ok {
+		return app.SpecificDirectory{Path: parent}
+	}
+	return app.CurrentDirectory{}
+}
+
+// listFilter returns a DirectoryFilter for the list command.
+// Priority: command-specific --directory > parent/global --directory > no filter (show all)
+func listFilter(c *cli.Context) (app.DirectoryFilter, error) {
+	if c.IsSet("directory") {
+		return app.FilterByDirectory(c.String("directory"))
+	}
+	if parent, ok := parentDirectory(c); ok {
+		return app.FilterByDirectory(parent)
+	}
+	return app.NoFilter(), nil
+}
+
+// parentDirectory returns the directory from the root/parent CLI context if set.
+func parentDirectory(c *cli.Context) (string, bool) {
+	lineage := c.Lineage()
+	if len(lineage) == 0 {
+		return "", false
+	}
+	root := lineage[len(lineage)-1]
+	if root == nil || root == c {
+		return "", false
+	}
+	if root.IsSet("directory") {
+		return root.String("directory"), true
+	}
+	return "", false
+}
+
+func exitForError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var codeErr app.CodeError
+	if errors.As(err, &codeErr) {
+		return cli.Exit(codeErr.Error(), codeErr.Code)
+	}
+	return cli.Exit(err.Error(), 2)
+}
+
+func confirmGlobalForget(filtered bool) bool {
+	if filtered {
+		fmt.Fprint(os.Stdout, "This will remove all port allocations matching the filters. Continue? [y/N] ")
+	} else {
+		fmt.Fprint(os.Stdout, "This will remove ALL port allocations. Continue? [y/N] ")
+	}
 	reader := bufio.NewReader(os.Stdin)
 	response, _ := reader.ReadString('\n')
 	response = strings.TrimSpace(strings.ToLower(response))
@@ -0,0 +1,161 @@
+// Package portpls lets Go programs obtain and manage ports the way the
+// portpls CLI does, sharing its configuration and allocations.
+//
+//	client := &portpls.Client{Directory: projectDir}
+//	ports, err := client.GetMany("web", "db")
+//	if err != nil {
+//		return err
+//	}
+//	addr := fmt.Sprintf("127.0.0.1:%d", ports["web"])
+//
+// Errors wrap the sentinel errors below, so check them with errors.Is.
+package portpls
+
+import (
+	"time"
+
+	"github.com/bamorim/portpls/internal/app"
+)
+
+// Errors returned by Client methods.
+var (
+	// ErrNoFreePorts means every port in the configured range is allocated,
+	// busy or frozen.
+	ErrNoFreePorts = app.ErrNoFreePorts
+	// ErrNotFound means there is no allocation with the requested name.
+	ErrNotFound = app.ErrAllocationNotFound
+)
+
+// DefaultName is the allocation name the CLI uses without --name.
+const DefaultName = "main"
+
+// Client works with the allocations of one directory. The zero value uses
+// the same files as the CLI in the working directory. A Client is safe for
+// concurrent use, and so are clients in other processes: every call is a
+// transaction on the allocations store.
+type Client struct {
+	// ConfigPath is the configuration file. Empty uses $PORTPLS_CONFIG or
+	// the default location.
+	ConfigPath string
+	// AllocationsPath is the allocations store; a .db extension selects
+	// SQLite. Empty uses $PORTPLS_ALLOCATIONS or the configured store.
+	AllocationsPath string
+	// Directory is the directory allocations belong to. Empty uses the
+	// working directory at the time of each call.
+	Directory string
+}
+
+// Allocation is a port allocated to a directory.
+type Allocation struct {
+	Port       int
+	Directory  string
+	Name       string
+	Busy       bool // something listened on the port when it was listed
+	Locked     bool
+	AssignedAt time.Time
+	LastUsedAt time.Time
+	Labels     map[string]string
+	Note       string
+}
+
+// ScanResult describes a Scan.
+type ScanResult struct {
+	Start, End int      // the port range scanned
+	Recorded   int      // busy ports recorded as new allocations
+	Messages   []string // one line per busy port, as the CLI prints them
+}
+
+func (c *Client) options() app.Options {
+	opts := app.Options{
+		ConfigPath:      c.ConfigPath,
+		AllocationsPath: c.AllocationsPath,
+		Directory:       app.CurrentDirectory{},
+	}
+	if c.Directory != "" {
+		opts.Directory = app.SpecificDirectory{Path: c.Directory}
+	}
+	return opts
+}
+
+// Get returns the port allocated as name, allocating one if there is none or
+// if the allocated port is taken by something else.
+func (c *Client) Get(name string) (int, error) {
+	return app.GetPort(c.options(), name, app.Metadata{})
+}
+
+// GetMany is Get for several names, allocated together: either every name
+// gets a port or none does.
+func (c *Client) GetMany(names ...string) (map[string]int, error) {
+	return app.GetPorts(c.options(), names, app.Metadata{})
+}
+
+// Lock returns the port allocated as name, allocating one if needed, and
+// locks it so it is kept even while the port is busy.
+func (c *Client) Lock(name string) (int, error) {
+	return app.LockPort(c.options(), name, app.Metadata{})
+}
+
+// Unlock unlocks the allocation called name and returns its port.
+func (c *Client) Unlock(name string) (int, error) {
+	return app.UnlockPort(c.options(), name)
+}
+
+// Forget removes the allocation called name. It returns ErrNotFound if
+// there is none.
+func (c *Client) Forget(name string) error {
+	filter, err := app.FilterBySelector(c.options().Directory)
+	if err != nil {
+		return err
+	}
+	result, err := app.Forget(c.options(), filter, nil, name, true, false, nil)
+	if err == nil && result.Count == 0 {
+		err = app.NewCodeError(1, ErrNotFound)
+	}
+	return err
+}
+
+// ForgetAll removes every allocation of the directory and returns how many
+// there were.
+func (c *Client) ForgetAll() (int, error) {
+	filter, err := app.FilterBySelector(c.options().Directory)
+	if err != nil {
+		return 0, err
+	}
+	result, err := app.Forget(c.options(), filter, nil, "", false, true, nil)
+	return result.Count, err
+}
+
+// List returns the allocations of every directory, ordered by port, after
+// removing those past the configured TTL.
+func (c *Client) List() ([]Allocation, error) {
+	entries, err := app.ListAllocations(c.options(), nil)
+	if err != nil {
+		return nil, err
+	}
+	allocations := make([]Allocation, len(entries))
+	for i, e := range entries {
+		allocations[i] = Allocation{
+			Port:       e.Port,
+			Directory:  e.Directory,
+			Name:       e.Name,
+			Busy:       e.Status == app.StatusBusy,
+			Locked:     e.Locked,
+			AssignedAt: e.AssignedAt,
+			LastUsedAt: e.LastUsedAt,
+			Labels:     e.Labels,
+			Note:       e.Note,
+		}
+	}
+	return allocations, nil
+}
+
+// Scan records the busy ports in the configured range that have no
+// allocation, attributing each to the directory of the process or Docker
+// container listening on it.
+func (c *Client) Scan() (ScanResult, error) {
+	result, err := app.Scan(c.options())
+	if err != nil {
+		return ScanResult{}, err
+	}
+	return ScanResult{Start: result.Start, End: result.End, Recorded: result.Added, Messages: result.Lines}, nil
+}
@@ -0,0 +1,78 @@
+package portpls
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func newTestClient(t *testing.T, start, end int) *Client {
+	t.Helper()
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.json")
+	config := []byte(`{"port_start": ` + strconv.Itoa(start) + `, "port_end": ` + strconv.Itoa(end) + `, "freeze_period": "0", "allocation_ttl": "0"}`)
+	if err := os.WriteFile(configPath, config, 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	project := filepath.Join(tmpDir, "project")
+	if err := os.Mkdir(project, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	return &Client{
+		ConfigPath:      configPath,
+		AllocationsPath: filepath.Join(tmpDir, "allocations.json"),
+		Directory:       project,
+	}
+}
+
+func TestClient(t *testing.T) {
+	client := newTestClient(t, 43100, 43102)
+
+	web, err := client.Get("web")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if again, err := client.Get("web"); err != nil || again != web {
+		t.Errorf("Get again = %d, %v; want %d", again, err, web)
+	}
+
+	ports, err := client.GetMany("web", "api")
+	if err != nil || ports["web"] != web || ports["api"] == 0 || ports["api"] == web {
+		t.Errorf("GetMany = %v, %v", ports, err)
+	}
+
+	if port, err := client.Lock(DefaultName); err != nil || port == 0 {
+		t.Errorf("Lock = %d, %v", port, err)
+	}
+	if _, err := client.GetMany("db"); !errors.Is(err, ErrNoFreePorts) {
+		t.Errorf("GetMany error = %v, want ErrNoFreePorts", err)
+	}
+
+	list, err := client.List()
+	if err != nil || len(list) != 3 {
+		t.Fatalf("List = %+v, %v", list, err)
+	}
+	for _, a := range list {
+		if a.Directory != client.Directory || a.Locked != (a.Name == DefaultName) {
+			t.Errorf("allocation %+v", a)
+		}
+	}
+
+	if _, err := client.Unlock(DefaultName); err != nil {
+		t.Errorf("Unlock: %v", err)
+	}
+	if _, err := client.Unlock("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Unlock error = %v, want ErrNotFound", err)
+	}
+	if err := client.Forget("api"); err != nil {
+		t.Errorf("Forget: %v", err)
+	}
+	if err := client.Forget("api"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Forget error = %v, want ErrNotFound", err)
+	}
+	if n, err := client.ForgetAll(); err != nil || n != 2 {
+		t.Errorf("ForgetAll = %d, %v; want 2", n, err)
+	}
+}